@@ -0,0 +1,336 @@
+package addon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+// Duration is a time.Duration written as a string such as "250ms" in rule files.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("duration must be a string such as \"250ms\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// FlowMatch matches the requests of flows, all requests if empty.
+type FlowMatch struct {
+	Hosts   []string `json:"hosts"`   // hosts, "*.example.com" for the subdomains of example.com, all hosts if empty
+	Paths   []string `json:"paths"`   // paths, "/api/*" for the paths starting with /api/, all paths if empty
+	Methods []string `json:"methods"` // all methods if empty
+}
+
+// ConditionRule simulates poor network conditions for the flows it matches.
+type ConditionRule struct {
+	Name string `json:"name"`
+	FlowMatch
+
+	// Probability of applying the rule to a matching flow, from 0 to 1, always if 0.
+	Probability float64 `json:"probability"`
+
+	Latency Duration `json:"latency"` // added before the response headers
+	Jitter  Duration `json:"jitter"`  // random latency added, up to this duration
+
+	StallAfter int64    `json:"stallAfter"` // stall after this number of response body bytes
+	Stall      Duration `json:"stall"`      // for this duration
+
+	Reset      bool  `json:"reset"`      // reset the client connection
+	ResetAfter int64 `json:"resetAfter"` // after this number of response body bytes, before the response headers if 0
+
+	// Timeout holds the response until the client gives up, or for this duration at most, then resets the client connection.
+	Timeout Duration `json:"timeout"`
+}
+
+// NetworkConditions applies latency, stalls, connection resets and timeouts of ConditionRules to the responses.
+// The first rule matching a flow applies to it with its probability. The rule is set in the "networkCondition"
+// metadata of the flow.
+//
+// It serves the rules as JSON on GET, replaces them on PUT and reloads them from the file on POST,
+// e.g. on the web interface with WebAddon.Handle.
+type NetworkConditions struct {
+	proxy.BaseAddon
+	filename string
+	rules    atomic.Pointer[[]*ConditionRule]
+	rand     func() float64
+	logger   *slog.Logger
+}
+
+func NewNetworkConditions(rules []*ConditionRule) (*NetworkConditions, error) {
+	c := &NetworkConditions{
+		rand:   rand.Float64,
+		logger: sLogger.With("addonName", "NetworkConditions"),
+	}
+	if err := c.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewNetworkConditionsFromFile reads the rules from a JSON array of ConditionRule, Reload reads them again.
+func NewNetworkConditionsFromFile(filename string) (*NetworkConditions, error) {
+	c, err := NewNetworkConditions(nil)
+	if err != nil {
+		return nil, err
+	}
+	c.filename = filename
+	c.logger = c.logger.With("filename", filename)
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the rules from the file again, the rules are kept if it fails.
+func (c *NetworkConditions) Reload() error {
+	if c.filename == "" {
+		return errors.New("network conditions not loaded from a file")
+	}
+	data, err := os.ReadFile(c.filename)
+	if err != nil {
+		return err
+	}
+	var rules []*ConditionRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("network conditions %s: %w", c.filename, err)
+	}
+	if err := c.SetRules(rules); err != nil {
+		return err
+	}
+	c.logger.Info("network conditions loaded", "rules", len(rules))
+	return nil
+}
+
+// Rules returns the current rules, which must not be modified.
+func (c *NetworkConditions) Rules() []*ConditionRule {
+	return *c.rules.Load()
+}
+
+// SetRules replaces the rules, the flows in progress keep the rule applied to them.
+func (c *NetworkConditions) SetRules(rules []*ConditionRule) error {
+	for i, r := range rules {
+		if r.Probability < 0 || r.Probability > 1 {
+			return fmt.Errorf("network condition %d: probability %v not between 0 and 1", i, r.Probability)
+		}
+		if r.Latency < 0 || r.Jitter < 0 || r.Stall < 0 || r.Timeout < 0 || r.StallAfter < 0 || r.ResetAfter < 0 {
+			return fmt.Errorf("network condition %d: negative duration or size", i)
+		}
+		r.FlowMatch.compile()
+	}
+	if rules == nil {
+		rules = []*ConditionRule{}
+	}
+	c.rules.Store(&rules)
+	return nil
+}
+
+func (c *NetworkConditions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var rules []*ConditionRule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.SetRules(rules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.logger.Info("network conditions set", "rules", len(rules))
+	case http.MethodPost:
+		if err := c.Reload(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.Rules())
+}
+
+func (m *FlowMatch) compile() {
+	for i, host := range m.Hosts {
+		m.Hosts[i] = strings.ToLower(host)
+	}
+}
+
+// match reports whether the request of the flow matches.
+func (m *FlowMatch) match(f *proxy.Flow) bool {
+	if len(m.Methods) > 0 && !containsFold(m.Methods, f.Request.Method) {
+		return false
+	}
+	if len(m.Hosts) > 0 {
+		host := strings.ToLower(strings.TrimSuffix(f.Request.URL.Hostname(), "."))
+		found := false
+		for _, pattern := range m.Hosts {
+			if proxy.MatchHost(pattern, host) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(m.Paths) > 0 {
+		path := f.Request.URL.Path
+		for _, pattern := range m.Paths {
+			if prefix, ok := strings.CutSuffix(pattern, "*"); (ok && strings.HasPrefix(path, prefix)) || pattern == path {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleFor returns the rule applied to the flow, nil if none.
+func (c *NetworkConditions) ruleFor(f *proxy.Flow) *ConditionRule {
+	for _, r := range c.Rules() {
+		if !r.match(f) {
+			continue
+		}
+		if r.Probability > 0 && c.rand() >= r.Probability {
+			return nil
+		}
+		return r
+	}
+	return nil
+}
+
+// sleep waits for d, false if the client gave up before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func requestContext(f *proxy.Flow) context.Context {
+	if raw := f.Request.Raw(); raw != nil {
+		return raw.Context()
+	}
+	return context.Background()
+}
+
+func (c *NetworkConditions) Responseheaders(f *proxy.Flow) {
+	r := c.ruleFor(f)
+	if r == nil {
+		return
+	}
+	f.Metadata.Set("networkCondition", r)
+	logger := c.logger.With("url", f.Request.URL.String(), "rule", r.Name)
+	ctx := requestContext(f)
+
+	if r.Timeout > 0 {
+		logger.Debug("holding the response until the client times out")
+		sleep(ctx, time.Duration(r.Timeout))
+		f.Kill()
+		return
+	}
+
+	latency := time.Duration(r.Latency)
+	if r.Jitter > 0 {
+		latency += time.Duration(c.rand() * float64(r.Jitter))
+	}
+	if !sleep(ctx, latency) {
+		return
+	}
+
+	if r.Reset && r.ResetAfter == 0 {
+		logger.Debug("resetting the client connection")
+		f.Kill()
+		return
+	}
+	if r.Stall > 0 || r.Reset {
+		// the body is relayed through StreamResponseModifier to stall or reset in the middle of it
+		f.Stream = true
+	}
+}
+
+func (c *NetworkConditions) StreamResponseModifier(f *proxy.Flow, in io.Reader) io.Reader {
+	v, _ := f.Metadata.Get("networkCondition")
+	r, ok := v.(*ConditionRule)
+	if !ok || in == nil || (r.Stall <= 0 && !r.Reset) {
+		return in
+	}
+	return &conditionReader{r: in, f: f, rule: r, ctx: requestContext(f)}
+}
+
+// conditionReader stalls and resets the client connection at the offsets of the rule.
+type conditionReader struct {
+	r       io.Reader
+	f       *proxy.Flow
+	rule    *ConditionRule
+	ctx     context.Context
+	n       int64
+	stalled bool
+}
+
+func (cr *conditionReader) Read(p []byte) (int, error) {
+	rule := cr.rule
+
+	if rule.Stall > 0 && !cr.stalled && cr.n >= rule.StallAfter {
+		cr.stalled = true
+		sleep(cr.ctx, time.Duration(rule.Stall))
+	}
+	if rule.Reset && cr.n >= rule.ResetAfter {
+		cr.f.Kill()
+		return 0, errors.New("connection reset by network condition")
+	}
+
+	// stop at the next offset
+	limit := int64(len(p))
+	if rule.Stall > 0 && !cr.stalled {
+		limit = min(limit, rule.StallAfter-cr.n)
+	}
+	if rule.Reset {
+		limit = min(limit, rule.ResetAfter-cr.n)
+	}
+	n, err := cr.r.Read(p[:limit])
+	cr.n += int64(n)
+	return n, err
+}
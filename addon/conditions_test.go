@@ -0,0 +1,137 @@
+package addon
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetworkConditions(t *testing.T) {
+	var rules []*ConditionRule
+	err := json.Unmarshal([]byte(`[
+		{"name": "slow api", "hosts": ["*.example.com"], "paths": ["/api/*"], "methods": ["post"], "latency": "50ms", "probability": 0.5},
+		{"name": "reset", "paths": ["/reset"], "reset": true, "resetAfter": 4},
+		{"name": "stall", "paths": ["/stall"], "stall": "50ms", "stallAfter": 2}
+	]`), &rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewNetworkConditions(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roll := 0.9
+	c.rand = func() float64 { return roll }
+
+	matches := map[string]bool{
+		"POST http://www.example.com/api/users": true,
+		"GET http://www.example.com/api/users":  false,
+		"POST http://example.com/api/users":     false,
+		"POST http://www.example.com/apis":      false,
+	}
+	for request, want := range matches {
+		method, rawURL, _ := strings.Cut(request, " ")
+		if got := rules[0].match(newTestFlow(method, rawURL, nil, "")); got != want {
+			t.Fatalf("%s: expected %v, but got %v", request, want, got)
+		}
+	}
+
+	// the first matching rule applies with its probability
+	f := newTestFlow("POST", "http://www.example.com/api/users", nil, "")
+	c.Responseheaders(f)
+	if _, ok := f.Metadata.Get("networkCondition"); ok {
+		t.Fatal("expected the rule not to apply")
+	}
+	roll = 0.1
+	start := time.Now()
+	c.Responseheaders(f)
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("expected the latency to be added, but took %v", d)
+	}
+	if v, _ := f.Metadata.Get("networkCondition"); v != rules[0] {
+		t.Fatalf("expected the rule in the metadata, but got %v", v)
+	}
+
+	// reset after 4 bytes of the body
+	f = newTestFlow("GET", "http://test/reset", nil, "")
+	c.Responseheaders(f)
+	if !f.Stream || f.Killed() {
+		t.Fatal("expected the body to be streamed")
+	}
+	body, err := io.ReadAll(c.StreamResponseModifier(f, strings.NewReader("0123456789")))
+	if err == nil || string(body) != "0123" || !f.Killed() {
+		t.Fatalf("expected a reset after 4 bytes, but got %q %v", body, err)
+	}
+
+	// stall after 2 bytes
+	f = newTestFlow("GET", "http://test/stall", nil, "")
+	c.Responseheaders(f)
+	start = time.Now()
+	body, err = io.ReadAll(c.StreamResponseModifier(f, strings.NewReader("0123456789")))
+	if err != nil || string(body) != "0123456789" {
+		t.Fatalf("unexpected body %q %v", body, err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("expected a stall, but took %v", d)
+	}
+
+	if _, err := NewNetworkConditions([]*ConditionRule{{Probability: 2}}); err == nil {
+		t.Fatal("expected an error of the probability")
+	}
+	if err := json.Unmarshal([]byte(`{"latency": 100}`), &ConditionRule{}); err == nil {
+		t.Fatal("expected an error of the latency")
+	}
+}
+
+func TestNetworkConditionsReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "conditions.json")
+	os.WriteFile(filename, []byte(`[{"name": "a", "latency": "1s"}]`), 0o644)
+	c, err := NewNetworkConditionsFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules := c.Rules(); len(rules) != 1 || time.Duration(rules[0].Latency) != time.Second {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+
+	// PUT replaces the rules
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("PUT", "/api/conditions", strings.NewReader(`[{"name": "b"}, {"name": "c"}]`)))
+	if w.Code != 200 || len(c.Rules()) != 2 {
+		t.Fatalf("unexpected PUT %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("PUT", "/api/conditions", strings.NewReader(`[{"probability": -1}]`)))
+	if w.Code != 400 || len(c.Rules()) != 2 {
+		t.Fatalf("expected the invalid rules to be refused, but got %d", w.Code)
+	}
+
+	// POST reloads the file
+	os.WriteFile(filename, []byte(`[{"name": "d", "timeout": "5s"}]`), 0o644)
+	w = httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("POST", "/api/conditions", nil))
+	if w.Code != 200 || len(c.Rules()) != 1 || c.Rules()[0].Name != "d" {
+		t.Fatalf("unexpected POST %d %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/api/conditions", nil))
+	var rules []*ConditionRule
+	if err := json.Unmarshal(w.Body.Bytes(), &rules); err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || time.Duration(rules[0].Timeout) != 5*time.Second || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected GET %s", w.Body)
+	}
+	w = httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/conditions", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, but got %d", w.Code)
+	}
+}
@@ -8,15 +8,18 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"unicode"
 
+	"github.com/proxati/mitmproxy/contentview"
 	"github.com/proxati/mitmproxy/proxy"
 )
 
 type Dumper struct {
 	proxy.BaseAddon
 	out    io.Writer
-	level  int // 0: header 1: header + body
+	mu     sync.Mutex // guards out
+	level  int        // 0: header 1: header + body
 	logger *slog.Logger
 }
 
@@ -40,9 +43,11 @@ func NewDumperWithFilename(filename string, level int) *Dumper {
 }
 
 func (d *Dumper) Requestheaders(f *proxy.Flow) {
+	release := f.RetainBodies()
 	go func() {
 		<-f.Done()
 		d.dump(f)
+		release()
 	}()
 }
 
@@ -60,6 +65,10 @@ func (d *Dumper) dump(f *proxy.Flow) {
 		logger = logger.With("URL", f.Request.URL.String())
 	}
 
+	// spilled bodies are written to out directly, keep the dump of a flow in one piece
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	buf := bytes.NewBuffer(make([]byte, 0))
 	fmt.Fprintf(buf, "%s %s %s\r\n", f.Request.Method, f.Request.URL.RequestURI(), f.Request.Proto)
 	fmt.Fprintf(buf, "Host: %s\r\n", f.Request.URL.Host)
@@ -76,9 +85,12 @@ func (d *Dumper) dump(f *proxy.Flow) {
 	}
 	buf.WriteString("\r\n")
 
-	if d.level == 1 && f.Request.Body != nil && len(f.Request.Body) > 0 && canPrint(f.Request.Body) {
-		buf.Write(f.Request.Body)
-		buf.WriteString("\r\n\r\n")
+	if d.level == 1 && f.Request.BodySpilled() {
+		buf = d.dumpSpilled(logger, buf, f.Request.OpenBody())
+	} else if d.level == 1 && f.Request.Body != nil && len(f.Request.Body) > 0 {
+		if view, text, err := contentview.RenderRequest(f); err == nil {
+			d.dumpBody(buf, view, text)
+		}
 	}
 
 	if f.Response != nil {
@@ -89,11 +101,15 @@ func (d *Dumper) dump(f *proxy.Flow) {
 		}
 		buf.WriteString("\r\n")
 
-		if d.level == 1 && f.Response.Body != nil && len(f.Response.Body) > 0 && f.Response.IsTextContentType() {
-			body, err := f.Response.DecodedBody()
-			if err == nil && body != nil && len(body) > 0 {
-				buf.Write(body)
-				buf.WriteString("\r\n\r\n")
+		if d.level == 1 && f.Response.BodySpilled() && f.Response.IsTextContentType() {
+			body, err := proxy.DecodeReader(f.Response.Header, f.Response.OpenBody())
+			if err == nil {
+				buf = d.dumpSpilled(logger, buf, body)
+				body.Close()
+			}
+		} else if d.level == 1 && f.Response.Body != nil && len(f.Response.Body) > 0 {
+			if view, text, err := contentview.RenderResponse(f); err == nil {
+				d.dumpBody(buf, view, text)
 			}
 		}
 	}
@@ -106,6 +122,61 @@ func (d *Dumper) dump(f *proxy.Flow) {
 	}
 }
 
+// maxDumpHex caps the bytes of a binary body dumped as hex.
+const maxDumpHex = 4096
+
+// dumpBody writes a body rendered by its content view, the hex view of a binary body is cut at maxDumpHex bytes.
+func (d *Dumper) dumpBody(buf *bytes.Buffer, view string, text string) {
+	if view == contentview.Hex.Name() {
+		text = cutHexDump(text, maxDumpHex)
+	}
+	buf.WriteString(text)
+	buf.WriteString("\r\n\r\n")
+}
+
+// dumpSpilled writes buf and then the body spilled to disk to out, without reading the body into memory.
+// It returns a new buffer for the rest of the dump.
+func (d *Dumper) dumpSpilled(logger *slog.Logger, buf *bytes.Buffer, body io.Reader) *bytes.Buffer {
+	head := make([]byte, 4096)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		logger.Error("could not read spilled body", "error", err)
+		return buf
+	}
+	if !canPrint(head[:n]) {
+		return buf
+	}
+
+	_, err = d.out.Write(buf.Bytes())
+	if err == nil {
+		_, err = io.Copy(d.out, io.MultiReader(bytes.NewReader(head[:n]), body))
+	}
+	if err != nil {
+		logger.Error("could not write spilled body", "error", err)
+	}
+
+	buf = bytes.NewBuffer(make([]byte, 0))
+	buf.WriteString("\r\n\r\n")
+	return buf
+}
+
+// cutHexDump keeps the lines of a hex.Dump of the first n bytes, 16 bytes per line.
+func cutHexDump(text string, n int) string {
+	lines := n / 16
+	i := 0
+	for ; lines > 0; lines-- {
+		next := strings.IndexByte(text[i:], '\n')
+		if next < 0 {
+			return text
+		}
+		i += next + 1
+	}
+	if i == len(text) {
+		return text
+	}
+	return text[:i] + fmt.Sprintf("... cut at %d bytes\n", n)
+}
+
 func canPrint(content []byte) bool {
 	for _, c := range string(content) {
 		if !unicode.IsPrint(c) && !unicode.IsSpace(c) {
@@ -0,0 +1,24 @@
+package addon
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestCutHexDump(t *testing.T) {
+	body := bytes.Repeat([]byte{0, 1, 2, 3}, 4096)
+	text := cutHexDump(hex.Dump(body), maxDumpHex)
+	if want := hex.Dump(body[:maxDumpHex]); !strings.HasPrefix(text, want) {
+		t.Fatal("expected the dump of the first bytes")
+	}
+	if !strings.HasSuffix(text, "... cut at 4096 bytes\n") || len(text) > len(hex.Dump(body[:maxDumpHex]))+32 {
+		t.Fatalf("expected a cut dump, but got %d bytes", len(text))
+	}
+
+	small := hex.Dump(body[:100])
+	if cutHexDump(small, maxDumpHex) != small {
+		t.Fatal("small dump should not be cut")
+	}
+}
@@ -0,0 +1,199 @@
+package addon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+// FaultRule injects faults into the flows it matches.
+type FaultRule struct {
+	Name string `json:"name"`
+	FlowMatch
+
+	// Percentage of the matching flows to inject the faults into, from 0 to 100, all of them if not set.
+	Percentage *float64 `json:"percentage"`
+	// Count is the number of flows to inject the faults into at most, unlimited if 0.
+	Count int64 `json:"count"`
+
+	Delay Duration `json:"delay"` // delay the request before the other faults
+	Drop  bool     `json:"drop"`  // drop the client connection without a response
+
+	// Status replies this status code without sending the request to the server, with Body if not empty.
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+
+	// Faults of the server response.
+	RemoveHeaders []string `json:"removeHeaders"`
+	Truncate      int64    `json:"truncate"`    // cut the body after this number of bytes, Content-Length is kept so the client sees it cut
+	CorruptJSON   bool     `json:"corruptJSON"` // cut JSON bodies in half, Content-Length is fixed so the client fails to parse them
+
+	injected atomic.Int64
+}
+
+// Injected returns the number of flows the faults were injected into.
+func (r *FaultRule) Injected() int64 {
+	n := r.injected.Load()
+	if r.Count > 0 {
+		n = min(n, r.Count)
+	}
+	return n
+}
+
+// Faults injects the faults of FaultRules into the flows, for testing the resilience of clients against real servers.
+// The rules are tried in order, the faults of the first one which matches a flow and is selected by its percentage
+// and count are injected. The rule is set in the "fault" metadata of the flow.
+type Faults struct {
+	proxy.BaseAddon
+	rules  []*FaultRule
+	rand   func() float64
+	logger *slog.Logger
+}
+
+func NewFaults(rules []*FaultRule) (*Faults, error) {
+	for i, r := range rules {
+		if r.Percentage != nil && (*r.Percentage < 0 || *r.Percentage > 100) {
+			return nil, fmt.Errorf("fault rule %d: percentage %v not between 0 and 100", i, *r.Percentage)
+		}
+		if r.Status != 0 && (r.Status < 100 || r.Status > 999) {
+			return nil, fmt.Errorf("fault rule %d: invalid status %d", i, r.Status)
+		}
+		if r.Count < 0 || r.Delay < 0 || r.Truncate < 0 {
+			return nil, fmt.Errorf("fault rule %d: negative count, delay or truncate", i)
+		}
+		r.FlowMatch.compile()
+	}
+	return &Faults{
+		rules:  rules,
+		rand:   rand.Float64,
+		logger: sLogger.With("addonName", "Faults"),
+	}, nil
+}
+
+// NewFaultsFromFile reads the rules from a JSON array of FaultRule.
+func NewFaultsFromFile(filename string) (*Faults, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*FaultRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("fault rules %s: %w", filename, err)
+	}
+	return NewFaults(rules)
+}
+
+// Rules returns the rules, e.g. to check how many flows they were injected into.
+func (fa *Faults) Rules() []*FaultRule {
+	return fa.rules
+}
+
+// selected reports whether the faults of the rule are injected into a matching flow.
+func (fa *Faults) selected(r *FaultRule) bool {
+	if r.Percentage != nil && fa.rand()*100 >= *r.Percentage {
+		return false
+	}
+	n := r.injected.Add(1)
+	return r.Count == 0 || n <= r.Count
+}
+
+func faultOf(f *proxy.Flow) *FaultRule {
+	v, _ := f.Metadata.Get("fault")
+	r, _ := v.(*FaultRule)
+	return r
+}
+
+func (fa *Faults) Requestheaders(f *proxy.Flow) {
+	var r *FaultRule
+	for _, rule := range fa.rules {
+		if rule.match(f) && fa.selected(rule) {
+			r = rule
+			break
+		}
+	}
+	if r == nil {
+		return
+	}
+	f.Metadata.Set("fault", r)
+	logger := fa.logger.With("url", f.Request.URL.String(), "rule", r.Name)
+	logger.Debug("injecting fault")
+
+	if !sleep(requestContext(f), time.Duration(r.Delay)) {
+		return
+	}
+	if r.Drop {
+		f.Kill()
+		return
+	}
+	if r.Status != 0 {
+		body := r.Body
+		if body == "" {
+			body = http.StatusText(r.Status) + "\n"
+		}
+		f.Response = &proxy.Response{
+			StatusCode: r.Status,
+			Header: http.Header{
+				"Content-Type":   {"text/plain; charset=utf-8"},
+				"Content-Length": {strconv.Itoa(len(body))},
+			},
+			Body: []byte(body),
+		}
+	}
+}
+
+func (fa *Faults) Responseheaders(f *proxy.Flow) {
+	r := faultOf(f)
+	if r == nil {
+		return
+	}
+	for _, key := range r.RemoveHeaders {
+		f.Response.Header.Del(key)
+	}
+}
+
+// Response injects the faults of the body, a body spilled to disk is read into memory up to what is kept of it.
+func (fa *Faults) Response(f *proxy.Flow) {
+	r := faultOf(f)
+	if r == nil || (f.Response.Body == nil && !f.Response.BodySpilled()) {
+		return
+	}
+	if r.CorruptJSON && strings.Contains(f.Response.Header.Get("Content-Type"), "json") {
+		body, err := f.Response.DecodedBody()
+		if err == nil && len(body) > 0 {
+			if err := f.Response.SetDecodedBody(body[:len(body)/2]); err != nil {
+				fa.logger.Error("could not corrupt json", "error", err)
+			}
+		}
+	}
+	if r.Truncate > 0 && f.Response.BodySize() > r.Truncate {
+		if f.Response.BodySpilled() {
+			body, err := io.ReadAll(io.LimitReader(f.Response.OpenBody(), r.Truncate))
+			if err != nil {
+				fa.logger.Error("could not truncate spilled body", "error", err)
+				return
+			}
+			f.Response.Body = body
+		} else {
+			f.Response.Body = f.Response.Body[:r.Truncate]
+		}
+	}
+}
+
+// StreamResponseModifier truncates the streamed bodies, which are not corrupted.
+func (fa *Faults) StreamResponseModifier(f *proxy.Flow, in io.Reader) io.Reader {
+	r := faultOf(f)
+	if r == nil || in == nil || r.Truncate <= 0 {
+		return in
+	}
+	return io.LimitReader(in, r.Truncate)
+}
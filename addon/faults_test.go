@@ -0,0 +1,193 @@
+package addon
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/proxati/mitmproxy/cert"
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+func TestFaults(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "1")
+		w.Write([]byte(`{"items": [1, 2, 3]}`))
+	}))
+	defer backend.Close()
+
+	filename := filepath.Join(t.TempDir(), "faults.json")
+	os.WriteFile(filename, []byte(`[
+		{"name": "unavailable", "paths": ["/status"], "count": 2, "status": 503},
+		{"name": "drop", "paths": ["/drop"], "drop": true},
+		{"name": "truncate", "paths": ["/truncate"], "truncate": 5},
+		{"name": "corrupt", "paths": ["/corrupt"], "corruptJSON": true, "removeHeaders": ["X-Request-Id"]},
+		{"name": "slow", "paths": ["/slow"], "percentage": 50, "delay": "100ms"},
+		{"name": "never", "paths": ["/never"], "percentage": 0, "status": 500}
+	]`), 0o644)
+	faults, err := NewFaultsFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roll := 0.1
+	faults.rand = func() float64 { return roll }
+
+	ca, err := cert.New(&cert.MemoryLoader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := proxy.NewProxy(&proxy.Options{Addr: "127.0.0.1:0", CA: ca})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.AddAddon(faults)
+	if err := p.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	go p.Start()
+	defer p.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: func(r *http.Request) (*url.URL, error) {
+				return url.Parse("http://" + p.Addrs()[0].String())
+			},
+		},
+	}
+	get := func(path string) (*http.Response, []byte, error) {
+		resp, err := client.Get(backend.URL + path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp, body, err
+	}
+
+	// the count of the status fault
+	for i, want := range []int{503, 503, 200} {
+		resp, _, err := get("/status")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Fatalf("request %d: expected status %d, but got %d", i, want, resp.StatusCode)
+		}
+	}
+	if n := faults.Rules()[0].Injected(); n != 2 {
+		t.Fatalf("expected 2 injected faults, but got %d", n)
+	}
+
+	if _, _, err := get("/drop"); err == nil {
+		t.Fatal("expected the connection to be dropped")
+	}
+
+	if _, body, err := get("/truncate"); err == nil || string(body) != `{"ite` {
+		t.Fatalf("expected a truncated body, but got %q %v", body, err)
+	}
+
+	resp, body, err := get("/corrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if json.Valid(body) || resp.Header.Get("X-Request-Id") != "" {
+		t.Fatalf("expected corrupted json without X-Request-Id, but got %q %v", body, resp.Header)
+	}
+
+	// the percentage of the delay fault
+	start := time.Now()
+	get("/slow")
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Fatalf("expected a delay, but took %v", d)
+	}
+	roll = 0.9
+	start = time.Now()
+	get("/slow")
+	if d := time.Since(start); d >= 100*time.Millisecond {
+		t.Fatalf("expected no delay, but took %v", d)
+	}
+
+	roll = 0
+	if resp, _, err := get("/never"); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("expected no fault with a percentage of 0, but got %v %v", resp, err)
+	}
+
+	percentage := 101.0
+	if _, err := NewFaults([]*FaultRule{{Percentage: &percentage}}); err == nil {
+		t.Fatal("expected an error of the percentage")
+	}
+}
+
+// TestFaultsSpilled injects the faults of the bodies spilled to disk.
+func TestFaultsSpilled(t *testing.T) {
+	body := `{"items": [` + strings.Repeat("1, ", 100) + `1]}`
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer backend.Close()
+
+	faults, err := NewFaults([]*FaultRule{
+		{Name: "truncate", FlowMatch: FlowMatch{Paths: []string{"/truncate"}}, Truncate: 5},
+		{Name: "corrupt", FlowMatch: FlowMatch{Paths: []string{"/corrupt"}}, CorruptJSON: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := cert.New(&cert.MemoryLoader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := proxy.NewProxy(&proxy.Options{
+		Addr:              "127.0.0.1:0",
+		CA:                ca,
+		StreamLargeBodies: 16,
+		SpillLargeBodies:  1024,
+		SpillDir:          t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.AddAddon(faults)
+	if err := p.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	go p.Start()
+	defer p.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: func(r *http.Request) (*url.URL, error) {
+				return url.Parse("http://" + p.Addrs()[0].String())
+			},
+		},
+	}
+	get := func(path string) ([]byte, error) {
+		resp, err := client.Get(backend.URL + path)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	}
+
+	if got, err := get("/truncate"); err == nil || string(got) != `{"ite` {
+		t.Fatalf("expected a truncated body, but got %q %v", got, err)
+	}
+	got, err := get("/corrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body[:len(body)/2] {
+		t.Fatalf("expected the first half of the json, but got %q", got)
+	}
+}
@@ -0,0 +1,23 @@
+package addon
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+// newTestFlow returns a flow of a request as the addons get it, without a client connection or a response.
+func newTestFlow(method, rawURL string, header http.Header, body string) *proxy.Flow {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		panic(err)
+	}
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &proxy.Flow{
+		Request:  &proxy.Request{Method: method, URL: u, Header: header, Body: []byte(body)},
+		Metadata: &proxy.Metadata{},
+	}
+}
@@ -48,6 +48,24 @@ func (a *LogAddon) ServerDisconnected(connCtx *proxy.ConnContext) {
 	)
 }
 
+func (a *LogAddon) PooledServerConnected(serverConn *proxy.ServerConn) {
+	a.logger.Info(
+		"pooled server connect",
+		"serverAddress", serverConn.Address,
+		"serverLocalAddress", serverConn.Conn.LocalAddr(),
+		"serverRemoteAddress", serverConn.Conn.RemoteAddr(),
+	)
+}
+
+func (a *LogAddon) PooledServerDisconnected(serverConn *proxy.ServerConn) {
+	a.logger.Info(
+		"pooled server disconnect",
+		"serverAddress", serverConn.Address,
+		"serverLocalAddress", serverConn.Conn.LocalAddr(),
+		"serverRemoteAddress", serverConn.Conn.RemoteAddr(),
+	)
+}
+
 func (a *LogAddon) Requestheaders(f *proxy.Flow) {
 	start := time.Now()
 	go func() {
@@ -0,0 +1,272 @@
+package addon
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/proxati/mitmproxy/cert"
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+// metricsBuckets are the upper bounds in seconds of the flow duration histogram, those of the Prometheus clients.
+var metricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics counts the flows, bytes and connections of the proxy, and serves them in the Prometheus text format.
+// Add it after the addons which modify bodies to count the bytes as forwarded.
+type Metrics struct {
+	proxy.BaseAddon
+
+	// MaxHosts is the number of distinct host labels, flows to further hosts are labeled "other".
+	MaxHosts int
+
+	proxy  *proxy.Proxy
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	flows     map[flowLabels]int64
+	durations map[string]*histogram // by host
+	bytes     map[bytesLabels]int64
+	hosts     map[string]struct{}
+
+	inflight sync.Map // *proxy.Flow -> *flowBytes
+}
+
+type flowLabels struct {
+	code, host, method string
+}
+
+type bytesLabels struct {
+	direction, host string
+}
+
+type histogram struct {
+	counts []int64 // per bucket, not cumulative, the last one is +Inf
+	sum    float64
+	count  int64
+}
+
+// flowBytes are the body bytes of a flow read by the StreamRequestModifier and StreamResponseModifier events.
+type flowBytes struct {
+	request, response *countReader
+}
+
+type countReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func NewMetrics(p *proxy.Proxy) *Metrics {
+	return &Metrics{
+		MaxHosts:  1000,
+		proxy:     p,
+		logger:    sLogger.With("addonName", "Metrics"),
+		flows:     make(map[flowLabels]int64),
+		durations: make(map[string]*histogram),
+		bytes:     make(map[bytesLabels]int64),
+		hosts:     make(map[string]struct{}),
+	}
+}
+
+func (m *Metrics) Requestheaders(f *proxy.Flow) {
+	start := time.Now()
+	fb := &flowBytes{}
+	m.inflight.Store(f, fb)
+	go func() {
+		<-f.Done()
+		m.inflight.Delete(f)
+		m.observe(f, fb, time.Since(start))
+	}()
+}
+
+func (m *Metrics) StreamRequestModifier(f *proxy.Flow, in io.Reader) io.Reader {
+	fb, ok := m.inflight.Load(f)
+	if !ok || in == nil {
+		return in
+	}
+	c := &countReader{r: in}
+	fb.(*flowBytes).request = c
+	return c
+}
+
+func (m *Metrics) StreamResponseModifier(f *proxy.Flow, in io.Reader) io.Reader {
+	fb, ok := m.inflight.Load(f)
+	if !ok || in == nil {
+		return in
+	}
+	c := &countReader{r: in}
+	fb.(*flowBytes).response = c
+	return c
+}
+
+func (m *Metrics) observe(f *proxy.Flow, fb *flowBytes, d time.Duration) {
+	code := "error"
+	if f.Response != nil && f.Response.StatusCode > 0 {
+		code = fmt.Sprintf("%dxx", f.Response.StatusCode/100)
+	}
+	reqBytes := int64(len(f.Request.Body))
+	if fb.request != nil {
+		reqBytes = fb.request.n.Load()
+	}
+	var resBytes int64
+	if fb.response != nil {
+		resBytes = fb.response.n.Load()
+	} else if f.Response != nil {
+		resBytes = int64(len(f.Response.Body))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	host := m.hostLabel(f.Request.URL.Hostname())
+	m.flows[flowLabels{code: code, host: host, method: f.Request.Method}]++
+	m.bytes[bytesLabels{direction: "request", host: host}] += reqBytes
+	m.bytes[bytesLabels{direction: "response", host: host}] += resBytes
+
+	h, ok := m.durations[host]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(metricsBuckets)+1)}
+		m.durations[host] = h
+	}
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(metricsBuckets, seconds)
+	h.counts[i]++
+	h.sum += seconds
+	h.count++
+}
+
+// hostLabel bounds the distinct host labels to MaxHosts.
+func (m *Metrics) hostLabel(host string) string {
+	if _, ok := m.hosts[host]; ok {
+		return host
+	}
+	if len(m.hosts) >= m.MaxHosts {
+		return "other"
+	}
+	m.hosts[host] = struct{}{}
+	return host
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.WriteText(w); err != nil {
+		m.logger.Debug("could not write metrics", "error", err)
+	}
+}
+
+// ListenAndServe serves the metrics on addr at /metrics.
+func (m *Metrics) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	m.logger.Info("metrics endpoint start", "listen", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// WriteText writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteText(w io.Writer) error {
+	var b strings.Builder
+	m.writeFlows(&b)
+
+	stats := m.proxy.Stats()
+	writeMetric(&b, "mitmproxy_active_client_connections", "gauge", "Open client connections, CONNECT tunnels included.", stats.ActiveConns)
+	writeMetric(&b, "mitmproxy_active_server_connections", "gauge", "Open server connections, pooled ones included.", stats.ActiveServerConns)
+	writeMetric(&b, "mitmproxy_active_tunnels", "gauge", "Open CONNECT tunnels.", stats.ActiveTunnels)
+	writeMetric(&b, "mitmproxy_active_flows", "gauge", "Flows in progress.", stats.ActiveFlows)
+	b.WriteString("# HELP mitmproxy_tls_handshake_failures_total Failed TLS handshakes with clients and servers.\n")
+	b.WriteString("# TYPE mitmproxy_tls_handshake_failures_total counter\n")
+	fmt.Fprintf(&b, "mitmproxy_tls_handshake_failures_total{side=\"client\"} %d\n", stats.ClientTLSFailures)
+	fmt.Fprintf(&b, "mitmproxy_tls_handshake_failures_total{side=\"server\"} %d\n", stats.ServerTLSFailures)
+	writeMetric(&b, "mitmproxy_addon_panics_total", "counter", "Panics of addons recovered while handling a flow.", stats.AddonPanics)
+
+	if ca, ok := m.proxy.Opts.CA.(interface{ Stats() cert.Stats }); ok {
+		certStats := ca.Stats()
+		writeMetric(&b, "mitmproxy_cert_generated_total", "counter", "Certificates generated.", certStats.Generated)
+		writeMetric(&b, "mitmproxy_cert_cache_hits_total", "counter", "Certificates found in the cache.", certStats.CacheHits)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (m *Metrics) writeFlows(b *strings.Builder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b.WriteString("# HELP mitmproxy_flows_total Finished flows by status class, host and method.\n")
+	b.WriteString("# TYPE mitmproxy_flows_total counter\n")
+	flows := make([]flowLabels, 0, len(m.flows))
+	for l := range m.flows {
+		flows = append(flows, l)
+	}
+	sort.Slice(flows, func(i, j int) bool {
+		a, b := flows[i], flows[j]
+		if a.host != b.host {
+			return a.host < b.host
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	for _, l := range flows {
+		fmt.Fprintf(b, "mitmproxy_flows_total{code=%q,host=%s,method=%s} %d\n", l.code, quoteLabel(l.host), quoteLabel(l.method), m.flows[l])
+	}
+
+	b.WriteString("# HELP mitmproxy_flow_duration_seconds Duration of finished flows by host, from the request headers to the end of the response.\n")
+	b.WriteString("# TYPE mitmproxy_flow_duration_seconds histogram\n")
+	hosts := make([]string, 0, len(m.durations))
+	for host := range m.durations {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		h := m.durations[host]
+		var cumulative int64
+		for i, le := range metricsBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(b, "mitmproxy_flow_duration_seconds_bucket{host=%s,le=\"%g\"} %d\n", quoteLabel(host), le, cumulative)
+		}
+		fmt.Fprintf(b, "mitmproxy_flow_duration_seconds_bucket{host=%s,le=\"+Inf\"} %d\n", quoteLabel(host), h.count)
+		fmt.Fprintf(b, "mitmproxy_flow_duration_seconds_sum{host=%s} %g\n", quoteLabel(host), h.sum)
+		fmt.Fprintf(b, "mitmproxy_flow_duration_seconds_count{host=%s} %d\n", quoteLabel(host), h.count)
+	}
+
+	b.WriteString("# HELP mitmproxy_body_bytes_total Body bytes of finished flows by direction and host.\n")
+	b.WriteString("# TYPE mitmproxy_body_bytes_total counter\n")
+	bytes := make([]bytesLabels, 0, len(m.bytes))
+	for l := range m.bytes {
+		bytes = append(bytes, l)
+	}
+	sort.Slice(bytes, func(i, j int) bool {
+		if bytes[i].host != bytes[j].host {
+			return bytes[i].host < bytes[j].host
+		}
+		return bytes[i].direction < bytes[j].direction
+	})
+	for _, l := range bytes {
+		fmt.Fprintf(b, "mitmproxy_body_bytes_total{direction=%q,host=%s} %d\n", l.direction, quoteLabel(l.host), m.bytes[l])
+	}
+}
+
+func writeMetric(b *strings.Builder, name, typ, help string, value int64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, typ, name, value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quoteLabel quotes a label value as the Prometheus text format, which differs from Go quoting.
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
@@ -0,0 +1,149 @@
+package addon
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/proxati/mitmproxy/cert"
+	"github.com/proxati/mitmproxy/proxy"
+	"github.com/proxati/mitmproxy/web"
+)
+
+func TestMetrics(t *testing.T) {
+	ca, err := cert.New(&cert.MemoryLoader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := proxy.NewProxy(&proxy.Options{CA: ca})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMetrics(p)
+	m.MaxHosts = 1
+
+	newFlow := func(rawURL string, status int, body string) *proxy.Flow {
+		f := newTestFlow("GET", rawURL, nil, "req")
+		if status > 0 {
+			f.Response = &proxy.Response{StatusCode: status, Body: []byte(body)}
+		}
+		return f
+	}
+
+	// streamed response bodies are counted as read
+	streamed := &flowBytes{response: &countReader{r: strings.NewReader("streamed body")}}
+	io.Copy(io.Discard, streamed.response)
+
+	m.observe(newFlow("http://example.com/", 200, "ok"), &flowBytes{}, 20*time.Millisecond)
+	m.observe(newFlow("http://example.com/stream", 200, ""), streamed, 2*time.Second)
+	m.observe(newFlow("http://example.com/missing", 404, "not found"), &flowBytes{}, time.Millisecond)
+	m.observe(newFlow("http://other.test/", 0, ""), &flowBytes{}, time.Millisecond)
+
+	var b strings.Builder
+	if err := m.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, line := range []string{
+		`mitmproxy_flows_total{code="2xx",host="example.com",method="GET"} 2`,
+		`mitmproxy_flows_total{code="4xx",host="example.com",method="GET"} 1`,
+		`mitmproxy_flows_total{code="error",host="other",method="GET"} 1`,
+		`mitmproxy_flow_duration_seconds_bucket{host="example.com",le="0.025"} 2`,
+		`mitmproxy_flow_duration_seconds_bucket{host="example.com",le="2.5"} 3`,
+		`mitmproxy_flow_duration_seconds_count{host="example.com"} 3`,
+		`mitmproxy_body_bytes_total{direction="request",host="example.com"} 9`,
+		`mitmproxy_body_bytes_total{direction="response",host="example.com"} 24`,
+		`mitmproxy_active_flows 0`,
+		`mitmproxy_cert_generated_total 0`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("expected %s in\n%s", line, out)
+		}
+	}
+
+	if q := quoteLabel("a\"b\\c\nd"); q != `"a\"b\\c\nd"` {
+		t.Fatalf("unexpected quoted label %s", q)
+	}
+}
+
+// TestMetricsProxy sends flows through a proxy, with the metrics served on the web interface as -metrics_addr web.
+func TestMetricsProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	ca, err := cert.New(&cert.MemoryLoader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := proxy.NewProxy(&proxy.Options{Addr: "127.0.0.1:0", CA: ca, StreamLargeBodies: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	m := NewMetrics(p)
+	p.AddAddon(m)
+	go p.Start()
+	defer p.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	webAddr := ln.Addr().String()
+	ln.Close()
+	web.NewWebAddon(webAddr).Handle("/metrics", m)
+
+	proxyURL, _ := url.Parse("http://" + p.Addrs()[0].String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	for _, body := range []string{"ping", "a body streamed for its size"} {
+		res, err := client.Post(server.URL, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+
+	host, _, _ := net.SplitHostPort(server.Listener.Addr().String())
+	want := []string{
+		`mitmproxy_flows_total{code="2xx",host="` + host + `",method="POST"} 2`,
+		`mitmproxy_body_bytes_total{direction="request",host="` + host + `"} 32`,
+		`mitmproxy_body_bytes_total{direction="response",host="` + host + `"} 10`,
+		`mitmproxy_flow_duration_seconds_count{host="` + host + `"} 2`,
+		`mitmproxy_active_flows 0`,
+	}
+	// the flows are observed when they are done, after the responses
+	var out string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		res, err := http.Get("http://" + webAddr + "/metrics")
+		if err != nil {
+			continue
+		}
+		data, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		out = string(data)
+		if containsLines(out, want) {
+			return
+		}
+	}
+	t.Fatalf("expected %v in\n%s", want, out)
+}
+
+func containsLines(out string, lines []string) bool {
+	for _, line := range lines {
+		if !strings.Contains(out, line+"\n") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,203 @@
+package addon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+// ReplayOptions are the keys which match requests to recorded flows, and what to do with the matches.
+// The method and path always match.
+type ReplayOptions struct {
+	IgnoreScheme bool     // match http and https requests alike
+	IgnoreHost   bool     // match requests to any host
+	IgnoreParams []string // query params which may differ, all of them if it contains "*"
+	Headers      []string // request headers which must match too
+	IgnoreBody   bool     // match requests with any body, the sha256 of the bodies must match otherwise
+
+	Reuse         bool // replay the recorded responses of a key over and over, in order, instead of once
+	KillUnmatched bool // kill the requests without a recorded response, instead of passing them to the server
+}
+
+// ServerReplay replies the recorded responses to the matching requests without contacting the servers,
+// e.g. for hermetic integration tests. The responses of flows recorded with the same key are replayed in order,
+// and with Reuse start over from the first one after the last.
+// The requests streamed for their size, see Options.StreamLargeBodies, are passed to the servers.
+type ServerReplay struct {
+	proxy.BaseAddon
+	opts   ReplayOptions
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	entries map[string]*replayEntries // by key
+}
+
+type replayEntries struct {
+	responses []*proxy.Response
+	played    int // number of responses replayed, the next one is played % len(responses)
+}
+
+func NewServerReplay(flows []*proxy.Flow, opts ReplayOptions) (*ServerReplay, error) {
+	s := &ServerReplay{
+		opts:    opts,
+		logger:  sLogger.With("addonName", "ServerReplay"),
+		entries: make(map[string]*replayEntries),
+	}
+	for i, f := range flows {
+		if f.Request == nil || f.Request.URL == nil || f.Response == nil {
+			return nil, fmt.Errorf("replay flow %d: no request or response", i)
+		}
+		key, err := s.key(f.Request)
+		if err != nil {
+			return nil, fmt.Errorf("replay flow %d: %w", i, err)
+		}
+		if s.entries[key] == nil {
+			s.entries[key] = &replayEntries{}
+		}
+		s.entries[key].responses = append(s.entries[key].responses, f.Response)
+	}
+	return s, nil
+}
+
+// NewServerReplayFromFile loads the flows saved by FlowSaver.
+func NewServerReplayFromFile(filename string, opts ReplayOptions) (*ServerReplay, error) {
+	flows, err := LoadSavedFlows(filename)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewServerReplay(flows, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("replay flows loaded", "filename", filename, "flows", len(flows))
+	return s, nil
+}
+
+// NewServerReplayFromDir loads the flows of the .map.txt files of the directory, in the order of their names.
+func NewServerReplayFromDir(dirName string, opts ReplayOptions) (*ServerReplay, error) {
+	filenames, err := filepath.Glob(filepath.Join(dirName, "*.map.txt"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(filenames)
+	flows := make([]*proxy.Flow, 0, len(filenames))
+	for _, filename := range filenames {
+		f, err := parseFlowFromFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("replay flow %s: %w", filename, err)
+		}
+		flows = append(flows, f)
+	}
+	s, err := NewServerReplay(flows, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("replay flows loaded", "dirName", dirName, "flows", len(flows))
+	return s, nil
+}
+
+// Remaining returns the number of recorded responses which were not replayed yet.
+func (s *ServerReplay) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, entries := range s.entries {
+		n += max(len(entries.responses)-entries.played, 0)
+	}
+	return n
+}
+
+// key returns the match key of the request according to the options.
+func (s *ServerReplay) key(req *proxy.Request) (string, error) {
+	u := req.URL
+	parts := []string{strings.ToUpper(req.Method)}
+
+	if !s.opts.IgnoreScheme {
+		parts = append(parts, u.Scheme)
+	}
+	if !s.opts.IgnoreHost {
+		host := strings.ToLower(u.Hostname())
+		if port := u.Port(); port != "" && !(port == "80" && u.Scheme == "http") && !(port == "443" && u.Scheme == "https") {
+			host += ":" + port
+		}
+		parts = append(parts, host)
+	}
+	parts = append(parts, u.EscapedPath())
+
+	if !slices.Contains(s.opts.IgnoreParams, "*") {
+		query := u.Query()
+		for _, param := range s.opts.IgnoreParams {
+			query.Del(param)
+		}
+		parts = append(parts, query.Encode())
+	}
+
+	for _, name := range s.opts.Headers {
+		parts = append(parts, http.CanonicalHeaderKey(name)+": "+strings.Join(req.Header.Values(name), ","))
+	}
+
+	if !s.opts.IgnoreBody {
+		h := sha256.New()
+		if _, err := io.Copy(h, req.OpenBody()); err != nil {
+			return "", err
+		}
+		parts = append(parts, hex.EncodeToString(h.Sum(nil)))
+	}
+	return strings.Join(parts, "\x00"), nil
+}
+
+// next returns the response to replay to the key, nil if none.
+func (s *ServerReplay) next(key string) *proxy.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := s.entries[key]
+	if entries == nil || (!s.opts.Reuse && entries.played >= len(entries.responses)) {
+		return nil
+	}
+	response := entries.responses[entries.played%len(entries.responses)]
+	entries.played++
+	return response
+}
+
+func (s *ServerReplay) Request(f *proxy.Flow) {
+	logger := s.logger.With("method", f.Request.Method, "url", f.Request.URL.String())
+	key, err := s.key(f.Request)
+	if err != nil {
+		logger.Error("could not read request body", "error", err)
+		return
+	}
+
+	recorded := s.next(key)
+	if recorded == nil {
+		if s.opts.KillUnmatched {
+			logger.Info("killing unmatched request")
+			f.Kill()
+		} else {
+			logger.Debug("passing unmatched request to the server")
+		}
+		return
+	}
+
+	// a copy, addons may modify the response of the flow
+	f.Response = &proxy.Response{
+		StatusCode: recorded.StatusCode,
+		Header:     recorded.Header.Clone(),
+		Body:       bytes.Clone(recorded.Body),
+		Trailer:    recorded.Trailer.Clone(),
+	}
+	if f.Response.Header == nil {
+		f.Response.Header = make(http.Header)
+	}
+	logger.Debug("replaying response", "statusCode", recorded.StatusCode)
+}
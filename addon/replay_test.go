@@ -0,0 +1,155 @@
+package addon
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/proxati/mitmproxy/cert"
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+func TestServerReplayKeys(t *testing.T) {
+	s, err := NewServerReplay(nil, ReplayOptions{IgnoreParams: []string{"ts"}, Headers: []string{"authorization"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := func(f *proxy.Flow) string {
+		k, err := s.key(f.Request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	auth := http.Header{"Authorization": {"Bearer a"}}
+	base := key(newTestFlow("GET", "https://Example.com:443/a?x=1&y=2", auth, ""))
+
+	same := []*proxy.Flow{
+		newTestFlow("get", "https://example.com/a?y=2&x=1&ts=123", auth, ""),
+	}
+	for _, f := range same {
+		if key(f) != base {
+			t.Fatalf("expected %s to match", f.Request.URL)
+		}
+	}
+	different := []*proxy.Flow{
+		newTestFlow("GET", "http://example.com/a?x=1&y=2", auth, ""),
+		newTestFlow("GET", "https://example.com:8443/a?x=1&y=2", auth, ""),
+		newTestFlow("GET", "https://example.com/a?x=1", auth, ""),
+		newTestFlow("GET", "https://example.com/a?x=1&y=2", http.Header{"Authorization": {"Bearer b"}}, ""),
+		newTestFlow("GET", "https://example.com/a?x=1&y=2", auth, "body"),
+		newTestFlow("POST", "https://example.com/a?x=1&y=2", auth, ""),
+	}
+	for _, f := range different {
+		if key(f) == base {
+			t.Fatalf("expected %s %s %v %q not to match", f.Request.Method, f.Request.URL, f.Request.Header, f.Request.Body)
+		}
+	}
+
+	loose, _ := NewServerReplay(nil, ReplayOptions{IgnoreScheme: true, IgnoreHost: true, IgnoreParams: []string{"*"}, IgnoreBody: true})
+	k1, _ := loose.key(newTestFlow("POST", "http://a.test/p?x=1", nil, "1").Request)
+	k2, _ := loose.key(newTestFlow("POST", "https://b.test/p?y=2", nil, "2").Request)
+	if k1 != k2 {
+		t.Fatal("expected the ignored keys not to match")
+	}
+}
+
+func TestServerReplay(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("live"))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "1.map.txt"), []byte("GET "+backend.URL+"/items\n\nHTTP/1.1 200\nContent-Type: text/plain\n\nfirst\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "2.map.txt"), []byte("GET "+backend.URL+"/items\n\nHTTP/1.1 200\nContent-Type: text/plain\n\nsecond\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "3.map.txt"), []byte("POST "+backend.URL+"/items\n\n{\"name\": \"a\"}\n\nHTTP/1.1 201\n\ncreated\n"), 0o644)
+
+	newProxy := func(s *ServerReplay) *http.Client {
+		ca, err := cert.New(&cert.MemoryLoader{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := proxy.NewProxy(&proxy.Options{Addr: "127.0.0.1:0", CA: ca})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.AddAddon(s)
+		if err := p.Listen(); err != nil {
+			t.Fatal(err)
+		}
+		go p.Start()
+		t.Cleanup(func() { p.Close() })
+		return &http.Client{
+			Transport: &http.Transport{
+				Proxy: func(r *http.Request) (*url.URL, error) {
+					return url.Parse("http://" + p.Addrs()[0].String())
+				},
+			},
+		}
+	}
+	send := func(client *http.Client, method, path, body string) (int, string, error) {
+		req, _ := http.NewRequest(method, backend.URL+path, strings.NewReader(body))
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b), err
+	}
+
+	// matches are consumed in order, then the requests pass to the server
+	s, err := NewServerReplayFromDir(dir, ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newProxy(s)
+	for _, want := range []string{"first", "second", "live"} {
+		if _, body, err := send(client, "GET", "/items", ""); err != nil || body != want {
+			t.Fatalf("expected %s, but got %s %v", want, body, err)
+		}
+	}
+	if code, body, _ := send(client, "POST", "/items", `{"name": "b"}`); body != "live" {
+		t.Fatalf("expected the other body to pass, but got %d %s", code, body)
+	}
+	if code, body, _ := send(client, "POST", "/items", `{"name": "a"}`); code != 201 || body != "created" {
+		t.Fatalf("expected the recorded POST, but got %d %s", code, body)
+	}
+	if hits.Load() != 2 || s.Remaining() != 0 {
+		t.Fatalf("expected 2 requests to the server and no remaining flows, but got %d and %d", hits.Load(), s.Remaining())
+	}
+
+	// matches are reused in order, unmatched requests are killed
+	hits.Store(0)
+	var recorded []*proxy.Flow
+	for _, body := range []string{"first", "second"} {
+		f := newTestFlow("GET", backend.URL+"/items", nil, "")
+		f.Response = &proxy.Response{StatusCode: 200, Header: make(http.Header), Body: []byte(body)}
+		recorded = append(recorded, f)
+	}
+	s, err = NewServerReplay(recorded, ReplayOptions{Reuse: true, KillUnmatched: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = newProxy(s)
+	for _, want := range []string{"first", "second", "first"} {
+		if _, body, err := send(client, "GET", "/items", ""); err != nil || body != want {
+			t.Fatalf("expected %s, but got %s %v", want, body, err)
+		}
+	}
+	if _, _, err := send(client, "GET", "/other", ""); err == nil {
+		t.Fatal("expected the unmatched request to be killed")
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("expected no request to the server, but got %d", hits.Load())
+	}
+}
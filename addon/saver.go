@@ -0,0 +1,161 @@
+package addon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+// savedFlow is a flow with its bodies, a line of the files of FlowSaver.
+// The fields are named like those of the JSON of proxy.Flow.
+type savedFlow struct {
+	Request  savedRequest  `json:"request"`
+	Response savedResponse `json:"response"`
+}
+
+type savedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Proto  string      `json:"proto"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+type savedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	Trailer    http.Header `json:"trailer,omitempty"`
+}
+
+// FlowSaver writes the completed flows with their bodies as JSON lines, which ServerReplay loads.
+// The flows without a response, streamed flows, websockets and event streams are not saved,
+// and the bodies are saved as they were sent, e.g. still gzipped.
+type FlowSaver struct {
+	proxy.BaseAddon
+	out    io.Writer
+	mu     sync.Mutex // guards out
+	logger *slog.Logger
+}
+
+func NewFlowSaver(out io.Writer) *FlowSaver {
+	return &FlowSaver{
+		out:    out,
+		logger: sLogger.With("addonName", "FlowSaver"),
+	}
+}
+
+// NewFlowSaverWithFilename appends the flows to the file.
+func NewFlowSaverWithFilename(filename string) (*FlowSaver, error) {
+	out, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return NewFlowSaver(out), nil
+}
+
+func (s *FlowSaver) Requestheaders(f *proxy.Flow) {
+	release := f.RetainBodies()
+	go func() {
+		<-f.Done()
+		s.save(f)
+		release()
+	}()
+}
+
+// save is called when <-f.Done()
+func (s *FlowSaver) save(f *proxy.Flow) {
+	if f.Request == nil || f.Request.URL == nil || f.Response == nil || f.Stream || f.WebSocket != nil || f.EventStream != nil {
+		return
+	}
+	logger := s.logger.With("ID", f.Id.String(), "URL", f.Request.URL.String())
+
+	reqBody, err := io.ReadAll(f.Request.OpenBody())
+	if err != nil {
+		logger.Error("could not read request body", "error", err)
+		return
+	}
+	respBody, err := io.ReadAll(f.Response.OpenBody())
+	if err != nil {
+		logger.Error("could not read response body", "error", err)
+		return
+	}
+	data, err := json.Marshal(&savedFlow{
+		Request: savedRequest{
+			Method: f.Request.Method,
+			URL:    f.Request.URL.String(),
+			Proto:  f.Request.Proto,
+			Header: f.Request.Header,
+			Body:   reqBody,
+		},
+		Response: savedResponse{
+			StatusCode: f.Response.StatusCode,
+			Header:     f.Response.Header,
+			Body:       respBody,
+			Trailer:    f.Response.Trailer,
+		},
+	})
+	if err != nil {
+		logger.Error("could not marshal flow", "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.out.Write(append(data, '\n')); err != nil {
+		logger.Error("could not write flow", "error", err)
+	}
+}
+
+// LoadSavedFlows reads the flows written by FlowSaver, in order.
+func LoadSavedFlows(filename string) ([]*proxy.Flow, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var flows []*proxy.Flow
+	dec := json.NewDecoder(file)
+	for {
+		var saved savedFlow
+		if err := dec.Decode(&saved); errors.Is(err, io.EOF) {
+			return flows, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("saved flow %d: %w", len(flows), err)
+		}
+		u, err := url.Parse(saved.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("saved flow %d: %w", len(flows), err)
+		}
+		if saved.Request.Header == nil {
+			saved.Request.Header = make(http.Header)
+		}
+		if saved.Response.Header == nil {
+			saved.Response.Header = make(http.Header)
+		}
+		flows = append(flows, &proxy.Flow{
+			Request: &proxy.Request{
+				Method: saved.Request.Method,
+				URL:    u,
+				Proto:  saved.Request.Proto,
+				Header: saved.Request.Header,
+				Body:   saved.Request.Body,
+			},
+			Response: &proxy.Response{
+				StatusCode: saved.Response.StatusCode,
+				Header:     saved.Response.Header,
+				Body:       saved.Response.Body,
+				Trailer:    saved.Response.Trailer,
+			},
+		})
+	}
+}
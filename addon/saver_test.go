@@ -0,0 +1,58 @@
+package addon
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+func TestFlowSaver(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "flows.jsonl")
+	saver, err := NewFlowSaverWithFilename(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := newTestFlow("POST", "https://example.com/items?x=1", http.Header{"Content-Type": {"application/json"}}, `{"name": "a"}`)
+	post.Response = &proxy.Response{StatusCode: 201, Header: http.Header{"Content-Encoding": {"gzip"}}, Body: []byte{0x1f, 0x8b}}
+	streamed := newTestFlow("GET", "https://example.com/large", nil, "")
+	streamed.Response = &proxy.Response{StatusCode: 200, Header: make(http.Header)}
+	streamed.Stream = true
+	for _, f := range []*proxy.Flow{post, streamed, newTestFlow("GET", "https://example.com/killed", nil, "")} {
+		saver.save(f)
+	}
+
+	flows, err := LoadSavedFlows(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 1 {
+		t.Fatalf("expected the flow with a buffered response saved, but got %d flows", len(flows))
+	}
+	req, resp := flows[0].Request, flows[0].Response
+	if req.Method != "POST" || req.URL.String() != "https://example.com/items?x=1" || req.Header.Get("Content-Type") != "application/json" || string(req.Body) != `{"name": "a"}` {
+		t.Fatalf("unexpected request %s %s %v %q", req.Method, req.URL, req.Header, req.Body)
+	}
+	if resp.StatusCode != 201 || resp.Header.Get("Content-Encoding") != "gzip" || !bytes.Equal(resp.Body, []byte{0x1f, 0x8b}) {
+		t.Fatalf("unexpected response %d %v %q", resp.StatusCode, resp.Header, resp.Body)
+	}
+
+	s, err := NewServerReplayFromFile(filename, ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newTestFlow("POST", "https://example.com/items?x=1", nil, `{"name": "a"}`)
+	s.Request(f)
+	if f.Response == nil || f.Response.StatusCode != 201 || s.Remaining() != 0 {
+		t.Fatal("expected the saved response replayed")
+	}
+
+	os.WriteFile(filename, []byte("{\"request\": "), 0o644)
+	if _, err := LoadSavedFlows(filename); err == nil {
+		t.Fatal("expected an error of the truncated file")
+	}
+}
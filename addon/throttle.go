@@ -0,0 +1,234 @@
+package addon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/groupcache/lru"
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+// ThrottleRule limits the requests and bytes per second of the flows it matches, zero limits are unlimited.
+type ThrottleRule struct {
+	Clients []string `json:"clients"` // client CIDRs or IPs, all clients if empty
+	Hosts   []string `json:"hosts"`   // hosts, "*.example.com" for the subdomains of example.com, all hosts if empty
+
+	// Per is "client", "host" or "flow" for limits of each client IP, host or flow,
+	// the limits are shared by all the matching flows if empty.
+	Per string `json:"per"`
+
+	RequestsPerSecond      float64 `json:"requestsPerSecond"`
+	UploadBytesPerSecond   float64 `json:"uploadBytesPerSecond"`   // from the client
+	DownloadBytesPerSecond float64 `json:"downloadBytesPerSecond"` // to the client
+
+	// Reject replies 429 Too Many Requests to the requests over RequestsPerSecond instead of delaying them.
+	Reject bool `json:"reject"`
+}
+
+// Throttle applies rate limits and bandwidth throttling of ThrottleRules to the flows.
+//
+// Byte limits of rules without hosts apply to whole client connections, tunnels included. Those of rules with hosts
+// apply to the bodies and websocket messages of the matching flows, and to the TCP flows of tunnels to the hosts.
+type Throttle struct {
+	proxy.BaseAddon
+	rules  []*throttleRule
+	logger *slog.Logger
+}
+
+type throttleRule struct {
+	ThrottleRule
+	clients []*net.IPNet
+
+	mu      sync.Mutex
+	buckets *lru.Cache // *throttleBuckets by client IP, host, or "" if shared
+}
+
+// maxThrottleBuckets bounds the buckets of a rule, the evicted clients and hosts get fresh ones.
+const maxThrottleBuckets = 10000
+
+type throttleBuckets struct {
+	requests, upload, download *proxy.RateLimiter
+}
+
+func NewThrottle(rules []ThrottleRule) (*Throttle, error) {
+	t := &Throttle{logger: sLogger.With("addonName", "Throttle")}
+	for i := range rules {
+		r := &throttleRule{ThrottleRule: rules[i], buckets: lru.New(maxThrottleBuckets)}
+		switch r.Per {
+		case "", "client", "host", "flow":
+		default:
+			return nil, fmt.Errorf("throttle rule %d: invalid per %q", i, r.Per)
+		}
+		for _, cidr := range r.Clients {
+			ipNet, err := proxy.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("throttle rule %d: client %q: %w", i, cidr, err)
+			}
+			r.clients = append(r.clients, ipNet)
+		}
+		for j, host := range r.Hosts {
+			r.Hosts[j] = strings.ToLower(host)
+		}
+		t.rules = append(t.rules, r)
+	}
+	return t, nil
+}
+
+// NewThrottleFromFile reads the rules from a JSON array of ThrottleRule.
+func NewThrottleFromFile(filename string) (*Throttle, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rules []ThrottleRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("throttle rules %s: %w", filename, err)
+	}
+	return NewThrottle(rules)
+}
+
+// clientIP is the IP of a client, nil for clients of unix sockets.
+func clientIP(client *proxy.ClientConn) net.IP {
+	if client == nil || client.Conn == nil {
+		return nil
+	}
+	if addr, ok := client.Conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
+
+// match reports whether the rule matches a client ip and host, host is ignored if empty.
+func (r *throttleRule) match(ip net.IP, host string) bool {
+	if len(r.clients) > 0 {
+		found := false
+		for _, ipNet := range r.clients {
+			if ip != nil && ipNet.Contains(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.Hosts) == 0 || host == "" {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range r.Hosts {
+		if proxy.MatchHost(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// connLevel reports whether the byte limits of the rule apply to whole client connections.
+func (r *throttleRule) connLevel() bool {
+	return len(r.Hosts) == 0 && (r.Per == "" || r.Per == "client")
+}
+
+// bucketsFor returns the limiters of the client ip and host.
+func (r *throttleRule) bucketsFor(ip net.IP, host string) *throttleBuckets {
+	key := ""
+	switch r.Per {
+	case "flow":
+		return r.newBuckets()
+	case "client":
+		key = ip.String()
+	case "host":
+		key = host
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, ok := r.buckets.Get(key); ok {
+		return b.(*throttleBuckets)
+	}
+	b := r.newBuckets()
+	r.buckets.Add(key, b)
+	return b
+}
+
+func (r *throttleRule) newBuckets() *throttleBuckets {
+	b := &throttleBuckets{}
+	if r.RequestsPerSecond > 0 {
+		b.requests = proxy.NewRateLimiter(r.RequestsPerSecond, 0)
+	}
+	if r.UploadBytesPerSecond > 0 {
+		b.upload = proxy.NewRateLimiter(r.UploadBytesPerSecond, 0)
+	}
+	if r.DownloadBytesPerSecond > 0 {
+		b.download = proxy.NewRateLimiter(r.DownloadBytesPerSecond, 0)
+	}
+	return b
+}
+
+func (r *throttleRule) hasBytes() bool {
+	return r.UploadBytesPerSecond > 0 || r.DownloadBytesPerSecond > 0
+}
+
+func (t *Throttle) ClientConnected(client *proxy.ClientConn) {
+	ip := clientIP(client)
+	for _, r := range t.rules {
+		if r.connLevel() && r.hasBytes() && r.match(ip, "") {
+			b := r.bucketsFor(ip, "")
+			client.AddThrottle(b.upload, b.download)
+		}
+	}
+}
+
+func (t *Throttle) Requestheaders(f *proxy.Flow) {
+	ip := clientIP(f.ConnContext.ClientConn)
+	host := strings.ToLower(f.Request.URL.Hostname())
+	for _, r := range t.rules {
+		if !r.match(ip, host) {
+			continue
+		}
+		b := r.bucketsFor(ip, host)
+		if !r.connLevel() {
+			f.AddThrottle(b.upload, b.download)
+		}
+		if b.requests == nil {
+			continue
+		}
+		if r.Reject {
+			if !b.requests.Allow() {
+				t.logger.Debug("rate limited", "client", ip, "host", host)
+				f.Response = &proxy.Response{
+					StatusCode: http.StatusTooManyRequests,
+					Header: http.Header{
+						"Content-Type": {"text/plain; charset=utf-8"},
+						"Retry-After":  {strconv.Itoa(max(int(1/r.RequestsPerSecond), 1))},
+					},
+					Body: []byte("Too many requests\n"),
+				}
+				return
+			}
+		} else if err := b.requests.Wait(requestContext(f), 1); err != nil {
+			return
+		}
+	}
+}
+
+func (t *Throttle) TcpStart(f *proxy.TCPFlow) {
+	ip := clientIP(f.ConnContext.ClientConn)
+	host, _, err := net.SplitHostPort(f.Host)
+	if err != nil {
+		host = f.Host
+	}
+	host = strings.ToLower(host)
+	for _, r := range t.rules {
+		if !r.connLevel() && r.hasBytes() && r.match(ip, host) {
+			b := r.bucketsFor(ip, host)
+			f.ConnContext.ClientConn.AddThrottle(b.upload, b.download)
+		}
+	}
+}
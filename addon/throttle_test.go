@@ -0,0 +1,84 @@
+package addon
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+func TestThrottle(t *testing.T) {
+	th, err := NewThrottle([]ThrottleRule{
+		{Clients: []string{"10.0.0.0/8"}, Per: "client", RequestsPerSecond: 1, Reject: true},
+		{Hosts: []string{"*.example.com"}, Per: "host", DownloadBytesPerSecond: 1000},
+		{Hosts: []string{"api.test"}, Per: "flow", UploadBytesPerSecond: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newFlow := func(rawURL string) *proxy.Flow {
+		f := newTestFlow("GET", rawURL, nil, "")
+		f.ConnContext = &proxy.ConnContext{} // the client IP is looked up in the connection
+		return f
+	}
+
+	f := newFlow("http://www.example.com/")
+	th.Requestheaders(f)
+	if tf := f.Throttle(); tf == nil || len(tf.Download) != 1 || len(tf.Upload) != 0 {
+		t.Fatalf("expected a download limit, but got %+v", tf)
+	}
+	other := newFlow("http://img.example.com/")
+	th.Requestheaders(other)
+	if other.Throttle().Download[0] == f.Throttle().Download[0] {
+		t.Fatal("expected a limiter per host")
+	}
+	same := newFlow("http://www.example.com/other")
+	th.Requestheaders(same)
+	if same.Throttle().Download[0] != f.Throttle().Download[0] {
+		t.Fatal("expected the limiter of the host to be shared")
+	}
+
+	api1, api2 := newFlow("http://api.test/"), newFlow("http://api.test/")
+	th.Requestheaders(api1)
+	th.Requestheaders(api2)
+	if api1.Throttle().Upload[0] == api2.Throttle().Upload[0] {
+		t.Fatal("expected a limiter per flow")
+	}
+	apex := newFlow("http://example.com/")
+	th.Requestheaders(apex)
+	if apex.Throttle() != nil {
+		t.Fatal("expected example.com not to match *.example.com")
+	}
+
+	// requests of the clients of 10.0.0.0/8 over 1 per second are rejected
+	r := th.rules[0]
+	if !r.match(net.ParseIP("10.1.1.1"), "any.test") || r.match(net.ParseIP("192.168.1.1"), "any.test") || r.match(nil, "") {
+		t.Fatal("unexpected client match")
+	}
+	b := r.bucketsFor(net.ParseIP("10.1.1.1"), "")
+	if !b.requests.Allow() || b.requests.Allow() {
+		t.Fatal("expected a request per second")
+	}
+	if r.bucketsFor(net.ParseIP("10.1.1.2"), "") == b {
+		t.Fatal("expected a limiter per client")
+	}
+
+	for _, invalid := range []ThrottleRule{{Per: "path"}, {Clients: []string{"localhost"}}} {
+		if _, err := NewThrottle([]ThrottleRule{invalid}); err == nil {
+			t.Fatalf("expected an error of %+v", invalid)
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "throttle.json")
+	os.WriteFile(filename, []byte(`[{"hosts": ["*"], "downloadBytesPerSecond": 50000}]`), 0o644)
+	fromFile, err := NewThrottleFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fromFile.rules) != 1 || fromFile.rules[0].DownloadBytesPerSecond != 50000 {
+		t.Fatalf("unexpected rules %+v", fromFile.rules)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/groupcache/lru"
@@ -42,6 +43,23 @@ type CA struct {
 	cache   *lru.Cache
 
 	group *singleflight.Group
+
+	generated atomic.Int64
+	cacheHits atomic.Int64
+}
+
+// Stats are the counts of the certificates got from the CA.
+type Stats struct {
+	Generated int64 // certificates generated
+	CacheHits int64 // certificates GetCert found in the cache
+}
+
+// Stats returns the counts of the certificates got from the CA.
+func (ca *CA) Stats() Stats {
+	return Stats{
+		Generated: ca.generated.Load(),
+		CacheHits: ca.cacheHits.Load(),
+	}
 }
 
 type Loader interface {
@@ -270,6 +288,7 @@ func (ca *CA) GetCert(commonName string) (*tls.Certificate, error) {
 	ca.cacheMu.Lock()
 	if val, ok := ca.cache.Get(commonName); ok {
 		ca.cacheMu.Unlock()
+		ca.cacheHits.Add(1)
 		sLogger.Debug("ca GetCert", "commonName", commonName)
 		return val.(*tls.Certificate), nil
 	}
@@ -323,6 +342,7 @@ func (ca *CA) GenerateCert(commonName string) (*tls.Certificate, error) {
 		Certificate: [][]byte{certBytes},
 		PrivateKey:  &ca.PrivateKey,
 	}
+	ca.generated.Add(1)
 
 	return cert, nil
 }
@@ -44,3 +44,18 @@ func TestNewCA(t *testing.T) {
 		t.Fatal("pem content should equal")
 	}
 }
+
+func TestCAStats(t *testing.T) {
+	ca, err := New(&MemoryLoader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.example.com", "a.example.com", "b.example.com"} {
+		if _, err := ca.GetCert(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := ca.Stats(); stats.Generated != 2 || stats.CacheHits != 1 {
+		t.Fatalf("expected 2 generated and 1 cache hit, but got %+v", stats)
+	}
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/proxati/mitmproxy/addon"
 	"github.com/proxati/mitmproxy/cert"
@@ -18,26 +25,85 @@ type Config struct {
 	version  bool
 	certPath string
 
-	addr         string
+	addr         string // comma separated listen addrs
+	systemd      bool
 	webAddr      string
+	metricsAddr  string
 	ssl_insecure bool
 
 	dump      string // dump filename
 	dumpLevel int    // dump level
+	save      string // saved flows filename
 
-	mapperDir string
+	spillLargeBodies int64 // spill bodies up to this size to disk
+
+	protoDescriptorSets string // comma separated descriptor set files
+
+	hosts      string // comma separated host=ip overrides
+	aclClients string // comma separated CIDRs
+	aclAllow   string // comma separated destination patterns
+	aclDeny    string // comma separated destination patterns
+	dnsServer  string
+
+	dialTimeout           time.Duration
+	tlsHandshakeTimeout   time.Duration
+	responseHeaderTimeout time.Duration
+	interceptTimeout      time.Duration
+	shutdownTimeout       time.Duration
+
+	mapperDir  string
+	throttle   string // throttle rules filename
+	conditions string // network conditions filename
+	faults     string // fault rules filename
+
+	replayDir           string
+	replayFile          string // saved flows filename
+	replayReuse         bool
+	replayKillUnmatched bool
+	replayIgnoreParams  string // comma separated query params
+	replayIgnoreScheme  bool
+	replayIgnoreHost    bool
+	replayIgnoreBody    bool
+	replayHeaders       string // comma separated header names
 }
 
 func loadConfig() *Config {
 	config := new(Config)
 
 	flag.BoolVar(&config.version, "version", false, "show version")
-	flag.StringVar(&config.addr, "addr", ":9080", "proxy listen addr")
+	flag.StringVar(&config.addr, "addr", ":9080", "comma separated proxy listen addrs, host:port or unix:///path/to.sock")
+	flag.BoolVar(&config.systemd, "systemd", false, "serve the sockets of systemd socket activation instead of -addr")
 	flag.StringVar(&config.webAddr, "web_addr", ":9081", "web interface listen addr")
+	flag.StringVar(&config.metricsAddr, "metrics_addr", "", "prometheus metrics listen addr, \"web\" to serve /metrics on the web interface")
 	flag.BoolVar(&config.ssl_insecure, "ssl_insecure", false, "not verify upstream server SSL/TLS certificates.")
 	flag.StringVar(&config.dump, "dump", "", "dump filename")
 	flag.IntVar(&config.dumpLevel, "dump_level", 0, "dump level: 0 - header, 1 - header + body")
+	flag.StringVar(&config.save, "save", "", "append the flows with their bodies to this file, which -replay_file replays")
+	flag.Int64Var(&config.spillLargeBodies, "spill_large_bodies", 0, "buffer bodies larger than 5mb up to this size in temp files instead of streaming them")
+	flag.StringVar(&config.protoDescriptorSets, "proto_descriptor_sets", "", "comma separated protobuf descriptor set files to decode grpc messages")
+	flag.StringVar(&config.aclClients, "acl_clients", "", "comma separated CIDRs of the clients allowed to use the proxy, e.g. 10.0.0.0/8,127.0.0.1")
+	flag.StringVar(&config.aclAllow, "acl_allow", "", "comma separated destinations clients may reach, host[:port] with *.example.com, CIDRs and port ranges, e.g. *.example.com:443")
+	flag.StringVar(&config.aclDeny, "acl_deny", "", "comma separated destinations clients may not reach, e.g. 10.0.0.0/8,*:22")
+	flag.StringVar(&config.hosts, "hosts", "", "comma separated host=ip overrides of upstream hosts, e.g. *.example.com=127.0.0.1")
+	flag.StringVar(&config.dnsServer, "dns_server", "", "host:port of the dns server to resolve upstream hosts")
+	flag.DurationVar(&config.dialTimeout, "dial_timeout", 0, "timeout of connecting to upstream servers, 0 for none")
+	flag.DurationVar(&config.tlsHandshakeTimeout, "tls_handshake_timeout", 0, "timeout of TLS handshakes with upstream servers, 0 for none")
+	flag.DurationVar(&config.responseHeaderTimeout, "response_header_timeout", 0, "timeout of waiting for upstream response headers, 0 for none")
+	flag.DurationVar(&config.interceptTimeout, "intercept_timeout", 0, "resume flows intercepted in the web interface after this duration, 0 for none")
+	flag.DurationVar(&config.shutdownTimeout, "shutdown_timeout", 30*time.Second, "on SIGINT or SIGTERM, wait for in-flight flows up to this duration before exiting")
 	flag.StringVar(&config.mapperDir, "mapper_dir", "", "mapper files dirpath")
+	flag.StringVar(&config.replayDir, "replay_dir", "", "replay the responses of the .map.txt flows of this dirpath instead of contacting the servers")
+	flag.StringVar(&config.replayFile, "replay_file", "", "replay the responses of the flows saved by -save to this file instead of contacting the servers")
+	flag.BoolVar(&config.replayReuse, "replay_reuse", false, "replay the recorded responses of matching requests over and over in order, instead of once")
+	flag.BoolVar(&config.replayKillUnmatched, "replay_kill_unmatched", false, "kill the requests without a recorded response, instead of passing them to the servers")
+	flag.StringVar(&config.replayIgnoreParams, "replay_ignore_params", "", "comma separated query params ignored to match recorded flows, * for all")
+	flag.BoolVar(&config.replayIgnoreScheme, "replay_ignore_scheme", false, "match http and https requests to recorded flows alike")
+	flag.BoolVar(&config.replayIgnoreHost, "replay_ignore_host", false, "match requests to any host to recorded flows")
+	flag.BoolVar(&config.replayIgnoreBody, "replay_ignore_body", false, "match requests with any body to recorded flows")
+	flag.StringVar(&config.replayHeaders, "replay_headers", "", "comma separated request headers which must match recorded flows too")
+	flag.StringVar(&config.throttle, "throttle", "", "json file of rate limit and bandwidth throttle rules")
+	flag.StringVar(&config.faults, "faults", "", "json file of faults to inject into the flows")
+	flag.StringVar(&config.conditions, "conditions", "", "json file of network conditions to simulate, reloaded on SIGHUP, edited and reloaded in the web interface (/api/conditions)")
 	flag.StringVar(&config.certPath, "cert_path", "", "path of generate cert files")
 	flag.Parse()
 
@@ -71,10 +137,43 @@ func main() {
 	}
 
 	opts := &proxy.Options{
-		Addr:                  config.addr,
 		StreamLargeBodies:     1024 * 1024 * 5,
+		SpillLargeBodies:      config.spillLargeBodies,
 		InsecureSkipVerifyTLS: config.ssl_insecure,
-		CA:                    ca,
+		Timeouts: proxy.Timeouts{
+			Dial:           config.dialTimeout,
+			TLSHandshake:   config.tlsHandshakeTimeout,
+			ResponseHeader: config.responseHeaderTimeout,
+			InterceptWait:  config.interceptTimeout,
+		},
+		CA: ca,
+	}
+	if config.systemd {
+		opts.SystemdSockets = true
+	} else {
+		addrs := strings.Split(config.addr, ",")
+		opts.Addr, opts.Addrs = addrs[0], addrs[1:]
+	}
+	if config.hosts != "" || config.dnsServer != "" {
+		opts.Resolver = &proxy.Resolver{
+			Hosts:     make(map[string]string),
+			DNSServer: config.dnsServer,
+		}
+		for _, pair := range strings.Split(config.hosts, ",") {
+			if host, ip, ok := strings.Cut(pair, "="); ok {
+				opts.Resolver.Hosts[strings.TrimSpace(host)] = strings.TrimSpace(ip)
+			}
+		}
+	}
+	if config.aclClients != "" || config.aclAllow != "" || config.aclDeny != "" {
+		opts.ACL = &proxy.ACL{
+			ClientCIDRs:       splitList(config.aclClients),
+			AllowDestinations: splitList(config.aclAllow),
+			DenyDestinations:  splitList(config.aclDeny),
+		}
+	}
+	if config.protoDescriptorSets != "" {
+		opts.ProtoDescriptorSets = strings.Split(config.protoDescriptorSets, ",")
 	}
 
 	p, err := proxy.NewProxy(opts)
@@ -90,18 +189,133 @@ func main() {
 
 	logger.Debug("go-mitmproxy", "version", p.Version)
 
-	p.AddAddon(&addon.LogAddon{})
-	p.AddAddon(web.NewWebAddon(config.webAddr))
+	p.AddAddon(addon.NewLogAddon())
+	webAddon := web.NewWebAddon(config.webAddr)
+	p.AddAddon(webAddon)
 
 	if config.dump != "" {
 		dumper := addon.NewDumperWithFilename(config.dump, config.dumpLevel)
 		p.AddAddon(dumper)
 	}
 
+	if config.save != "" {
+		saver, err := addon.NewFlowSaverWithFilename(config.save)
+		if err != nil {
+			logger.Error("could not open saved flows file", "error", err)
+			os.Exit(1)
+		}
+		p.AddAddon(saver)
+	}
+
 	if config.mapperDir != "" {
 		mapper := addon.NewMapper(config.mapperDir)
 		p.AddAddon(mapper)
 	}
 
-	log.Fatal(p.Start())
+	if config.throttle != "" {
+		throttle, err := addon.NewThrottleFromFile(config.throttle)
+		if err != nil {
+			logger.Error("could not load throttle rules", "error", err)
+			os.Exit(1)
+		}
+		p.AddAddon(throttle)
+	}
+
+	if config.conditions != "" {
+		conditions, err := addon.NewNetworkConditionsFromFile(config.conditions)
+		if err != nil {
+			logger.Error("could not load network conditions", "error", err)
+			os.Exit(1)
+		}
+		p.AddAddon(conditions)
+		webAddon.Handle("/api/conditions", conditions)
+		go func() {
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			for range hup {
+				if err := conditions.Reload(); err != nil {
+					logger.Error("could not reload network conditions", "error", err)
+				}
+			}
+		}()
+	}
+
+	if config.faults != "" {
+		faults, err := addon.NewFaultsFromFile(config.faults)
+		if err != nil {
+			logger.Error("could not load fault rules", "error", err)
+			os.Exit(1)
+		}
+		p.AddAddon(faults)
+	}
+
+	if config.replayDir != "" || config.replayFile != "" {
+		opts := addon.ReplayOptions{
+			IgnoreScheme:  config.replayIgnoreScheme,
+			IgnoreHost:    config.replayIgnoreHost,
+			IgnoreParams:  splitList(config.replayIgnoreParams),
+			Headers:       splitList(config.replayHeaders),
+			IgnoreBody:    config.replayIgnoreBody,
+			Reuse:         config.replayReuse,
+			KillUnmatched: config.replayKillUnmatched,
+		}
+		var replay *addon.ServerReplay
+		var err error
+		if config.replayFile != "" {
+			replay, err = addon.NewServerReplayFromFile(config.replayFile, opts)
+		} else {
+			replay, err = addon.NewServerReplayFromDir(config.replayDir, opts)
+		}
+		if err != nil {
+			logger.Error("could not load replay flows", "error", err)
+			os.Exit(1)
+		}
+		p.AddAddon(replay)
+	}
+
+	// last, to count the bodies as forwarded
+	if config.metricsAddr != "" {
+		metrics := addon.NewMetrics(p)
+		p.AddAddon(metrics)
+		if config.metricsAddr == "web" {
+			webAddon.Handle("/metrics", metrics)
+		} else {
+			go func() {
+				logger.Error("could not start metrics endpoint", "error", metrics.ListenAndServe(config.metricsAddr))
+			}()
+		}
+	}
+
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		signal.Stop(sig) // a second signal exits immediately
+
+		stats := p.Stats()
+		logger.Info("shutting down", "activeConns", stats.ActiveConns, "activeFlows", stats.ActiveFlows)
+		ctx, cancel := context.WithTimeout(context.Background(), config.shutdownTimeout)
+		defer cancel()
+		if err := p.Shutdown(ctx); err != nil {
+			logger.Error("could not drain in-flight flows", "error", err, "activeFlows", p.Stats().ActiveFlows)
+		}
+	}()
+
+	if err := p.Start(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-shutdown
+}
+
+// splitList splits a comma separated flag, nil if empty.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
 }
@@ -0,0 +1,144 @@
+// Package contentview renders request and response bodies for display, selecting a view by Content-Type.
+//
+// The Dumper addon and the web interface use the same views, so a body is displayed the same way everywhere.
+package contentview
+
+import (
+	"errors"
+	"mime"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+var errNoView = errors.New("content view not found")
+
+// View renders a body of some content types.
+type View interface {
+	// Name is the name to select the view, e.g. "json".
+	Name() string
+
+	// Match reports whether the view should render bodies of the media type, e.g. "application/json".
+	Match(mediaType string) bool
+
+	// Render returns the body for display, params are the parameters of the Content-Type, e.g. boundary.
+	// An error means the body is not valid for the view.
+	Render(body []byte, params map[string]string) (string, error)
+}
+
+var (
+	viewsMu sync.RWMutex
+	views   = []View{
+		Hex,
+		Raw,
+		Query,
+		JSON,
+		XML,
+		HTML,
+		URLEncoded,
+		Multipart,
+		Image,
+		Protobuf,
+		GRPC,
+	}
+)
+
+// Register adds a view, it is tried before the views registered earlier.
+// A view with the same name replaces the existing one.
+func Register(v View) {
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+	for i, view := range views {
+		if view.Name() == v.Name() {
+			views = append(views[:i], views[i+1:]...)
+			break
+		}
+	}
+	views = append(views, v)
+}
+
+// Get returns the view of name, nil if not found.
+func Get(name string) View {
+	viewsMu.RLock()
+	defer viewsMu.RUnlock()
+	for _, v := range views {
+		if v.Name() == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// Names returns the names of all views.
+func Names() []string {
+	viewsMu.RLock()
+	defer viewsMu.RUnlock()
+	names := make([]string, 0, len(views))
+	for _, v := range views {
+		names = append(names, v.Name())
+	}
+	return names
+}
+
+// Render renders body with the last registered view matching contentType.
+// It falls back to the raw view for text and the hex view for binary, and returns the name of the view used.
+func Render(contentType string, body []byte) (name string, text string) {
+	mediaType, params := parseContentType(contentType)
+
+	viewsMu.RLock()
+	candidates := make([]View, len(views))
+	copy(candidates, views)
+	viewsMu.RUnlock()
+
+	for i := len(candidates) - 1; i >= 0; i-- {
+		v := candidates[i]
+		if !v.Match(mediaType) {
+			continue
+		}
+		if text, err := v.Render(body, params); err == nil {
+			return v.Name(), text
+		}
+	}
+
+	if IsPrintable(body) {
+		text, _ := Raw.Render(body, params)
+		return Raw.Name(), text
+	}
+	text, _ = Hex.Render(body, params)
+	return Hex.Name(), text
+}
+
+// RenderWith renders body with the view of name.
+func RenderWith(name string, contentType string, body []byte) (string, error) {
+	v := Get(name)
+	if v == nil {
+		return "", errNoView
+	}
+	_, params := parseContentType(contentType)
+	return v.Render(body, params)
+}
+
+func parseContentType(contentType string) (string, map[string]string) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// keep the media type of a header with invalid parameters
+		mediaType, _, _ = strings.Cut(contentType, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		params = make(map[string]string)
+	}
+	return mediaType, params
+}
+
+// IsPrintable reports whether body is utf-8 text without control characters.
+func IsPrintable(body []byte) bool {
+	if !utf8.Valid(body) {
+		return false
+	}
+	for _, c := range string(body) {
+		if !unicode.IsPrint(c) && !unicode.IsSpace(c) {
+			return false
+		}
+	}
+	return true
+}
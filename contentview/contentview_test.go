@@ -0,0 +1,63 @@
+package contentview
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"strconv"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	pngBuf := new(bytes.Buffer)
+	if err := png.Encode(pngBuf, image.NewRGBA(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+
+	formBuf := new(bytes.Buffer)
+	mw := multipart.NewWriter(formBuf)
+	mw.WriteField("name", "go")
+	fw, _ := mw.CreateFormFile("file", "a.bin")
+	fw.Write([]byte{0, 1, 2})
+	mw.Close()
+
+	cases := []struct {
+		contentType string
+		body        []byte
+		view        string
+		text        string
+	}{
+		{"application/json; charset=utf-8", []byte(`{"a":[1,2]}`), "json", "{\n  \"a\": [\n    1,\n    2\n  ]\n}"},
+		{"application/problem+json", []byte(`{"a":1}`), "json", "{\n  \"a\": 1\n}"},
+		{"application/json", []byte(`{"a":`), "raw", `{"a":`},
+		{"text/xml", []byte(`<a><b x="1">t</b><c/></a>`), "xml", "<a>\n  <b x=\"1\">t</b>\n  <c/>\n</a>"},
+		{"application/soap+xml", []byte(`<?xml version="1.0"?><s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns="urn:a"><s:Body/><!-- c --><p>a &amp; b</p></s:Envelope>`), "xml",
+			"<?xml version=\"1.0\"?>\n<s:Envelope xmlns:s=\"http://www.w3.org/2003/05/soap-envelope\" xmlns=\"urn:a\">\n  <s:Body/>\n  <!-- c -->\n  <p>a &amp; b</p>\n</s:Envelope>"},
+		{"text/html", []byte(`<!DOCTYPE html><html><body><p>hi<br>there</p><script>if (a<b) {}</script></body></html>`), "html",
+			"<!DOCTYPE html>\n<html>\n  <body>\n    <p>\n      hi\n      <br>\n      there\n    </p>\n    <script>\nif (a<b) {}\n    </script>\n  </body>\n</html>\n"},
+		{"application/x-www-form-urlencoded", []byte("a=1&long_key=x+y%21"), "urlencoded", "a:         1\nlong_key:  x y!\n"},
+		{mw.FormDataContentType(), formBuf.Bytes(), "multipart", "name:  go\nfile:  [file \"a.bin\", application/octet-stream, 3 bytes]\n"},
+		{"image/png", pngBuf.Bytes(), "image", "Format:  png\nSize:    3x2\nBytes:   " + strconv.Itoa(pngBuf.Len()) + "\n"},
+		{"application/x-protobuf", []byte{0x08, 0x96, 0x01}, "protobuf", "{\n  \"1\": 150\n}"},
+		{"application/octet-stream", []byte{0, 1}, "hex", "00000000  00 01                                             |..|\n"},
+		{"", []byte("plain"), "raw", "plain"},
+	}
+
+	for _, c := range cases {
+		view, text := Render(c.contentType, c.body)
+		if view != c.view || text != c.text {
+			t.Errorf("%s: expected %s view %q, but got %s view %q", c.contentType, c.view, c.text, view, text)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	text, err := RenderWith("query", "", []byte("?q=a%20b&page=2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "q:     a b\npage:  2\n"; text != want {
+		t.Fatalf("expected %q, but got %q", want, text)
+	}
+}
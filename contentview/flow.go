@@ -0,0 +1,74 @@
+package contentview
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+// RenderRequest renders the decoded request body of f.
+// gRPC messages are decoded with the descriptor sets of the proxy if the method is known.
+func RenderRequest(f *proxy.Flow) (name string, text string, err error) {
+	if proxy.IsGRPC(f.Request.Header) {
+		msgs, err := f.GRPCRequestMessages()
+		if err == nil {
+			return GRPC.Name(), renderGRPCMessages(msgs), nil
+		}
+	}
+	body, err := f.Request.DecodedBody()
+	if err != nil {
+		return "", "", err
+	}
+	name, text = Render(f.Request.Header.Get("Content-Type"), body)
+	return name, text, nil
+}
+
+// RenderResponse renders the decoded response body of f.
+// gRPC messages are decoded with the descriptor sets of the proxy if the method is known.
+func RenderResponse(f *proxy.Flow) (name string, text string, err error) {
+	if proxy.IsGRPC(f.Response.Header) {
+		msgs, err := f.GRPCResponseMessages()
+		if err == nil {
+			return GRPC.Name(), renderGRPCMessages(msgs), nil
+		}
+	}
+	body, err := f.Response.DecodedBody()
+	if err != nil {
+		return "", "", err
+	}
+	name, text = Render(f.Response.Header.Get("Content-Type"), body)
+	return name, text, nil
+}
+
+// RenderRequestWith renders the decoded request body of f with the view of name.
+func RenderRequestWith(name string, f *proxy.Flow) (string, error) {
+	return renderWith(name, f.Request.Header, f.Request.DecodedBody)
+}
+
+// RenderResponseWith renders the decoded response body of f with the view of name.
+func RenderResponseWith(name string, f *proxy.Flow) (string, error) {
+	return renderWith(name, f.Response.Header, f.Response.DecodedBody)
+}
+
+func renderWith(name string, header http.Header, decodedBody func() ([]byte, error)) (string, error) {
+	body, err := decodedBody()
+	if err != nil {
+		return "", err
+	}
+	return RenderWith(name, header.Get("Content-Type"), body)
+}
+
+func renderGRPCMessages(msgs []*proxy.GRPCMessage) string {
+	buf := new(strings.Builder)
+	for _, msg := range msgs {
+		if msg.JSON == nil {
+			text, _ := Hex.Render(msg.Data, nil)
+			buf.WriteString(text)
+			continue
+		}
+		buf.WriteString(indentJSON(msg.JSON))
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
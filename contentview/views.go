@@ -0,0 +1,411 @@
+package contentview
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/proxati/mitmproxy/proxy"
+)
+
+// viewFunc is a View of functions.
+type viewFunc struct {
+	name   string
+	match  func(mediaType string) bool
+	render func(body []byte, params map[string]string) (string, error)
+}
+
+func (v *viewFunc) Name() string                { return v.name }
+func (v *viewFunc) Match(mediaType string) bool { return v.match(mediaType) }
+func (v *viewFunc) Render(body []byte, params map[string]string) (string, error) {
+	return v.render(body, params)
+}
+
+func matchNone(string) bool { return false }
+
+func matchTypes(types ...string) func(string) bool {
+	return func(mediaType string) bool {
+		for _, t := range types {
+			if mediaType == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// matchSuffix matches structured syntax suffixes, e.g. application/ld+json.
+func matchSuffix(suffix string, types ...string) func(string) bool {
+	match := matchTypes(types...)
+	return func(mediaType string) bool {
+		return match(mediaType) || strings.HasSuffix(mediaType, suffix)
+	}
+}
+
+// Hex renders a hex dump, the fallback of binary bodies.
+var Hex View = &viewFunc{
+	name:  "hex",
+	match: matchNone,
+	render: func(body []byte, _ map[string]string) (string, error) {
+		return hex.Dump(body), nil
+	},
+}
+
+// Raw renders body as is, the fallback of text bodies.
+var Raw View = &viewFunc{
+	name:  "raw",
+	match: matchNone,
+	render: func(body []byte, _ map[string]string) (string, error) {
+		return string(body), nil
+	},
+}
+
+// JSON pretty-prints with two spaces indent.
+var JSON View = &viewFunc{
+	name:  "json",
+	match: matchSuffix("+json", "application/json", "text/json"),
+	render: func(body []byte, _ map[string]string) (string, error) {
+		buf := new(bytes.Buffer)
+		if err := json.Indent(buf, bytes.TrimSpace(body), "", "  "); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	},
+}
+
+// XML pretty-prints with two spaces indent. The tokens are written as they are read, so the namespace prefixes
+// and xmlns attributes are kept, and empty elements are self-closing.
+var XML View = &viewFunc{
+	name:  "xml",
+	match: matchSuffix("+xml", "application/xml", "text/xml"),
+	render: func(body []byte, _ map[string]string) (string, error) {
+		decoder := xml.NewDecoder(bytes.NewReader(body))
+		decoder.Strict = false
+		tokens := make([]xml.Token, 0)
+		for {
+			token, err := decoder.RawToken()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			if data, ok := token.(xml.CharData); ok && len(bytes.TrimSpace(data)) == 0 {
+				continue
+			}
+			tokens = append(tokens, xml.CopyToken(token))
+		}
+		return indentXML(tokens), nil
+	},
+}
+
+func indentXML(tokens []xml.Token) string {
+	buf := new(strings.Builder)
+	depth := 0
+	newline := func() {
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(strings.Repeat("  ", depth))
+	}
+	for i := 0; i < len(tokens); i++ {
+		switch t := tokens[i].(type) {
+		case xml.StartElement:
+			newline()
+			buf.WriteString("<" + xmlName(t.Name))
+			for _, attr := range t.Attr {
+				buf.WriteString(" " + xmlName(attr.Name) + `="`)
+				xml.EscapeText(buf, []byte(attr.Value))
+				buf.WriteByte('"')
+			}
+			// <a/> for empty elements, <a>text</a> on one line for text only elements
+			if i+1 < len(tokens) {
+				if _, ok := tokens[i+1].(xml.EndElement); ok {
+					buf.WriteString("/>")
+					i++
+					continue
+				}
+			}
+			buf.WriteByte('>')
+			if i+2 < len(tokens) {
+				text, isText := tokens[i+1].(xml.CharData)
+				end, isEnd := tokens[i+2].(xml.EndElement)
+				if isText && isEnd {
+					xml.EscapeText(buf, text)
+					buf.WriteString("</" + xmlName(end.Name) + ">")
+					i += 2
+					continue
+				}
+			}
+			depth++
+		case xml.EndElement:
+			depth = max(depth-1, 0)
+			newline()
+			buf.WriteString("</" + xmlName(t.Name) + ">")
+		case xml.CharData:
+			newline()
+			xml.EscapeText(buf, bytes.TrimSpace(t))
+		case xml.Comment:
+			newline()
+			buf.WriteString("<!--" + string(t) + "-->")
+		case xml.ProcInst:
+			newline()
+			buf.WriteString("<?" + t.Target)
+			if len(t.Inst) > 0 {
+				buf.WriteString(" " + string(t.Inst))
+			}
+			buf.WriteString("?>")
+		case xml.Directive:
+			newline()
+			buf.WriteString("<!" + string(t) + ">")
+		}
+	}
+	return buf.String()
+}
+
+// xmlName returns the name with its prefix as written, RawToken keeps the prefix in Space.
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+var (
+	htmlTokenRe  = regexp.MustCompile(`(?s)<!--.*?-->|<![^>]*>|</?([a-zA-Z][a-zA-Z0-9-]*)[^>]*>`)
+	htmlVoidTags = map[string]bool{
+		"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+		"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+	}
+	htmlRawTags = map[string]bool{"script": true, "style": true, "pre": true, "textarea": true}
+)
+
+// HTML indents elements, one tag or text per line.
+// The content of script, style, pre and textarea is kept as is.
+var HTML View = &viewFunc{
+	name:  "html",
+	match: matchTypes("text/html", "application/xhtml+xml"),
+	render: func(body []byte, _ map[string]string) (string, error) {
+		src := string(body)
+		buf := new(strings.Builder)
+		depth := 0
+		writeLine := func(s string) {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				return
+			}
+			buf.WriteString(strings.Repeat("  ", depth))
+			buf.WriteString(s)
+			buf.WriteByte('\n')
+		}
+
+		pos := 0
+		for pos < len(src) {
+			loc := htmlTokenRe.FindStringSubmatchIndex(src[pos:])
+			if loc == nil {
+				writeLine(src[pos:])
+				break
+			}
+			writeLine(src[pos : pos+loc[0]])
+			tag := src[pos+loc[0] : pos+loc[1]]
+			pos += loc[1]
+
+			if loc[2] < 0 {
+				// comment or doctype
+				writeLine(tag)
+				continue
+			}
+			name := strings.ToLower(tag[loc[2]-loc[0] : loc[3]-loc[0]])
+			switch {
+			case strings.HasPrefix(tag, "</"):
+				if depth > 0 {
+					depth--
+				}
+				writeLine(tag)
+			case htmlVoidTags[name] || strings.HasSuffix(tag, "/>"):
+				writeLine(tag)
+			case htmlRawTags[name]:
+				writeLine(tag)
+				end := strings.Index(strings.ToLower(src[pos:]), "</"+name)
+				if end < 0 {
+					end = len(src) - pos
+				}
+				depth++
+				if content := strings.Trim(src[pos:pos+end], "\r\n"); strings.TrimSpace(content) != "" {
+					buf.WriteString(content)
+					buf.WriteByte('\n')
+				}
+				pos += end
+			default:
+				writeLine(tag)
+				depth++
+			}
+		}
+		return buf.String(), nil
+	},
+}
+
+// formatTable renders rows of key and value with aligned values.
+func formatTable(rows [][2]string) string {
+	width := 0
+	for _, row := range rows {
+		if len(row[0]) > width {
+			width = len(row[0])
+		}
+	}
+	buf := new(strings.Builder)
+	for _, row := range rows {
+		fmt.Fprintf(buf, "%-*s  %s\n", width+1, row[0]+":", row[1])
+	}
+	return buf.String()
+}
+
+func renderValues(raw string) (string, error) {
+	rows := make([][2]string, 0)
+	for raw != "" {
+		var pair string
+		pair, raw, _ = strings.Cut(raw, "&")
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(key)
+		if err != nil {
+			return "", err
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			return "", err
+		}
+		rows = append(rows, [2]string{key, value})
+	}
+	return formatTable(rows), nil
+}
+
+// URLEncoded renders a urlencoded form as a table, in the order of the fields.
+var URLEncoded View = &viewFunc{
+	name:  "urlencoded",
+	match: matchTypes("application/x-www-form-urlencoded"),
+	render: func(body []byte, _ map[string]string) (string, error) {
+		return renderValues(string(body))
+	},
+}
+
+// Query renders a query string as a table, it is not selected by Content-Type.
+var Query View = &viewFunc{
+	name:  "query",
+	match: matchNone,
+	render: func(body []byte, _ map[string]string) (string, error) {
+		return renderValues(strings.TrimPrefix(string(body), "?"))
+	},
+}
+
+// Multipart renders the parts of a multipart form as a table, files are shown by name and size.
+var Multipart View = &viewFunc{
+	name:  "multipart",
+	match: matchTypes("multipart/form-data", "multipart/mixed"),
+	render: func(body []byte, params map[string]string) (string, error) {
+		boundary := params["boundary"]
+		if boundary == "" {
+			return "", errors.New("no multipart boundary")
+		}
+		r := multipart.NewReader(bytes.NewReader(body), boundary)
+		rows := make([][2]string, 0)
+		for {
+			part, err := r.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			content, err := io.ReadAll(part)
+			if err != nil {
+				return "", err
+			}
+
+			name := part.FormName()
+			if name == "" {
+				name = fmt.Sprintf("(part %d)", len(rows)+1)
+			}
+			var value string
+			if part.FileName() != "" || !IsPrintable(content) {
+				value = fmt.Sprintf("[file %q, %s, %d bytes]", part.FileName(), part.Header.Get("Content-Type"), len(content))
+			} else {
+				value = string(content)
+			}
+			rows = append(rows, [2]string{name, value})
+		}
+		return formatTable(rows), nil
+	},
+}
+
+// Image renders the format and dimensions of png, jpeg and gif images.
+var Image View = &viewFunc{
+	name:  "image",
+	match: matchTypes("image/png", "image/jpeg", "image/jpg", "image/gif"),
+	render: func(body []byte, _ map[string]string) (string, error) {
+		config, format, err := image.DecodeConfig(bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		return formatTable([][2]string{
+			{"Format", format},
+			{"Size", fmt.Sprintf("%dx%d", config.Width, config.Height)},
+			{"Bytes", fmt.Sprint(len(body))},
+		}), nil
+	},
+}
+
+func indentJSON(data []byte) string {
+	buf := new(bytes.Buffer)
+	if err := json.Indent(buf, data, "", "  "); err != nil {
+		return string(data)
+	}
+	return buf.String()
+}
+
+// Protobuf renders a protobuf message without schema, keyed by field numbers.
+var Protobuf View = &viewFunc{
+	name:  "protobuf",
+	match: matchTypes("application/x-protobuf", "application/protobuf", "application/x-protobuffer"),
+	render: func(body []byte, _ map[string]string) (string, error) {
+		j, err := proxy.ProtoToJSONSchemaless(body)
+		if err != nil {
+			return "", err
+		}
+		return indentJSON(j), nil
+	},
+}
+
+// GRPC renders the messages of a gRPC body without schema.
+// Use Flow.GRPCRequestMessages and Flow.GRPCResponseMessages to decode with the descriptor sets of the proxy.
+var GRPC View = &viewFunc{
+	name:  "grpc",
+	match: matchTypes("application/grpc", "application/grpc+proto"),
+	render: func(body []byte, _ map[string]string) (string, error) {
+		// compressed messages are not supported, the grpc-encoding header is not known here
+		msgs, err := proxy.ParseGRPCMessages(nil, body)
+		if err != nil {
+			return "", err
+		}
+		for _, msg := range msgs {
+			if j, err := proxy.ProtoToJSONSchemaless(msg.Data); err == nil {
+				msg.JSON = j
+			}
+		}
+		return renderGRPCMessages(msgs), nil
+	},
+}
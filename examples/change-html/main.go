@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"os"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/proxati/mitmproxy/proxy"
@@ -24,9 +23,15 @@ func (c *ChangeHtml) Response(f *proxy.Flow) {
 	}
 
 	// change html <title> end with: " - go-mitmproxy"
-	f.Response.ReplaceToDecodedBody()
-	f.Response.Body = titleRegexp.ReplaceAll(f.Response.Body, []byte("${1}${2} - go-mitmproxy${3}"))
-	f.Response.Header.Set("Content-Length", strconv.Itoa(len(f.Response.Body)))
+	body, err := f.Response.DecodedBody()
+	if err != nil {
+		slog.Error("could not decode body", "error", err)
+		return
+	}
+	body = titleRegexp.ReplaceAll(body, []byte("${1}${2} - go-mitmproxy${3}"))
+	if err := f.Response.SetDecodedBody(body); err != nil {
+		slog.Error("could not encode body", "error", err)
+	}
 }
 
 func main() {
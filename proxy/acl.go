@@ -0,0 +1,369 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ACL restricts the clients of the proxy and the destinations of their CONNECT and absolute-URL requests.
+// Refused requests get a 403 and trigger the AccessDenied addon event.
+//
+// A destination pattern is host, host:port or [host]:port. The host is "*", a name, "*.example.com" for the
+// subdomains of example.com, an IP or a CIDR such as 10.0.0.0/8. The port is "*", a port or a range such as
+// 8000-9000, any port if omitted. IP and CIDR patterns also match the IP a destination name is dialed at,
+// they are checked on the connection dialed so a name can not resolve otherwise after the check. Behind an
+// upstream proxy, which resolves the names, they match the IPs the names resolve to here, and the destinations
+// which do not resolve are denied.
+type ACL struct {
+	ClientCIDRs       []string // clients allowed, all if empty; clients of unix sockets are always allowed
+	AllowDestinations []string // destinations allowed, all if empty
+	DenyDestinations  []string // destinations denied, even if allowed
+
+	clients []*net.IPNet
+	allow   []destinationPattern
+	deny    []destinationPattern
+	hasIPs  bool // a pattern matches IPs, so the IPs of destination names are checked
+}
+
+// Denial is a request refused by the ACL.
+type Denial struct {
+	ConnContext *ConnContext
+	Method      string // CONNECT or the method of an absolute-URL request
+	Host        string // host:port of the destination
+	Reason      string
+}
+
+// deniedError is the error of a dial refused by the ACL.
+type deniedError struct {
+	reason string
+}
+
+func (e *deniedError) Error() string {
+	return "access denied: " + e.reason
+}
+
+type destinationPattern struct {
+	raw      string
+	host     string     // lower case name, "*" or "*.suffix", empty for an IP pattern
+	ipNet    *net.IPNet // IP or CIDR pattern
+	from, to int        // port range, 0 to 65535 for any
+}
+
+// compile parses the CIDRs and patterns, it is called by NewProxy.
+func (acl *ACL) compile() error {
+	acl.clients = acl.clients[:0]
+	for _, cidr := range acl.ClientCIDRs {
+		ipNet, err := ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("acl client %q: %w", cidr, err)
+		}
+		acl.clients = append(acl.clients, ipNet)
+	}
+	var err error
+	if acl.allow, err = acl.compileDestinations(acl.AllowDestinations); err != nil {
+		return err
+	}
+	acl.deny, err = acl.compileDestinations(acl.DenyDestinations)
+	return err
+}
+
+func (acl *ACL) compileDestinations(patterns []string) ([]destinationPattern, error) {
+	compiled := make([]destinationPattern, 0, len(patterns))
+	for _, raw := range patterns {
+		p, err := parseDestinationPattern(raw)
+		if err != nil {
+			return nil, fmt.Errorf("acl destination %q: %w", raw, err)
+		}
+		if p.ipNet != nil {
+			acl.hasIPs = true
+		}
+		compiled = append(compiled, p)
+	}
+	return compiled, nil
+}
+
+// ParseCIDR parses a CIDR, or an IP as the CIDR of this single IP.
+func ParseCIDR(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		return ipNet, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, errors.New("invalid IP")
+	}
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func parseDestinationPattern(raw string) (destinationPattern, error) {
+	p := destinationPattern{raw: raw, to: 65535}
+	host, port := raw, ""
+	if h, pt, err := net.SplitHostPort(raw); err == nil {
+		host, port = h, pt
+	}
+
+	if port != "" && port != "*" {
+		from, to, isRange := strings.Cut(port, "-")
+		if !isRange {
+			to = from
+		}
+		var err1, err2 error
+		p.from, err1 = strconv.Atoi(from)
+		p.to, err2 = strconv.Atoi(to)
+		if err1 != nil || err2 != nil || p.from < 0 || p.to > 65535 || p.from > p.to {
+			return p, fmt.Errorf("invalid port %q", port)
+		}
+	}
+
+	if host == "" {
+		return p, errors.New("empty host")
+	}
+	if ipNet, err := ParseCIDR(host); err == nil {
+		p.ipNet = ipNet
+	} else if strings.Contains(host, "/") {
+		return p, err
+	} else {
+		p.host = strings.ToLower(strings.TrimSuffix(host, "."))
+	}
+	return p, nil
+}
+
+// match reports whether the destination host, lower case, with port and resolved ips matches the pattern.
+func (p *destinationPattern) match(host string, port int, ips []net.IP) bool {
+	if port < p.from || port > p.to {
+		return false
+	}
+	if p.ipNet != nil {
+		for _, ip := range ips {
+			if p.ipNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return MatchHost(p.host, host)
+}
+
+// MatchHost reports whether host, lower case, matches a host, "*" or "*.suffix" pattern.
+func MatchHost(pattern, host string) bool {
+	if pattern == "*" || pattern == host {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(pattern, "*")
+	return ok && strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+}
+
+// allowClient reports whether a client at addr may use the proxy.
+func (acl *ACL) allowClient(addr net.Addr) bool {
+	if len(acl.clients) == 0 {
+		return true
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+	for _, ipNet := range acl.clients {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDestination returns why the destination hostport is refused, empty if it is allowed.
+// ips are the IPs of the destination, nil if not known yet, then a name not matched by the patterns of names
+// is allowed if an IP pattern may allow it, and the IP patterns are checked with checkDialed.
+func (acl *ACL) checkDestination(hostport string, ips []net.IP) string {
+	if len(acl.allow) == 0 && len(acl.deny) == 0 {
+		return ""
+	}
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "invalid destination"
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "invalid destination port"
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ip := net.ParseIP(host); ip != nil && ips == nil {
+		ips = []net.IP{ip}
+	}
+
+	for i := range acl.deny {
+		if acl.deny[i].match(host, port, ips) {
+			return "destination denied by " + acl.deny[i].raw
+		}
+	}
+	if len(acl.allow) == 0 {
+		return ""
+	}
+	for i := range acl.allow {
+		if acl.allow[i].match(host, port, ips) {
+			return ""
+		}
+		if ips == nil && acl.allow[i].ipNet != nil && port >= acl.allow[i].from && port <= acl.allow[i].to {
+			return ""
+		}
+	}
+	return "destination not allowed"
+}
+
+// checkDialed checks the destination hostport with the IP and port of address, the ip:port dialed for it.
+func (acl *ACL) checkDialed(hostport string, address string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "invalid destination"
+	}
+	ipStr, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "destination IP unknown"
+	}
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return "destination IP unknown"
+	}
+	return acl.checkDestination(net.JoinHostPort(host, port), []net.IP{ip})
+}
+
+// checkResolved checks the destination hostport with the IPs it resolves to, for the destinations reached through
+// an upstream proxy. The destinations which do not resolve are denied.
+func (acl *ACL) checkResolved(ctx context.Context, resolver *Resolver, hostport string) string {
+	if !acl.hasIPs {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "invalid destination"
+	}
+	if net.ParseIP(host) != nil {
+		return acl.checkDestination(hostport, nil)
+	}
+	ips := lookupIPs(ctx, resolver, host)
+	if len(ips) == 0 {
+		return "destination not resolved"
+	}
+	return acl.checkDestination(hostport, ips)
+}
+
+// lookupIPs resolves host with resolver if not nil, nil if it fails.
+func lookupIPs(ctx context.Context, resolver *Resolver, host string) []net.IP {
+	var addrs []string
+	var err error
+	if resolver != nil {
+		addrs, err = resolver.LookupHost(ctx, host)
+	} else {
+		addrs, err = net.DefaultResolver.LookupHost(ctx, host)
+	}
+	if err != nil {
+		return nil
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// dialDestination dials addr for the destination hostport, refusing the connection with a *deniedError
+// if Options.ACL does not allow the IP dialed. The IP is checked before connecting, or right after connecting
+// with Options.Dialer.
+func (proxy *Proxy) dialDestination(ctx context.Context, network, hostport, addr string, connCtx *ConnContext) (net.Conn, error) {
+	acl := proxy.Opts.ACL
+	if acl == nil || !acl.hasIPs {
+		return proxy.dial(ctx, network, addr, connCtx)
+	}
+	if proxy.Opts.Dialer == nil {
+		return proxy.dialControl(ctx, network, addr, connCtx, func(_, address string, _ syscall.RawConn) error {
+			if reason := acl.checkDialed(hostport, address); reason != "" {
+				return &deniedError{reason: reason}
+			}
+			return nil
+		})
+	}
+
+	c, err := proxy.dial(ctx, network, addr, connCtx)
+	if err != nil {
+		return nil, err
+	}
+	if reason := acl.checkDialed(hostport, c.RemoteAddr().String()); reason != "" {
+		c.Close()
+		return nil, &deniedError{reason: reason}
+	}
+	return c, nil
+}
+
+// checkProxiedDestination returns a *deniedError if Options.ACL does not allow the destination hostport
+// reached through an upstream proxy.
+func (proxy *Proxy) checkProxiedDestination(ctx context.Context, hostport string) error {
+	acl := proxy.Opts.ACL
+	if acl == nil {
+		return nil
+	}
+	if reason := acl.checkResolved(ctx, proxy.Opts.Resolver, hostport); reason != "" {
+		return &deniedError{reason: reason}
+	}
+	return nil
+}
+
+// checkACL replies 403 and triggers the AccessDenied event if Options.ACL refuses the client or the destination
+// of req, a CONNECT or absolute-URL request. Requests inside a CONNECT tunnel were checked with the CONNECT.
+func (proxy *Proxy) checkACL(res http.ResponseWriter, req *http.Request, hostport string) bool {
+	acl := proxy.Opts.ACL
+	if acl == nil {
+		return true
+	}
+	connCtx := req.Context().Value(connContextKey).(*ConnContext)
+	if connCtx.pipeConn != nil {
+		return true
+	}
+
+	reason := ""
+	if !acl.allowClient(connCtx.ClientConn.Conn.RemoteAddr()) {
+		reason = "client not allowed"
+	} else {
+		reason = acl.checkDestination(hostport, nil)
+	}
+	if reason == "" {
+		return true
+	}
+	proxy.denyAccess(res, connCtx, req.Method, hostport, reason)
+	return false
+}
+
+// replyDenied replies 403 and triggers the AccessDenied event if err is a dial refused by Options.ACL.
+func (proxy *Proxy) replyDenied(res http.ResponseWriter, connCtx *ConnContext, method, hostport string, err error) bool {
+	var denied *deniedError
+	if !errors.As(err, &denied) {
+		return false
+	}
+	proxy.denyAccess(res, connCtx, method, hostport, denied.reason)
+	return true
+}
+
+func (proxy *Proxy) denyAccess(res http.ResponseWriter, connCtx *ConnContext, method, hostport, reason string) {
+	sLogger.Info("access denied", "client", connCtx.ClientConn.Conn.RemoteAddr(), "method", method, "host", hostport, "reason", reason)
+	d := &Denial{
+		ConnContext: connCtx,
+		Method:      method,
+		Host:        hostport,
+		Reason:      reason,
+	}
+	for _, addon := range proxy.Addons {
+		addon.AccessDenied(d)
+	}
+	res.Header().Set("Connection", "close")
+	http.Error(res, "Forbidden by the proxy: "+reason, http.StatusForbidden)
+}
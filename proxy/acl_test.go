@@ -0,0 +1,285 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/proxati/mitmproxy/cert"
+)
+
+func TestACLPatterns(t *testing.T) {
+	acl := &ACL{
+		ClientCIDRs:       []string{"10.0.0.0/8", "127.0.0.1"},
+		AllowDestinations: []string{"*.example.com:443", "api.test", "192.168.0.0/16:8000-9000"},
+		DenyDestinations:  []string{"admin.example.com", "*:22"},
+	}
+	handleError(t, acl.compile())
+
+	clients := map[string]bool{
+		"10.1.2.3":  true,
+		"127.0.0.1": true,
+		"127.0.0.2": false,
+		"::1":       false,
+	}
+	for ip, want := range clients {
+		if got := acl.allowClient(&net.TCPAddr{IP: net.ParseIP(ip)}); got != want {
+			t.Fatalf("client %s: expected %v, but got %v", ip, want, got)
+		}
+	}
+	if !acl.allowClient(&net.UnixAddr{Name: "@", Net: "unix"}) {
+		t.Fatal("expected unix socket clients to be allowed")
+	}
+
+	destinations := map[string]bool{
+		"www.example.com:443":   true,
+		"WWW.example.com.:443":  true,
+		"www.example.com:80":    false,
+		"example.com:443":       false,
+		"admin.example.com:443": false,
+		"api.test:80":           true,
+		"api.test:22":           false,
+		"192.168.1.1:8080":      true,
+		"192.168.1.1:443":       false,
+		"10.0.0.1:8080":         false,
+		"other.test:8080":       true, // may be dialed at an allowed IP
+		"other.test:443":        false,
+	}
+	for hostport, want := range destinations {
+		reason := acl.checkDestination(hostport, nil)
+		if got := reason == ""; got != want {
+			t.Fatalf("destination %s: expected %v, but got %q", hostport, want, reason)
+		}
+	}
+
+	dialed := []struct {
+		hostport, address string
+		want              bool
+	}{
+		{"other.test:8080", "192.168.1.1:8080", true},
+		{"other.test:8080", "10.0.0.1:8080", false},
+		{"api.test:80", "10.0.0.1:80", true},
+		{"other.test:8080", "@", false},
+	}
+	for _, d := range dialed {
+		reason := acl.checkDialed(d.hostport, d.address)
+		if got := reason == ""; got != d.want {
+			t.Fatalf("destination %s dialed at %s: expected %v, but got %q", d.hostport, d.address, d.want, reason)
+		}
+	}
+
+	for _, invalid := range []string{"example.com:http", "example.com:9000-8000", "10.0.0.0/33", ":443"} {
+		if err := (&ACL{DenyDestinations: []string{invalid}}).compile(); err == nil {
+			t.Fatalf("expected an error of %s", invalid)
+		}
+	}
+	if err := (&ACL{ClientCIDRs: []string{"localhost"}}).compile(); err == nil {
+		t.Fatal("expected an error of the client localhost")
+	}
+}
+
+// denialsAddon collects the denials of the ACL
+type denialsAddon struct {
+	BaseAddon
+	mu      sync.Mutex
+	denials []*Denial
+}
+
+func (addon *denialsAddon) AccessDenied(d *Denial) {
+	addon.mu.Lock()
+	defer addon.mu.Unlock()
+	addon.denials = append(addon.denials, d)
+}
+
+func TestACL(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	allowedLn, err := net.Listen("tcp", "127.0.0.1:0")
+	handleError(t, err)
+	defer allowedLn.Close()
+	go (&http.Server{Handler: handler}).Serve(allowedLn)
+	deniedLn, err := net.Listen("tcp", "127.0.0.1:0")
+	handleError(t, err)
+	defer deniedLn.Close()
+	go (&http.Server{Handler: handler}).Serve(deniedLn)
+	allowedPort := strconv.Itoa(allowedLn.Addr().(*net.TCPAddr).Port)
+	deniedPort := strconv.Itoa(deniedLn.Addr().(*net.TCPAddr).Port)
+
+	ca, err := cert.New(&cert.MemoryLoader{})
+	handleError(t, err)
+	testProxy, err := NewProxy(&Options{
+		Addr: "127.0.0.1:0",
+		CA:   ca,
+		Resolver: &Resolver{Hosts: map[string]string{
+			"denied.test":           "127.0.0.1",
+			"other.test":            "10.1.1.1",
+			"internal.allowed.test": "10.2.2.2",
+		}},
+		ACL: &ACL{
+			AllowDestinations: []string{"127.0.0.1", "denied.test", "*.allowed.test"},
+			DenyDestinations:  []string{"127.0.0.1:" + deniedPort, "10.2.0.0/16"},
+		},
+	})
+	handleError(t, err)
+	denials := &denialsAddon{}
+	testProxy.AddAddon(denials)
+	handleError(t, testProxy.Listen())
+	go testProxy.Start()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: func(r *http.Request) (*url.URL, error) {
+				return url.Parse("http://" + testProxy.Addrs()[0].String())
+			},
+		},
+	}
+	testSendRequest(t, "http://127.0.0.1:"+allowedPort+"/", client, "ok")
+	for _, endpoint := range []string{
+		"http://127.0.0.1:" + deniedPort + "/",
+		"http://denied.test:" + deniedPort + "/", // resolves to the denied IP
+		"http://other.test:" + allowedPort + "/",
+		"http://internal.allowed.test:" + allowedPort + "/", // an allowed name at a denied IP
+	} {
+		resp, err := client.Get(endpoint)
+		handleError(t, err)
+		resp.Body.Close()
+		if resp.StatusCode != 403 {
+			t.Fatalf("%s: expected status 403, but got %d", endpoint, resp.StatusCode)
+		}
+	}
+	if _, err := client.Get("https://127.0.0.1:" + deniedPort + "/"); err == nil {
+		t.Fatal("expected the CONNECT to be refused")
+	}
+
+	denials.mu.Lock()
+	defer denials.mu.Unlock()
+	if len(denials.denials) != 5 {
+		t.Fatalf("expected 5 denials, but got %d", len(denials.denials))
+	}
+	if d := denials.denials[3]; d.Host != "internal.allowed.test:"+allowedPort || d.Reason != "destination denied by 10.2.0.0/16" {
+		t.Fatalf("unexpected denial of the allowed name at a denied IP %+v", d)
+	}
+	if d := denials.denials[4]; d.Method != "CONNECT" || d.Host != "127.0.0.1:"+deniedPort || d.ConnContext == nil {
+		t.Fatalf("unexpected denial of the CONNECT %+v", d)
+	}
+}
+
+// TestACLDialer checks the IP of the connections of Options.Dialer, which may resolve names otherwise.
+func TestACLDialer(t *testing.T) {
+	deniedLn, err := net.Listen("tcp", "127.0.0.1:0")
+	handleError(t, err)
+	defer deniedLn.Close()
+	go (&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})}).Serve(deniedLn)
+
+	ca, err := cert.New(&cert.MemoryLoader{})
+	handleError(t, err)
+	testProxy, err := NewProxy(&Options{
+		Addr: "127.0.0.1:0",
+		CA:   ca,
+		Dialer: DialerFunc(func(ctx context.Context, network, addr string, connCtx *ConnContext) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, deniedLn.Addr().String())
+		}),
+		ACL: &ACL{
+			AllowDestinations: []string{"allowed.test"},
+			DenyDestinations:  []string{deniedLn.Addr().String()},
+		},
+	})
+	handleError(t, err)
+	handleError(t, testProxy.Listen())
+	go testProxy.Start()
+	defer testProxy.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: func(r *http.Request) (*url.URL, error) {
+				return url.Parse("http://" + testProxy.Addrs()[0].String())
+			},
+		},
+	}
+	resp, err := client.Get("http://allowed.test/")
+	handleError(t, err)
+	resp.Body.Close()
+	if resp.StatusCode != 403 {
+		t.Fatalf("expected status 403, but got %d", resp.StatusCode)
+	}
+}
+
+// TestACLWebSocketInTunnel checks the Host of a websocket inside a CONNECT tunnel, which is dialed instead of
+// the host of the CONNECT.
+func TestACLWebSocketInTunnel(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	handleError(t, err)
+	defer ln.Close()
+	go (&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.Close()
+	})}).Serve(ln)
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	ca, err := cert.New(&cert.MemoryLoader{})
+	handleError(t, err)
+	testProxy, err := NewProxy(&Options{
+		Addr: "127.0.0.1:0",
+		CA:   ca,
+		Resolver: &Resolver{Hosts: map[string]string{
+			"allowed.test": "127.0.0.1",
+			"denied.test":  "127.0.0.1",
+		}},
+		ACL: &ACL{AllowDestinations: []string{"allowed.test"}},
+	})
+	handleError(t, err)
+	denials := &denialsAddon{}
+	testProxy.AddAddon(denials)
+	handleError(t, testProxy.Listen())
+	go testProxy.Start()
+	defer testProxy.Close()
+
+	upgrade := func(host string) int {
+		conn, err := net.Dial("tcp", testProxy.Addrs()[0].String())
+		handleError(t, err)
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+
+		_, err = fmt.Fprintf(conn, "CONNECT allowed.test:%s HTTP/1.1\r\nHost: allowed.test:%s\r\n\r\n", port, port)
+		handleError(t, err)
+		resp, err := http.ReadResponse(r, nil)
+		handleError(t, err)
+		if resp.StatusCode != 200 {
+			t.Fatalf("expected the CONNECT to be allowed, but got %d", resp.StatusCode)
+		}
+
+		_, err = fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: %s:%s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", host, port)
+		handleError(t, err)
+		resp, err = http.ReadResponse(r, nil)
+		handleError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := upgrade("allowed.test"); code != http.StatusSwitchingProtocols {
+		t.Fatalf("expected status 101, but got %d", code)
+	}
+	if code := upgrade("denied.test"); code != 403 {
+		t.Fatalf("expected status 403, but got %d", code)
+	}
+
+	denials.mu.Lock()
+	defer denials.mu.Unlock()
+	if len(denials.denials) != 1 || denials.denials[0].Host != "denied.test:"+port {
+		t.Fatalf("expected a denial of denied.test, but got %+v", denials.denials)
+	}
+}
@@ -11,12 +11,27 @@ type Addon interface {
 	// A client connection has been closed (either by us or the client).
 	ClientDisconnected(*ClientConn)
 
-	// Mitmproxy has connected to a server.
+	// A CONNECT or absolute-URL request has been refused by Options.ACL with a 403.
+	AccessDenied(*Denial)
+
+	// A server connection is about to be dialed, Dial.Addr can be rewritten to connect elsewhere.
+	// Called for every request of plain http and websocket flows, whose connections are pooled by address,
+	// and once for a CONNECT tunnel.
+	ServerDial(*Dial)
+
+	// Mitmproxy has connected to a server for a client connection, e.g. for its CONNECT tunnel.
 	ServerConnected(*ConnContext)
 
 	// A server connection has been closed (either by us or the server).
 	ServerDisconnected(*ConnContext)
 
+	// Mitmproxy has connected to a server for plain http requests. The connection is pooled and shared
+	// between client connections, Flow.ConnContext.ServerConn is set to it for the requests which use it.
+	PooledServerConnected(*ServerConn)
+
+	// A pooled server connection has been closed (either by the pool or the server).
+	PooledServerDisconnected(*ServerConn)
+
 	// The TLS handshake with the server has been completed successfully.
 	TlsEstablishedServer(*ConnContext)
 
@@ -37,15 +52,43 @@ type Addon interface {
 
 	// Stream response body modifier
 	StreamResponseModifier(*Flow, io.Reader) io.Reader
+
+	// A websocket connection has commenced, Flow.WebSocket is set.
+	WebsocketStart(*Flow)
+
+	// A websocket message has been received from the client or server.
+	// The message can be modified, or set Dropped to not forward it.
+	WebsocketMessage(*Flow, *WebSocketMessage)
+
+	// A websocket connection has ended.
+	WebsocketEnd(*Flow)
+
+	// An event of a text/event-stream response has been received.
+	// The event can be modified, or set Dropped to not forward it. Use Flow.EventStream.Inject to send new events.
+	ServerSentEvent(*Flow, *ServerSentEvent)
+
+	// A CONNECT tunnel carrying neither tls nor http has been established.
+	TcpStart(*TCPFlow)
+
+	// A chunk of data has been received from the client or server of a tcp flow.
+	// The content can be modified, or set Dropped to not forward it.
+	TcpMessage(*TCPFlow, *TCPMessage)
+
+	// A tcp flow has ended.
+	TcpEnd(*TCPFlow)
 }
 
 // BaseAddon do nothing
 type BaseAddon struct{}
 
-func (addon *BaseAddon) ClientConnected(*ClientConn)     {}
-func (addon *BaseAddon) ClientDisconnected(*ClientConn)  {}
-func (addon *BaseAddon) ServerConnected(*ConnContext)    {}
-func (addon *BaseAddon) ServerDisconnected(*ConnContext) {}
+func (addon *BaseAddon) ClientConnected(*ClientConn)          {}
+func (addon *BaseAddon) ClientDisconnected(*ClientConn)       {}
+func (addon *BaseAddon) AccessDenied(*Denial)                 {}
+func (addon *BaseAddon) ServerDial(*Dial)                     {}
+func (addon *BaseAddon) ServerConnected(*ConnContext)         {}
+func (addon *BaseAddon) ServerDisconnected(*ConnContext)      {}
+func (addon *BaseAddon) PooledServerConnected(*ServerConn)    {}
+func (addon *BaseAddon) PooledServerDisconnected(*ServerConn) {}
 
 func (addon *BaseAddon) TlsEstablishedServer(*ConnContext) {}
 
@@ -59,3 +102,13 @@ func (addon *BaseAddon) StreamRequestModifier(f *Flow, in io.Reader) io.Reader {
 func (addon *BaseAddon) StreamResponseModifier(f *Flow, in io.Reader) io.Reader {
 	return in
 }
+
+func (addon *BaseAddon) WebsocketStart(*Flow)                      {}
+func (addon *BaseAddon) WebsocketMessage(*Flow, *WebSocketMessage) {}
+func (addon *BaseAddon) WebsocketEnd(*Flow)                        {}
+
+func (addon *BaseAddon) ServerSentEvent(*Flow, *ServerSentEvent) {}
+
+func (addon *BaseAddon) TcpStart(*TCPFlow)                {}
+func (addon *BaseAddon) TcpMessage(*TCPFlow, *TCPMessage) {}
+func (addon *BaseAddon) TcpEnd(*TCPFlow)                  {}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+)
+
+// spilledBody is a body buffered in a temp file instead of memory.
+// The file is unlinked right after creation, so its disk space is released when the file is closed,
+// which is when the flow is done, see Flow.RetainBodies.
+type spilledBody struct {
+	file *os.File
+	size int64
+}
+
+func (b *spilledBody) reader() io.Reader {
+	return io.NewSectionReader(b.file, 0, b.size)
+}
+
+func (b *spilledBody) close() {
+	if err := b.file.Close(); err != nil {
+		sLogger.Warn("could not close spilled body file", "file", b.file.Name(), "error", err)
+	}
+}
+
+// spillToFile writes buf and then the rest of r to a temp file in dir, up to limit bytes in total.
+// If limit is reached, it also returns a reader of all the data read so far followed by the rest of r.
+func spillToFile(buf []byte, r io.Reader, limit int64, dir string) (*spilledBody, io.Reader, error) {
+	file, err := os.CreateTemp(dir, "mitmproxy-body-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.Remove(file.Name()); err != nil {
+		sLogger.Warn("could not unlink spilled body file", "file", file.Name(), "error", err)
+	}
+
+	written, err := io.Copy(file, io.MultiReader(bytes.NewReader(buf), io.LimitReader(r, limit-int64(len(buf)))))
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	body := &spilledBody{
+		file: file,
+		size: written,
+	}
+
+	// If limit is reached.
+	if written == limit {
+		return body, io.MultiReader(body.reader(), r), nil
+	}
+
+	return body, nil, nil
+}
+
+// decodeSpilledBody reads a spilled body from r, decoded according to the Content-Encoding of header.
+func decodeSpilledBody(header http.Header, r io.Reader) ([]byte, error) {
+	dreader, err := DecodeReader(header, r)
+	if err != nil {
+		return nil, err
+	}
+	defer dreader.Close()
+	return io.ReadAll(dreader)
+}
+
+// readBody reads r into memory up to StreamLargeBodies, or into a temp file up to SpillLargeBodies.
+// If the body is larger, it returns a reader of the whole body and the flow turns into stream model.
+// The temp file is closed when the flow is done.
+func (proxy *Proxy) readBody(f *Flow, r io.Reader) ([]byte, *spilledBody, io.Reader, error) {
+	if proxy.Opts.SpillLargeBodies <= proxy.Opts.StreamLargeBodies {
+		buf, rest, err := readerToBuffer(r, proxy.Opts.StreamLargeBodies)
+		return buf, nil, rest, err
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0))
+	_, err := io.Copy(buf, io.LimitReader(r, proxy.Opts.StreamLargeBodies))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if int64(buf.Len()) < proxy.Opts.StreamLargeBodies {
+		return buf.Bytes(), nil, nil, nil
+	}
+
+	spilled, rest, err := spillToFile(buf.Bytes(), r, proxy.Opts.SpillLargeBodies, proxy.Opts.SpillDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	f.addSpilled(spilled)
+	if rest != nil {
+		return nil, nil, rest, nil
+	}
+	return nil, spilled, nil, nil
+}
+
+// OpenBody returns a new reader of the request body, whether it is held in memory or spilled to disk.
+func (r *Request) OpenBody() io.Reader {
+	if r.Body == nil && r.spilled != nil {
+		return r.spilled.reader()
+	}
+	return bytes.NewReader(r.Body)
+}
+
+// BodySize returns the size of the request body, whether it is held in memory or spilled to disk.
+func (r *Request) BodySize() int64 {
+	if r.Body == nil && r.spilled != nil {
+		return r.spilled.size
+	}
+	return int64(len(r.Body))
+}
+
+// BodySpilled reports whether the request body is spilled to disk, Body is nil in this case.
+func (r *Request) BodySpilled() bool {
+	return r.Body == nil && r.spilled != nil
+}
+
+// OpenBody returns a new reader of the response body, whether it is held in memory or spilled to disk.
+func (r *Response) OpenBody() io.Reader {
+	if r.Body == nil && r.spilled != nil {
+		return r.spilled.reader()
+	}
+	return bytes.NewReader(r.Body)
+}
+
+// BodySize returns the size of the response body, whether it is held in memory or spilled to disk.
+func (r *Response) BodySize() int64 {
+	if r.Body == nil && r.spilled != nil {
+		return r.spilled.size
+	}
+	return int64(len(r.Body))
+}
+
+// BodySpilled reports whether the response body is spilled to disk, Body is nil in this case.
+func (r *Response) BodySpilled() bool {
+	return r.Body == nil && r.spilled != nil
+}
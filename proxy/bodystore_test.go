@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadBody(t *testing.T) {
+	proxy := &Proxy{
+		Opts: &Options{
+			StreamLargeBodies: 4,
+			SpillLargeBodies:  16,
+			SpillDir:          t.TempDir(),
+		},
+	}
+
+	t.Run("in memory", func(t *testing.T) {
+		buf, spilled, rest, err := proxy.readBody(newFlow(), strings.NewReader("abc"))
+		handleError(t, err)
+		if string(buf) != "abc" || spilled != nil || rest != nil {
+			t.Fatal("body should be buffered in memory")
+		}
+	})
+
+	t.Run("spilled", func(t *testing.T) {
+		buf, spilled, rest, err := proxy.readBody(newFlow(), strings.NewReader("hello world"))
+		handleError(t, err)
+		if buf != nil || spilled == nil || rest != nil {
+			t.Fatal("body should be spilled")
+		}
+		res := &Response{spilled: spilled}
+		if !res.BodySpilled() || res.BodySize() != 11 {
+			t.Fatal("body size error")
+		}
+		// can be read more than once
+		for i := 0; i < 2; i++ {
+			body, err := io.ReadAll(res.OpenBody())
+			handleError(t, err)
+			if string(body) != "hello world" {
+				t.Fatalf("expected hello world, but got %s", body)
+			}
+		}
+	})
+
+	t.Run("decoded", func(t *testing.T) {
+		content := strings.Repeat("hello world ", 10)
+		encoded, err := encode("gzip", []byte(content))
+		handleError(t, err)
+		// a low threshold, larger than the compressed body
+		proxy := &Proxy{Opts: &Options{StreamLargeBodies: 4, SpillLargeBodies: 1024, SpillDir: t.TempDir()}}
+		_, spilled, _, err := proxy.readBody(newFlow(), bytes.NewReader(encoded))
+		handleError(t, err)
+		res := &Response{Header: make(http.Header), spilled: spilled}
+		res.Header.Set("Content-Encoding", "gzip")
+		if !res.BodySpilled() {
+			t.Fatal("body should be spilled")
+		}
+		body, err := res.DecodedBody()
+		handleError(t, err)
+		if string(body) != content {
+			t.Fatalf("expected %s, but got %s", content, body)
+		}
+
+		_, spilled, _, err = proxy.readBody(newFlow(), strings.NewReader(content[:12]))
+		handleError(t, err)
+		req := &Request{Header: make(http.Header), spilled: spilled}
+		body, err = req.DecodedBody()
+		handleError(t, err)
+		if string(body) != content[:12] {
+			t.Fatalf("expected %s, but got %s", content[:12], body)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		content := strings.Repeat("a", 20)
+		buf, spilled, rest, err := proxy.readBody(newFlow(), strings.NewReader(content))
+		handleError(t, err)
+		if buf != nil || spilled != nil || rest == nil {
+			t.Fatal("body should turn into stream")
+		}
+		body, err := io.ReadAll(rest)
+		handleError(t, err)
+		if string(body) != content {
+			t.Fatalf("expected %s, but got %s", content, body)
+		}
+	})
+	t.Run("closed when done", func(t *testing.T) {
+		f := newFlow()
+		_, spilled, _, err := proxy.readBody(f, strings.NewReader("hello world"))
+		handleError(t, err)
+		res := &Response{spilled: spilled}
+		release := f.RetainBodies()
+		f.finish()
+		if _, err := io.ReadAll(res.OpenBody()); err != nil {
+			t.Fatalf("retained body should be readable, but got %v", err)
+		}
+		release()
+		release()
+		if _, err := io.ReadAll(res.OpenBody()); !errors.Is(err, os.ErrClosed) {
+			t.Fatalf("expected file closed, but got %v", err)
+		}
+
+		f = newFlow()
+		_, _, rest, err := proxy.readBody(f, strings.NewReader(strings.Repeat("a", 20)))
+		handleError(t, err)
+		f.finish()
+		if _, err := io.ReadAll(rest); !errors.Is(err, os.ErrClosed) {
+			t.Fatalf("expected file of stream closed, but got %v", err)
+		}
+	})
+}
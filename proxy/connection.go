@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -48,6 +49,7 @@ func (c *ClientConn) MarshalJSON() ([]byte, error) {
 type ServerConn struct {
 	ID      uuid.UUID `json:"id"`
 	Address string    `json:"address"`
+	IP      net.IP    `json:"ip"` // the IP connected to, of the upstream proxy if any
 	Conn    net.Conn  `json:"-"`
 
 	tlsHandshaked   chan struct{}
@@ -55,6 +57,7 @@ type ServerConn struct {
 	tlsConn         *tls.Conn
 	tlsState        *tls.ConnectionState
 	client          *http.Client
+	pooled          bool // shared between client connections by the upstream pool
 }
 
 func newServerConn() *ServerConn {
@@ -68,10 +71,12 @@ func (c *ServerConn) MarshalJSON() ([]byte, error) {
 	m := struct {
 		ID       uuid.UUID `json:"id"`
 		Address  string    `json:"address"`
+		IP       net.IP    `json:"ip"`
 		PeerName string    `json:"peername"`
 	}{
 		ID:       c.ID,
 		Address:  c.Address,
+		IP:       c.IP,
 		PeerName: c.Conn.LocalAddr().String(),
 	}
 	return json.Marshal(m)
@@ -92,7 +97,9 @@ type ConnContext struct {
 
 	proxy              *Proxy
 	pipeConn           *pipeConn
-	closeAfterResponse bool // after http response, http server will close the connection
+	closeAfterResponse bool        // after http response, http server will close the connection
+	requesting         atomic.Bool // a request of the tunnel is being sent, its handler replies the error when the server connection closes
+	closed             atomic.Bool
 }
 
 func newConnContext(c *wrapClientConn, proxy *Proxy) *ConnContext {
@@ -107,50 +114,26 @@ func (connCtx *ConnContext) ID() uuid.UUID {
 	return connCtx.ClientConn.ID
 }
 
-func (connCtx *ConnContext) initHttpServerConn() {
-	if connCtx.ServerConn != nil {
-		return
-	}
-	if connCtx.ClientConn.TLS {
-		return
-	}
+// Close closes the client connection, and with it the server connection.
+// Any flow still in progress on this connection is aborted.
+func (connCtx *ConnContext) Close() error {
+	connCtx.closed.Store(true)
+	return connCtx.ClientConn.Conn.Close()
+}
 
-	serverConn := newServerConn()
-	serverConn.client = &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				c, err := (&net.Dialer{}).DialContext(ctx, network, addr)
-				if err != nil {
-					return nil, err
-				}
-				cw := &wrapServerConn{
-					Conn:    c,
-					proxy:   connCtx.proxy,
-					connCtx: connCtx,
-				}
-				serverConn.Conn = cw
-				serverConn.Address = addr
-				defer func() {
-					for _, addon := range connCtx.proxy.Addons {
-						addon.ServerConnected(connCtx)
-					}
-				}()
-				return cw, nil
-			},
-			ForceAttemptHTTP2:  false, // disable http2
-			DisableCompression: true,  // To get the original response from the server, set Transport.DisableCompression to true.
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: connCtx.proxy.Opts.InsecureSkipVerifyTLS,
-				KeyLogWriter:       getTLSKeyLogWriter(),
-			},
-		},
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Disable automatic redirects.
-			return http.ErrUseLastResponse
-		},
+// Reset closes the client connection with a TCP RST instead of a FIN.
+func (connCtx *ConnContext) Reset() error {
+	if tcpConn, ok := connCtx.ClientConn.Conn.Conn.(*net.TCPConn); ok {
+		if err := tcpConn.SetLinger(0); err != nil {
+			sLogger.Debug("could not set linger", "error", err)
+		}
 	}
-	connCtx.ServerConn = serverConn
+	return connCtx.Close()
+}
+
+// Closed reports whether the client connection was closed by Close or Reset.
+func (connCtx *ConnContext) Closed() bool {
+	return connCtx.closed.Load()
 }
 
 func (connCtx *ConnContext) initServerTcpConn(_ *http.Request) error {
@@ -165,20 +148,27 @@ func (connCtx *ConnContext) initServerTcpConn(_ *http.Request) error {
 	if err != nil {
 		return err
 	}
+	proxy := connCtx.proxy
+	addr := proxy.serverDial(connCtx, nil, ServerConn.Address).Addr
 	var plainConn net.Conn
 	if proxyUrl != nil {
-		plainConn, err = getProxyConn(proxyUrl, ServerConn.Address)
+		if err := proxy.checkProxiedDestination(context.Background(), ServerConn.Address); err != nil {
+			return err
+		}
+		plainConn, err = proxy.getProxyConn(proxyUrl, addr, connCtx)
 	} else {
-		plainConn, err = (&net.Dialer{}).DialContext(context.Background(), "tcp", ServerConn.Address)
+		plainConn, err = proxy.dialDestination(context.Background(), "tcp", ServerConn.Address, addr, connCtx)
 	}
 	if err != nil {
 		return err
 	}
+	ServerConn.IP = remoteIP(plainConn)
 	ServerConn.Conn = &wrapServerConn{
 		Conn:    plainConn,
 		proxy:   connCtx.proxy,
 		connCtx: connCtx,
 	}
+	connCtx.proxy.tracker.serverConns.Add(1)
 
 	for _, addon := range connCtx.proxy.Addons {
 		addon.ServerConnected(connCtx)
@@ -189,8 +179,9 @@ func (connCtx *ConnContext) initServerTcpConn(_ *http.Request) error {
 
 // connect proxy when set https_proxy env
 // ref: http/transport.go dialConn func
-func getProxyConn(proxyUrl *url.URL, address string) (net.Conn, error) {
-	conn, err := (&net.Dialer{}).DialContext(context.Background(), "tcp", proxyUrl.Host)
+func (proxy *Proxy) getProxyConn(proxyUrl *url.URL, address string, connCtx *ConnContext) (net.Conn, error) {
+	timeouts := proxy.Opts.Timeouts
+	conn, err := proxy.dial(context.Background(), "tcp", hostPort(proxyUrl.Host, proxyUrl.Scheme == "https"), connCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -199,7 +190,7 @@ func getProxyConn(proxyUrl *url.URL, address string) (net.Conn, error) {
 		URL:    &url.URL{Opaque: address},
 		Host:   address,
 	}
-	connectCtx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	connectCtx, cancel := context.WithTimeout(context.Background(), timeouts.connectTimeout())
 	defer cancel()
 	didReadResponse := make(chan struct{}) // closed after CONNECT write+read is done or fails
 	var resp *http.Response
@@ -250,6 +241,29 @@ func (connCtx *ConnContext) initHttpsServerConn() {
 			},
 			ForceAttemptHTTP2:  false, // disable http2
 			DisableCompression: true,  // To get the original response from the server, set Transport.DisableCompression to true.
+			// relays Expect: 100-continue of streamed requests, the body is sent once the server continues
+			ExpectContinueTimeout: time.Second,
+			ResponseHeaderTimeout: connCtx.Timeouts().ResponseHeader,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// Disable automatic redirects.
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// initPlainServerConn sends plain http requests in a CONNECT tunnel through the server connection dialed for the tunnel.
+func (connCtx *ConnContext) initPlainServerConn() {
+	connCtx.ServerConn.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return connCtx.ServerConn.Conn, nil
+			},
+			ForceAttemptHTTP2:  false, // disable http2
+			DisableCompression: true,  // To get the original response from the server, set Transport.DisableCompression to true.
+			// relays Expect: 100-continue of streamed requests, the body is sent once the server continues
+			ExpectContinueTimeout: time.Second,
+			ResponseHeaderTimeout: connCtx.Timeouts().ResponseHeader,
 		},
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			// Disable automatic redirects.
@@ -282,9 +296,12 @@ func (connCtx *ConnContext) tlsHandshake(clientHello *tls.ClientHelloInfo) error
 		cfg.MaxVersion = maxVersion
 	}
 
+	ctx, cancel := withTimeout(context.Background(), connCtx.Timeouts().TLSHandshake)
+	defer cancel()
 	tlsConn := tls.Client(connCtx.ServerConn.Conn, cfg)
-	err := tlsConn.HandshakeContext(context.Background())
+	err := tlsConn.HandshakeContext(ctx)
 	if err != nil {
+		connCtx.proxy.tracker.serverTLSFailures.Add(1)
 		connCtx.ServerConn.tlsHandshakeErr = err
 		close(connCtx.ServerConn.tlsHandshaked)
 		return err
@@ -305,6 +322,20 @@ type wrapClientConn struct {
 	connCtx  *ConnContext
 	once     sync.Once
 	closeErr error
+	throttle throttle
+	done     chan struct{} // closed by Close, ends the waits of throttles
+}
+
+// Read waits for the upload limiters of ClientConn.AddThrottle after reading.
+func (c *wrapClientConn) Read(p []byte) (int, error) {
+	r := throttledReader{r: c.Conn, limiters: c.throttle.upload, done: c.done}
+	return r.Read(p)
+}
+
+// Write waits for the download limiters of ClientConn.AddThrottle before writing.
+func (c *wrapClientConn) Write(p []byte) (int, error) {
+	w := throttledWriter{w: c.Conn, limiters: c.throttle.download, done: c.done}
+	return w.Write(p)
 }
 
 // Close closes the wrapped client connection and performs necessary cleanup.
@@ -315,14 +346,16 @@ func (c *wrapClientConn) Close() error {
 
 		// Close the underlying connection and store any error that occurs.
 		c.closeErr = c.Conn.Close()
+		close(c.done)
+		c.proxy.tracker.removeConn(c)
 
 		// Notify all addons that the client has disconnected.
 		for _, addon := range c.proxy.Addons {
 			addon.ClientDisconnected(c.connCtx.ClientConn)
 		}
 
-		// If there is an active server connection, close it.
-		if c.connCtx.ServerConn != nil && c.connCtx.ServerConn.Conn != nil {
+		// If there is an active server connection, close it. Pooled connections are closed by the pool.
+		if c.connCtx.ServerConn != nil && c.connCtx.ServerConn.Conn != nil && !c.connCtx.ServerConn.pooled {
 			c.connCtx.ServerConn.Conn.Close()
 		}
 	})
@@ -341,28 +374,40 @@ func (l *wrapListener) Accept() (net.Conn, error) {
 		return nil, err
 	}
 
-	return &wrapClientConn{
+	cw := &wrapClientConn{
 		Conn:  c,
 		proxy: l.proxy,
-	}, nil
+		done:  make(chan struct{}),
+	}
+	l.proxy.tracker.addConn(cw)
+	return cw, nil
 }
 
 // wrapServerConn is a wrapper around net.Conn for a remote server connection.
 type wrapServerConn struct {
 	net.Conn
-	proxy    *Proxy
-	connCtx  *ConnContext
-	once     sync.Once
-	closeErr error
+	proxy      *Proxy
+	connCtx    *ConnContext // the client connection which dialed, nil for pooled connections
+	serverConn *ServerConn  // set for pooled connections
+	once       sync.Once
+	closeErr   error
 }
 
 // Close closes the wrapped server connection and performs necessary cleanup.
 func (c *wrapServerConn) Close() error {
 	c.once.Do(func() {
-		sLogger.Debug("in wrapServerConn close", "clientAddress", c.connCtx.ClientConn.Conn.RemoteAddr())
-
 		// Close the underlying connection and store any error that occurs.
 		c.closeErr = c.Conn.Close()
+		c.proxy.tracker.serverConns.Add(-1)
+
+		// A pooled connection is not tied to a client connection.
+		if c.connCtx == nil {
+			for _, addon := range c.proxy.Addons {
+				addon.PooledServerDisconnected(c.serverConn)
+			}
+			return
+		}
+		sLogger.Debug("in wrapServerConn close", "clientAddress", c.connCtx.ClientConn.Conn.RemoteAddr())
 
 		// Notify all addons that the server has disconnected.
 		for _, addon := range c.proxy.Addons {
@@ -378,7 +423,7 @@ func (c *wrapServerConn) Close() error {
 		}
 
 		// If the connection should not be closed after the response and there is a pipe connection, close it.
-		if !c.connCtx.closeAfterResponse && c.connCtx.pipeConn != nil {
+		if !c.connCtx.closeAfterResponse && !c.connCtx.requesting.Load() && c.connCtx.pipeConn != nil {
 			c.connCtx.pipeConn.Close()
 		}
 	})
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Dialer dials the upstream connections of the proxy, e.g. through an SSH tunnel,
+// from a specific source address, or to in-memory servers in tests.
+// addr is the host:port of the server or upstream proxy, connCtx is nil for connections dialed without a client.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string, connCtx *ConnContext) (net.Conn, error)
+}
+
+// DialerFunc is a function Dialer.
+type DialerFunc func(ctx context.Context, network, addr string, connCtx *ConnContext) (net.Conn, error)
+
+func (f DialerFunc) DialContext(ctx context.Context, network, addr string, connCtx *ConnContext) (net.Conn, error) {
+	return f(ctx, network, addr, connCtx)
+}
+
+// Dial is the server address of a ServerDial addon event.
+type Dial struct {
+	ConnContext *ConnContext
+	Flow        *Flow  // nil for CONNECT tunnels, which dial before any request
+	Host        string // host:port of the request or CONNECT
+	Addr        string // host:port to dial, Host unless rewritten by an addon
+}
+
+// dialKey is the context key of the *Dial of a request, a distinct type since
+// pointers to zero-size values like connContextKey may be equal.
+type dialKey struct{}
+
+// serverDial triggers the ServerDial addon event, returning the address to dial for host.
+func (proxy *Proxy) serverDial(connCtx *ConnContext, f *Flow, host string) *Dial {
+	d := &Dial{ConnContext: connCtx, Flow: f, Host: host, Addr: host}
+	for _, addon := range proxy.Addons {
+		addon.ServerDial(d)
+	}
+	return d
+}
+
+// dial connects to addr with Options.Dialer if set, otherwise resolving its host with Options.Resolver if set.
+// The IPs are tried in order until one connects.
+func (proxy *Proxy) dial(ctx context.Context, network, addr string, connCtx *ConnContext) (net.Conn, error) {
+	return proxy.dialControl(ctx, network, addr, connCtx, nil)
+}
+
+// dialControl is dial with the net.Dialer.Control of the connections not dialed by Options.Dialer.
+func (proxy *Proxy) dialControl(ctx context.Context, network, addr string, connCtx *ConnContext, control func(network, address string, c syscall.RawConn) error) (net.Conn, error) {
+	if proxy.Opts.Dialer != nil {
+		return proxy.Opts.Dialer.DialContext(ctx, network, addr, connCtx)
+	}
+
+	dialer := proxy.Opts.Timeouts.dialer()
+	dialer.Control = control
+	resolver := proxy.Opts.Resolver
+	if resolver == nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, ip := range ips {
+		c, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return c, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// remoteIP returns the IP of the remote address of c, nil if not a tcp connection.
+func remoteIP(c net.Conn) net.IP {
+	if addr, ok := c.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
+
+// hostPort returns host with the default port of http or https if it has none.
+func hostPort(host string, tls bool) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if tls {
+		return net.JoinHostPort(host, "443")
+	}
+	return net.JoinHostPort(host, "80")
+}
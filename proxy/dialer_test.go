@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/proxati/mitmproxy/cert"
+)
+
+func TestDialer(t *testing.T) {
+	// in-memory server
+	ln := newMiddleListener()
+	defer ln.Close()
+	go (&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pipe " + r.Host))
+	})}).Serve(ln)
+
+	dialed := make(chan string, 1)
+	ca, err := cert.New(&cert.MemoryLoader{})
+	handleError(t, err)
+	testProxy, err := NewProxy(&Options{
+		CA: ca,
+		Dialer: DialerFunc(func(ctx context.Context, network, addr string, connCtx *ConnContext) (net.Conn, error) {
+			if connCtx == nil {
+				t.Error("expected the ConnContext of the client")
+			}
+			dialed <- addr
+			client, server := net.Pipe()
+			ln.connChan <- server
+			return client, nil
+		}),
+	})
+	handleError(t, err)
+	proxyLn, err := net.Listen("tcp", "127.0.0.1:0")
+	handleError(t, err)
+	go testProxy.Serve(proxyLn)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: func(r *http.Request) (*url.URL, error) {
+				return url.Parse("http://" + proxyLn.Addr().String())
+			},
+		},
+	}
+	testSendRequest(t, "http://pipe.test/", client, "pipe pipe.test")
+	if addr := <-dialed; addr != "pipe.test:80" {
+		t.Fatalf("expected pipe.test:80, but got %s", addr)
+	}
+}
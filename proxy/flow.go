@@ -1,11 +1,13 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"net/url"
+	"sync"
 
 	"github.com/google/uuid"
 )
@@ -18,7 +20,14 @@ type Request struct {
 	Header http.Header `json:"header"`
 	Body   []byte      `json:"-"`
 
+	// Trailer is sent after a chunked body, its values are known once the body is read.
+	Trailer http.Header `json:"trailer,omitempty"`
+
 	raw *http.Request `json:"-"`
+
+	spilled     *spilledBody
+	decodedBody []byte
+	decodedErr  error
 }
 
 func newRequest(req *http.Request) *Request {
@@ -27,7 +36,9 @@ func newRequest(req *http.Request) *Request {
 		URL:    req.URL,
 		Proto:  req.Proto,
 		Header: req.Header,
-		raw:    req,
+		// the server fills the values of the same map when the body is read
+		Trailer: req.Trailer,
+		raw:     req,
 	}
 }
 
@@ -35,8 +46,17 @@ func (r *Request) Raw() *http.Request {
 	return r.raw
 }
 
+// MarshalJSON writes the URL as a string, as UnmarshalJSON reads it.
 func (req *Request) MarshalJSON() ([]byte, error) {
-	return json.Marshal(req)
+	r := make(map[string]any)
+	r["method"] = req.Method
+	r["url"] = req.URL.String()
+	r["proto"] = req.Proto
+	r["header"] = req.Header
+	if len(req.Trailer) > 0 {
+		r["trailer"] = req.Trailer
+	}
+	return json.Marshal(r)
 }
 
 func (req *Request) UnmarshalJSON(data []byte) error {
@@ -94,8 +114,12 @@ type Response struct {
 	Body       []byte      `json:"-"`
 	BodyReader io.Reader
 
+	// Trailer is sent after a chunked body, its values are known once the body is read.
+	Trailer http.Header `json:"trailer,omitempty"`
+
 	close bool // connection close
 
+	spilled     *spilledBody
 	decodedBody []byte
 	decoded     bool // decoded reports whether the response was sent compressed but was decoded to decodedBody.
 	decodedErr  error
@@ -112,13 +136,119 @@ type Flow struct {
 	// 如果为 true，则不缓冲 Request.Body 和 Response.Body，且不进入之后的 Addon.Request 和 Addon.Response
 	Stream bool
 
+	// Set after a websocket upgrade.
+	WebSocket *WebSocket
+
+	// Set when a text/event-stream response is streamed, which is the default for such responses.
+	EventStream *EventStream
+
+	// Metadata lets addons attach their own data to the flow, e.g. one addon tags flows that another acts on.
+	Metadata *Metadata
+
 	done chan struct{}
+
+	mu            sync.Mutex
+	marked        bool
+	comment       string
+	killed        bool
+	informational []*InformationalResponse
+	err           error
+	cancel        context.CancelFunc // cancels the upstream request
+	throttle      throttle
+	spilled       []*spilledBody // closed when bodyRefs drops to 0
+	bodyRefs      int            // 1 until the flow is done, plus the RetainBodies not released
 }
 
 func newFlow() *Flow {
 	return &Flow{
-		Id:   uuid.New(),
-		done: make(chan struct{}),
+		Id:       uuid.New(),
+		Metadata: newMetadata(),
+		done:     make(chan struct{}),
+		bodyRefs: 1,
+	}
+}
+
+// Error returns the first error which ended the flow, e.g. a dial or response header timeout, nil if none.
+// Timeouts are net.Error with Timeout() true or os.ErrDeadlineExceeded.
+func (f *Flow) Error() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *Flow) setError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+// Marked reports whether the flow was marked by the user or an addon.
+func (f *Flow) Marked() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.marked
+}
+
+func (f *Flow) SetMarked(marked bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.marked = marked
+}
+
+// Comment returns the user comment of the flow.
+func (f *Flow) Comment() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.comment
+}
+
+func (f *Flow) SetComment(comment string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.comment = comment
+}
+
+// Kill aborts the flow: the upstream request is cancelled and the client connection is reset.
+// It can be called from any addon hook, including from inside a stream modifier reader.
+func (f *Flow) Kill() {
+	f.mu.Lock()
+	if f.killed {
+		f.mu.Unlock()
+		return
+	}
+	f.killed = true
+	cancel := f.cancel
+	f.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	if f.ConnContext != nil {
+		if err := f.ConnContext.Reset(); err != nil {
+			sLogger.Debug("could not reset client connection", "error", err)
+		}
+	}
+}
+
+// Killed reports whether the flow has been killed, or its client connection closed.
+func (f *Flow) Killed() bool {
+	f.mu.Lock()
+	killed := f.killed
+	f.mu.Unlock()
+	if killed {
+		return true
+	}
+	return f.ConnContext != nil && f.ConnContext.Closed()
+}
+
+func (f *Flow) setCancel(cancel context.CancelFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancel = cancel
+	if f.killed {
+		cancel()
 	}
 }
 
@@ -128,6 +258,35 @@ func (f *Flow) Done() <-chan struct{} {
 
 func (f *Flow) finish() {
 	close(f.done)
+	f.releaseBodies()
+}
+
+// RetainBodies keeps the bodies spilled to disk readable after the flow is done, until release is called.
+// Addons which read them after Done, e.g. the Dumper, call it before the flow is done.
+func (f *Flow) RetainBodies() (release func()) {
+	f.mu.Lock()
+	f.bodyRefs++
+	f.mu.Unlock()
+	return sync.OnceFunc(f.releaseBodies)
+}
+
+func (f *Flow) releaseBodies() {
+	f.mu.Lock()
+	f.bodyRefs--
+	var spilled []*spilledBody
+	if f.bodyRefs <= 0 {
+		spilled, f.spilled = f.spilled, nil
+	}
+	f.mu.Unlock()
+	for _, b := range spilled {
+		b.close()
+	}
+}
+
+func (f *Flow) addSpilled(b *spilledBody) {
+	f.mu.Lock()
+	f.spilled = append(f.spilled, b)
+	f.mu.Unlock()
 }
 
 func (f *Flow) MarshalJSON() ([]byte, error) {
@@ -135,5 +294,20 @@ func (f *Flow) MarshalJSON() ([]byte, error) {
 	j["id"] = f.Id
 	j["request"] = f.Request
 	j["response"] = f.Response
+	j["marked"] = f.Marked()
+	j["comment"] = f.Comment()
+	j["metadata"] = f.Metadata
+	if f.WebSocket != nil {
+		j["websocket"] = f.WebSocket
+	}
+	if informational := f.Informational(); len(informational) > 0 {
+		j["informational"] = informational
+	}
+	if err := f.Error(); err != nil {
+		j["error"] = err.Error()
+	}
+	if f.EventStream != nil {
+		j["eventStream"] = f.EventStream
+	}
 	return json.Marshal(j)
 }
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRequestJSON(t *testing.T) {
+	u, _ := url.Parse("https://example.com/a?x=1")
+	req := &Request{
+		Method:  "POST",
+		URL:     u,
+		Proto:   "HTTP/1.1",
+		Header:  http.Header{"Content-Type": {"application/json"}},
+		Body:    []byte("{}"),
+		Trailer: http.Header{"Grpc-Status": {"0"}},
+	}
+	data, err := json.Marshal(&Flow{Request: req, Metadata: newMetadata()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var j struct {
+		Request map[string]any `json:"request"`
+	}
+	if err := json.Unmarshal(data, &j); err != nil {
+		t.Fatal(err)
+	}
+	if j.Request["url"] != "https://example.com/a?x=1" || j.Request["body"] != nil || j.Request["trailer"] == nil {
+		t.Fatalf("unexpected request json %s", data)
+	}
+
+	data, err = json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(Request)
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Method != "POST" || got.URL.String() != u.String() || got.Proto != "HTTP/1.1" || got.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected request %+v", got)
+	}
+}
@@ -1,15 +1,20 @@
 package proxy
 
 import (
+	"bufio"
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"errors"
 	"io"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
 var errEncodingNotSupport = errors.New("content-encoding not support")
@@ -33,7 +38,13 @@ func (r *Response) IsTextContentType() bool {
 	return false
 }
 
-func (r *Response) DecodedBody() ([]byte, error) {
+// DecodedBody returns the request body decoded according to Content-Encoding.
+// A body spilled to disk is read into memory on each call, it is not kept.
+func (r *Request) DecodedBody() ([]byte, error) {
+	if r.BodySpilled() {
+		return decodeSpilledBody(r.Header, r.OpenBody())
+	}
+
 	if r.decodedBody != nil {
 		return r.decodedBody, nil
 	}
@@ -42,22 +53,65 @@ func (r *Response) DecodedBody() ([]byte, error) {
 		return nil, r.decodedErr
 	}
 
-	if r.Body == nil {
-		return nil, nil
+	decodedBody, _, decodedErr := decodeBody(r.Header, r.Body)
+	if decodedErr != nil {
+		r.decodedErr = decodedErr
+		sLogger.Error("decoding error", "error", r.decodedErr)
+		return nil, decodedErr
 	}
 
-	if len(r.Body) == 0 {
-		r.decodedBody = r.Body
-		return r.decodedBody, nil
+	r.decodedBody = decodedBody
+	return r.decodedBody, nil
+}
+
+// SetDecodedBody sets the request body from its decoded form,
+// re-encoding it with the original Content-Encoding and fixing Content-Length.
+func (r *Request) SetDecodedBody(body []byte) error {
+	encodedBody, err := encodeBody(r.Header, body)
+	if err != nil {
+		return err
+	}
+
+	r.Body = encodedBody
+	r.decodedBody = body
+	r.decodedErr = nil
+	r.Header.Set("Content-Length", strconv.Itoa(len(encodedBody)))
+	r.Header.Del("Transfer-Encoding")
+	return nil
+}
+
+func (r *Request) ReplaceToDecodedBody() {
+	// a body spilled to disk is not moved into memory
+	if r.BodySpilled() {
+		return
+	}
+	body, err := r.DecodedBody()
+	if err != nil || body == nil {
+		return
+	}
+
+	r.Body = body
+	r.Header.Del("Content-Encoding")
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	r.Header.Del("Transfer-Encoding")
+}
+
+// DecodedBody returns the response body decoded according to Content-Encoding.
+// A body spilled to disk is read into memory on each call, it is not kept.
+func (r *Response) DecodedBody() ([]byte, error) {
+	if r.BodySpilled() {
+		return decodeSpilledBody(r.Header, r.OpenBody())
 	}
 
-	enc := r.Header.Get("Content-Encoding")
-	if enc == "" || enc == "identity" {
-		r.decodedBody = r.Body
+	if r.decodedBody != nil {
 		return r.decodedBody, nil
 	}
 
-	decodedBody, decodedErr := decode(enc, r.Body)
+	if r.decodedErr != nil {
+		return nil, r.decodedErr
+	}
+
+	decodedBody, decoded, decodedErr := decodeBody(r.Header, r.Body)
 	if decodedErr != nil {
 		r.decodedErr = decodedErr
 		sLogger.Error("decoding error", "error", r.decodedErr)
@@ -65,11 +119,32 @@ func (r *Response) DecodedBody() ([]byte, error) {
 	}
 
 	r.decodedBody = decodedBody
-	r.decoded = true
+	r.decoded = decoded
 	return r.decodedBody, nil
 }
 
+// SetDecodedBody sets the response body from its decoded form,
+// re-encoding it with the original Content-Encoding and fixing Content-Length,
+// so the client still receives a compressed response.
+func (r *Response) SetDecodedBody(body []byte) error {
+	encodedBody, err := encodeBody(r.Header, body)
+	if err != nil {
+		return err
+	}
+
+	r.Body = encodedBody
+	r.decodedBody = body
+	r.decodedErr = nil
+	r.Header.Set("Content-Length", strconv.Itoa(len(encodedBody)))
+	r.Header.Del("Transfer-Encoding")
+	return nil
+}
+
 func (r *Response) ReplaceToDecodedBody() {
+	// a body spilled to disk is not moved into memory
+	if r.BodySpilled() {
+		return
+	}
 	body, err := r.DecodedBody()
 	if err != nil || body == nil {
 		return
@@ -81,39 +156,193 @@ func (r *Response) ReplaceToDecodedBody() {
 	r.Header.Del("Transfer-Encoding")
 }
 
-func decode(enc string, body []byte) ([]byte, error) {
-	if enc == "gzip" {
-		dreader, err := gzip.NewReader(bytes.NewReader(body))
-		if err != nil {
-			return nil, err
+// decodeBody decodes body according to the Content-Encoding of header.
+// decoded reports whether body was sent compressed.
+func decodeBody(header http.Header, body []byte) (decodedBody []byte, decoded bool, err error) {
+	if body == nil {
+		return nil, false, nil
+	}
+
+	if len(body) == 0 {
+		return body, false, nil
+	}
+
+	enc := contentEncoding(header)
+	if len(parseEncodings(enc)) == 0 {
+		return body, false, nil
+	}
+
+	decodedBody, err = decode(enc, body)
+	if err != nil {
+		return nil, false, err
+	}
+	return decodedBody, true, nil
+}
+
+// encodeBody encodes body according to the Content-Encoding of header.
+func encodeBody(header http.Header, body []byte) ([]byte, error) {
+	if header == nil {
+		return body, nil
+	}
+
+	enc := contentEncoding(header)
+	if len(parseEncodings(enc)) == 0 || len(body) == 0 {
+		return body, nil
+	}
+
+	return encode(enc, body)
+}
+
+// contentEncoding returns all Content-Encoding header values joined with comma.
+func contentEncoding(header http.Header) string {
+	return strings.Join(header.Values("Content-Encoding"), ",")
+}
+
+// parseEncodings splits comma-separated content codings, in the order they were applied.
+// "identity" is omitted.
+func parseEncodings(enc string) []string {
+	encs := make([]string, 0)
+	for _, e := range strings.Split(enc, ",") {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" || e == "identity" {
+			continue
 		}
-		buf := bytes.NewBuffer(make([]byte, 0))
-		_, err = io.Copy(buf, dreader)
+		encs = append(encs, e)
+	}
+	return encs
+}
+
+// decode body encoded with the codings listed in enc, the last applied is removed first.
+func decode(enc string, body []byte) ([]byte, error) {
+	encs := parseEncodings(enc)
+	for i := len(encs) - 1; i >= 0; i-- {
+		var err error
+		body, err = decodeOne(encs[i], body)
 		if err != nil {
 			return nil, err
 		}
-		err = dreader.Close()
+	}
+	return body, nil
+}
+
+// encode body with the codings listed in enc, in order.
+func encode(enc string, body []byte) ([]byte, error) {
+	for _, e := range parseEncodings(enc) {
+		var err error
+		body, err = encodeOne(e, body)
 		if err != nil {
 			return nil, err
 		}
-		return buf.Bytes(), nil
-	} else if enc == "br" {
-		dreader := brotli.NewReader(bytes.NewReader(body))
-		buf := bytes.NewBuffer(make([]byte, 0))
-		_, err := io.Copy(buf, dreader)
-		if err != nil {
-			return nil, err
+	}
+	return body, nil
+}
+
+func decodeOne(enc string, body []byte) ([]byte, error) {
+	if enc == "zstd" {
+		return getZstdDecoder().DecodeAll(body, nil)
+	}
+
+	dreader, err := newDecodeReader(enc, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0))
+	_, err = io.Copy(buf, dreader)
+	if err != nil {
+		return nil, err
+	}
+	err = dreader.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeOne(enc string, body []byte) ([]byte, error) {
+	if enc == "zstd" {
+		return getZstdEncoder().EncodeAll(body, nil), nil
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0))
+	ewriter, err := newEncodeWriter(enc, buf)
+	if err != nil {
+		return nil, err
+	}
+	_, err = ewriter.Write(body)
+	if err != nil {
+		return nil, err
+	}
+	err = ewriter.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// newDecodeReader returns a reader decompressing r with a single content coding.
+func newDecodeReader(enc string, r io.Reader) (io.ReadCloser, error) {
+	switch enc {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case "deflate":
+		// "deflate" should be zlib-wrapped (RFC 1950), but some servers send raw DEFLATE (RFC 1951).
+		br := bufio.NewReader(r)
+		header, err := br.Peek(2)
+		if err == nil && isZlibHeader(header) {
+			return zlib.NewReader(br)
 		}
-		return buf.Bytes(), nil
-	} else if enc == "deflate" {
-		dreader := flate.NewReader(bytes.NewReader(body))
-		buf := bytes.NewBuffer(make([]byte, 0))
-		_, err := io.Copy(buf, dreader)
+		return flate.NewReader(br), nil
+	case "zstd":
+		dreader, err := zstd.NewReader(r)
 		if err != nil {
 			return nil, err
 		}
-		return buf.Bytes(), nil
+		return dreader.IOReadCloser(), nil
 	}
+	return nil, errEncodingNotSupport
+}
 
+// newEncodeWriter returns a writer compressing to w with a single content coding.
+func newEncodeWriter(enc string, w io.Writer) (io.WriteCloser, error) {
+	switch enc {
+	case "gzip", "x-gzip":
+		return gzip.NewWriter(w), nil
+	case "br":
+		return brotli.NewWriter(w), nil
+	case "deflate":
+		return zlib.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	}
 	return nil, errEncodingNotSupport
 }
+
+// https://www.rfc-editor.org/rfc/rfc1950#section-2.2
+func isZlibHeader(b []byte) bool {
+	cmf, flg := b[0], b[1]
+	return cmf&0x0f == 8 && cmf>>4 <= 7 && (uint16(cmf)<<8|uint16(flg))%31 == 0
+}
+
+// zstd encoder and decoder are safe for concurrent use by EncodeAll/DecodeAll.
+var (
+	zstdDecoder     *zstd.Decoder
+	zstdDecoderOnce sync.Once
+	zstdEncoder     *zstd.Encoder
+	zstdEncoderOnce sync.Once
+)
+
+func getZstdDecoder() *zstd.Decoder {
+	zstdDecoderOnce.Do(func() {
+		zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+	return zstdDecoder
+}
+
+func getZstdEncoder() *zstd.Encoder {
+	zstdEncoderOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+	})
+	return zstdEncoder
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	body := []byte("hello world, hello world, hello world")
+	for _, enc := range []string{"gzip", "br", "deflate", "zstd", "gzip, br", "identity", "deflate,zstd"} {
+		t.Run(enc, func(t *testing.T) {
+			encoded, err := encode(enc, body)
+			handleError(t, err)
+			decoded, err := decode(enc, encoded)
+			handleError(t, err)
+			if string(decoded) != string(body) {
+				t.Fatalf("expected %s, but got %s", body, decoded)
+			}
+		})
+	}
+}
+
+func TestDecodeStackedEncodings(t *testing.T) {
+	body := []byte("hello world")
+	gzipped, err := encode("gzip", body)
+	handleError(t, err)
+	stacked, err := encode("br", gzipped)
+	handleError(t, err)
+
+	decoded, err := decode("gzip, br", stacked)
+	handleError(t, err)
+	if string(decoded) != string(body) {
+		t.Fatalf("expected %s, but got %s", body, decoded)
+	}
+
+	header := make(http.Header)
+	header.Add("Content-Encoding", "gzip")
+	header.Add("Content-Encoding", "br")
+	decoded, _, err = decodeBody(header, stacked)
+	handleError(t, err)
+	if string(decoded) != string(body) {
+		t.Fatalf("expected %s, but got %s", body, decoded)
+	}
+
+	_, err = decode("compress", body)
+	if err != errEncodingNotSupport {
+		t.Fatalf("expected errEncodingNotSupport, but got %v", err)
+	}
+}
+
+func TestDecodeRawDeflate(t *testing.T) {
+	body := []byte("hello world")
+	buf := bytes.NewBuffer(make([]byte, 0))
+	fwriter, err := flate.NewWriter(buf, flate.DefaultCompression)
+	handleError(t, err)
+	_, err = fwriter.Write(body)
+	handleError(t, err)
+	handleError(t, fwriter.Close())
+
+	decoded, err := decode("deflate", buf.Bytes())
+	handleError(t, err)
+	if string(decoded) != string(body) {
+		t.Fatalf("expected %s, but got %s", body, decoded)
+	}
+}
+
+func TestSetDecodedBody(t *testing.T) {
+	header := make(http.Header)
+	header.Set("Content-Encoding", "gzip")
+	encoded, err := encode("gzip", []byte("hello"))
+	handleError(t, err)
+
+	t.Run("request", func(t *testing.T) {
+		req := &Request{Header: header.Clone(), Body: encoded}
+		body, err := req.DecodedBody()
+		handleError(t, err)
+		if string(body) != "hello" {
+			t.Fatalf("expected hello, but got %s", body)
+		}
+
+		handleError(t, req.SetDecodedBody([]byte("hello world")))
+		if req.Header.Get("Content-Encoding") != "gzip" {
+			t.Fatal("should keep Content-Encoding")
+		}
+		if req.Header.Get("Content-Length") != strconv.Itoa(len(req.Body)) {
+			t.Fatal("Content-Length should match encoded body")
+		}
+		decoded, err := decode("gzip", req.Body)
+		handleError(t, err)
+		if string(decoded) != "hello world" {
+			t.Fatalf("expected hello world, but got %s", decoded)
+		}
+	})
+
+	t.Run("response", func(t *testing.T) {
+		res := &Response{Header: header.Clone(), Body: encoded}
+		handleError(t, res.SetDecodedBody([]byte("hello world")))
+		body, err := res.DecodedBody()
+		handleError(t, err)
+		if string(body) != "hello world" {
+			t.Fatalf("expected hello world, but got %s", body)
+		}
+		if res.Header.Get("Content-Length") != strconv.Itoa(len(res.Body)) {
+			t.Fatal("Content-Length should match encoded body")
+		}
+	})
+}
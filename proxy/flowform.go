@@ -0,0 +1,361 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+var (
+	errNotForm          = errors.New("content-type is not application/x-www-form-urlencoded")
+	errNotMultipartForm = errors.New("content-type is not multipart")
+)
+
+// MultipartPart is a part of a multipart body, e.g. a field or a file of a multipart/form-data form.
+type MultipartPart struct {
+	Name     string               // form field name
+	FileName string               // empty if the part is not a file
+	Header   textproto.MIMEHeader // part headers, e.g. Content-Type, Content-Disposition is rewritten with Name and FileName
+	Content  []byte
+}
+
+// Query returns the parsed query of the request url.
+func (r *Request) Query() url.Values {
+	return r.URL.Query()
+}
+
+// SetQuery replaces the query of the request url.
+func (r *Request) SetQuery(query url.Values) {
+	r.URL.RawQuery = query.Encode()
+}
+
+// Form returns the fields of an application/x-www-form-urlencoded request body.
+func (r *Request) Form() (url.Values, error) {
+	return parseForm(r.Header, r.DecodedBody)
+}
+
+// SetForm replaces the request body with the urlencoded form,
+// keeping the Content-Encoding and fixing Content-Length.
+func (r *Request) SetForm(form url.Values) error {
+	setFormContentType(r.Header)
+	return r.SetDecodedBody([]byte(form.Encode()))
+}
+
+// MultipartForm returns the parts of a multipart request body.
+func (r *Request) MultipartForm() ([]*MultipartPart, error) {
+	return parseMultipart(r.Header, r.DecodedBody)
+}
+
+// SetMultipartForm replaces the request body with the parts, keeping the boundary of Content-Type if any,
+// keeping the Content-Encoding and fixing Content-Length.
+func (r *Request) SetMultipartForm(parts []*MultipartPart) error {
+	body, err := encodeMultipart(r.Header, parts)
+	if err != nil {
+		return err
+	}
+	return r.SetDecodedBody(body)
+}
+
+// Cookies returns the cookies of the Cookie header.
+func (r *Request) Cookies() []*http.Cookie {
+	return (&http.Request{Header: r.Header}).Cookies()
+}
+
+// Cookie returns the cookie of name, nil if not found.
+func (r *Request) Cookie(name string) *http.Cookie {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// SetCookie sets the value of the cookie of name, adding it if not found.
+// The other cookies of the Cookie header are kept as they are, even if they can not be parsed.
+func (r *Request) SetCookie(name, value string) {
+	pair := (&http.Cookie{Name: name, Value: value}).String()
+	if r.editCookies(name, pair) {
+		return
+	}
+	values := r.Header.Values("Cookie")
+	if len(values) == 0 {
+		r.Header.Set("Cookie", pair)
+		return
+	}
+	values = append(slices.Clone(values[:len(values)-1]), values[len(values)-1]+"; "+pair)
+	r.setCookieHeaders(values)
+}
+
+// DelCookie removes the cookie of name, the other cookies of the Cookie header are kept as they are.
+func (r *Request) DelCookie(name string) {
+	r.editCookies(name, "")
+}
+
+// editCookies replaces the name=value pairs of name in the Cookie headers by pair, or removes them if pair is empty.
+// The other pairs are not parsed, so they are kept byte for byte. It reports whether any pair of name was found.
+func (r *Request) editCookies(name string, pair string) bool {
+	found := false
+	values := make([]string, 0)
+	for _, line := range r.Header.Values("Cookie") {
+		pairs := make([]string, 0)
+		for _, p := range strings.Split(line, ";") {
+			p = textproto.TrimString(p)
+			if p == "" {
+				continue
+			}
+			if pName, _, _ := strings.Cut(p, "="); textproto.TrimString(pName) == name {
+				found = true
+				if pair == "" {
+					continue
+				}
+				p = pair
+			}
+			pairs = append(pairs, p)
+		}
+		if len(pairs) > 0 {
+			values = append(values, strings.Join(pairs, "; "))
+		}
+	}
+	if found {
+		r.setCookieHeaders(values)
+	}
+	return found
+}
+
+func (r *Request) setCookieHeaders(values []string) {
+	r.Header.Del("Cookie")
+	for _, v := range values {
+		r.Header.Add("Cookie", v)
+	}
+}
+
+// Form returns the fields of an application/x-www-form-urlencoded response body.
+func (r *Response) Form() (url.Values, error) {
+	return parseForm(r.Header, r.DecodedBody)
+}
+
+// SetForm replaces the response body with the urlencoded form,
+// keeping the Content-Encoding and fixing Content-Length.
+func (r *Response) SetForm(form url.Values) error {
+	setFormContentType(r.Header)
+	return r.SetDecodedBody([]byte(form.Encode()))
+}
+
+// MultipartForm returns the parts of a multipart response body.
+func (r *Response) MultipartForm() ([]*MultipartPart, error) {
+	return parseMultipart(r.Header, r.DecodedBody)
+}
+
+// SetMultipartForm replaces the response body with the parts, keeping the boundary of Content-Type if any,
+// keeping the Content-Encoding and fixing Content-Length.
+func (r *Response) SetMultipartForm(parts []*MultipartPart) error {
+	body, err := encodeMultipart(r.Header, parts)
+	if err != nil {
+		return err
+	}
+	return r.SetDecodedBody(body)
+}
+
+// Cookies returns the cookies of the Set-Cookie headers, with their attributes.
+func (r *Response) Cookies() []*http.Cookie {
+	return (&http.Response{Header: r.Header}).Cookies()
+}
+
+// Cookie returns the cookie of name set by the response, nil if not found.
+func (r *Response) Cookie(name string) *http.Cookie {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// SetCookie replaces the Set-Cookie header of the cookie with the same name, path and domain, or adds one.
+// Invalid cookies are not added, same as http.SetCookie.
+func (r *Response) SetCookie(cookie *http.Cookie) {
+	value := cookie.String()
+	if value == "" {
+		return
+	}
+
+	values := r.Header.Values("Set-Cookie")
+	newValues := make([]string, 0, len(values)+1)
+	replaced := false
+	for _, v := range values {
+		if c, err := http.ParseSetCookie(v); err == nil && sameCookie(c, cookie) {
+			if !replaced {
+				newValues = append(newValues, value)
+				replaced = true
+			}
+			continue
+		}
+		newValues = append(newValues, v)
+	}
+	if !replaced {
+		newValues = append(newValues, value)
+	}
+	r.Header["Set-Cookie"] = newValues
+}
+
+// DelCookie removes the Set-Cookie headers of name. To make the client delete a cookie,
+// use SetCookie with MaxAge -1 instead.
+func (r *Response) DelCookie(name string) {
+	values := r.Header.Values("Set-Cookie")
+	kept := make([]string, 0, len(values))
+	for _, v := range values {
+		if c, err := http.ParseSetCookie(v); err == nil && c.Name == name {
+			continue
+		}
+		kept = append(kept, v)
+	}
+	if len(kept) == 0 {
+		r.Header.Del("Set-Cookie")
+		return
+	}
+	r.Header["Set-Cookie"] = kept
+}
+
+func sameCookie(a, b *http.Cookie) bool {
+	return a.Name == b.Name && a.Path == b.Path && strings.EqualFold(a.Domain, b.Domain)
+}
+
+func parseForm(header http.Header, decodedBody func() ([]byte, error)) (url.Values, error) {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return nil, errNotForm
+	}
+	body, err := decodedBody()
+	if err != nil {
+		return nil, err
+	}
+	return url.ParseQuery(string(body))
+}
+
+func setFormContentType(header http.Header) {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" {
+		header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+}
+
+func parseMultipart(header http.Header, decodedBody func() ([]byte, error)) ([]*MultipartPart, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return nil, errNotMultipartForm
+	}
+	body, err := decodedBody()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	parts := make([]*MultipartPart, 0)
+	for {
+		// raw part keeps the Content-Transfer-Encoding as is
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, &MultipartPart{
+			Name:     part.FormName(),
+			FileName: part.FileName(),
+			Header:   part.Header,
+			Content:  content,
+		})
+	}
+	return parts, nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// partDisposition returns the Content-Disposition of p with its Name and FileName,
+// keeping the disposition type and other parameters of its header, form-data if it has none.
+func partDisposition(p *MultipartPart) string {
+	dispType, params := "form-data", map[string]string{}
+	if d := p.Header.Get("Content-Disposition"); d != "" {
+		if t, ps, err := mime.ParseMediaType(d); err == nil {
+			dispType, params = t, ps
+		}
+	}
+
+	// Name is only read from form-data dispositions, see multipart.Part.FormName
+	if dispType == "form-data" || p.Name != "" {
+		params["name"] = p.Name
+	}
+	delete(params, "filename")
+	if p.FileName != "" {
+		params["filename"] = p.FileName
+	}
+
+	// name and filename first, as browsers write them
+	disposition := dispType
+	for _, k := range []string{"name", "filename"} {
+		if v, ok := params[k]; ok {
+			disposition += fmt.Sprintf(`; %s="%s"`, k, quoteEscaper.Replace(v))
+			delete(params, k)
+		}
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		disposition += fmt.Sprintf(`; %s="%s"`, k, quoteEscaper.Replace(params[k]))
+	}
+	return disposition
+}
+
+// encodeMultipart encodes parts with the boundary of header, setting Content-Type to multipart/form-data
+// with a new boundary if header is not multipart.
+func encodeMultipart(header http.Header, parts []*MultipartPart) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writer := multipart.NewWriter(buf)
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		if err := writer.SetBoundary(params["boundary"]); err != nil {
+			return nil, err
+		}
+	} else {
+		header.Set("Content-Type", writer.FormDataContentType())
+	}
+
+	for _, p := range parts {
+		partHeader := make(textproto.MIMEHeader, len(p.Header)+1)
+		for k, v := range p.Header {
+			partHeader[k] = v
+		}
+		if p.Name != "" || p.FileName != "" {
+			partHeader.Set("Content-Disposition", partDisposition(p))
+		}
+		w, err := writer.CreatePart(partHeader)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(p.Content); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
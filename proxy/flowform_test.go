@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRequestForm(t *testing.T) {
+	req := &Request{Header: http.Header{}, URL: &url.URL{RawQuery: "a=1&b=2"}}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	query := req.Query()
+	query.Set("a", "x y")
+	req.SetQuery(query)
+	if req.URL.RawQuery != "a=x+y&b=2" {
+		t.Fatalf("unexpected query %s", req.URL.RawQuery)
+	}
+
+	handleError(t, req.SetForm(url.Values{"name": {"go"}}))
+	if req.Header.Get("Content-Length") != strconv.Itoa(len(req.Body)) {
+		t.Fatal("Content-Length should match the encoded body")
+	}
+	form, err := req.Form()
+	handleError(t, err)
+	if form.Get("name") != "go" {
+		t.Fatalf("unexpected form %v", form)
+	}
+
+	req.Header.Set("Content-Type", "text/plain")
+	if _, err := req.Form(); err == nil {
+		t.Fatal("expected error for non form body")
+	}
+}
+
+func TestMultipartForm(t *testing.T) {
+	res := &Response{Header: http.Header{}}
+	parts := []*MultipartPart{
+		{Name: "field", Content: []byte("value")},
+		{Name: "file", FileName: "a.txt", Header: textproto.MIMEHeader{"Content-Type": {"text/plain"}}, Content: []byte("content")},
+	}
+	handleError(t, res.SetMultipartForm(parts))
+	contentType := res.Header.Get("Content-Type")
+
+	got, err := res.MultipartForm()
+	handleError(t, err)
+	if len(got) != 2 || got[0].Name != "field" || string(got[0].Content) != "value" ||
+		got[1].FileName != "a.txt" || got[1].Header.Get("Content-Type") != "text/plain" || string(got[1].Content) != "content" {
+		t.Fatalf("unexpected parts %+v %+v", got[0], got[1])
+	}
+
+	// boundary is kept
+	got[0].Content = []byte("changed")
+	handleError(t, res.SetMultipartForm(got))
+	if res.Header.Get("Content-Type") != contentType {
+		t.Fatal("boundary should be kept")
+	}
+	got, err = res.MultipartForm()
+	handleError(t, err)
+	if string(got[0].Content) != "changed" {
+		t.Fatalf("unexpected content %s", got[0].Content)
+	}
+}
+
+func TestMultipartDisposition(t *testing.T) {
+	res := &Response{Header: http.Header{}}
+	res.Header.Set("Content-Type", `multipart/mixed; boundary="b"`)
+	parts := []*MultipartPart{
+		{FileName: "a.txt", Header: textproto.MIMEHeader{"Content-Disposition": {`attachment; filename="old.txt"; size="7"`}}, Content: []byte("content")},
+		{Name: "field", Content: []byte("value")},
+	}
+	handleError(t, res.SetMultipartForm(parts))
+	for _, want := range []string{`Content-Disposition: attachment; filename="a.txt"; size="7"`, `Content-Disposition: form-data; name="field"`} {
+		if !strings.Contains(string(res.Body), want) {
+			t.Fatalf("expected %s in %s", want, res.Body)
+		}
+	}
+
+	got, err := res.MultipartForm()
+	handleError(t, err)
+	handleError(t, res.SetMultipartForm(got))
+	if !strings.Contains(string(res.Body), `Content-Disposition: attachment; filename="a.txt"; size="7"`) {
+		t.Fatalf("disposition should be kept, got %s", res.Body)
+	}
+}
+
+func TestCookies(t *testing.T) {
+	req := &Request{Header: http.Header{}}
+	req.Header.Set("Cookie", "a=1; b=2")
+	req.SetCookie("a", "3")
+	req.SetCookie("c", "4")
+	req.DelCookie("b")
+	if req.Header.Get("Cookie") != "a=3; c=4" {
+		t.Fatalf("unexpected Cookie %s", req.Header.Get("Cookie"))
+	}
+	if c := req.Cookie("c"); c == nil || c.Value != "4" {
+		t.Fatal("cookie c not found")
+	}
+
+	// the cookies which can not be parsed are kept as they are
+	req.Header.Set("Cookie", `bad cookie="x y"; a=1; q="quoted"`)
+	req.SetCookie("a", "2")
+	if req.Header.Get("Cookie") != `bad cookie="x y"; a=2; q="quoted"` {
+		t.Fatalf("unexpected Cookie %s", req.Header.Get("Cookie"))
+	}
+	req.DelCookie("a")
+	req.SetCookie("n", "1")
+	if req.Header.Get("Cookie") != `bad cookie="x y"; q="quoted"; n=1` {
+		t.Fatalf("unexpected Cookie %s", req.Header.Get("Cookie"))
+	}
+
+	res := &Response{Header: http.Header{}}
+	res.Header.Add("Set-Cookie", "a=1; Path=/; HttpOnly")
+	res.Header.Add("Set-Cookie", "a=2; Path=/other")
+	res.Header.Add("Set-Cookie", "b=1")
+	res.SetCookie(&http.Cookie{Name: "a", Value: "3", Path: "/", Secure: true})
+	res.DelCookie("b")
+	want := []string{"a=3; Path=/; Secure", "a=2; Path=/other"}
+	got := res.Header.Values("Set-Cookie")
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("expected %q, but got %q", want, got)
+	}
+	if c := res.Cookie("a"); c == nil || !c.Secure {
+		t.Fatal("cookie a not found")
+	}
+}
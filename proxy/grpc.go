@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var errGRPCInvalid = errors.New("invalid grpc message")
+
+// GRPCMessage is a length-prefixed message of a gRPC request or response body.
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+type GRPCMessage struct {
+	Compressed bool            `json:"compressed"`
+	Data       []byte          `json:"-"`          // the protobuf message, decompressed
+	JSON       json.RawMessage `json:"json"`       // nil if Data is not a valid protobuf message
+	Schemaless bool            `json:"schemaless"` // JSON is keyed by field numbers, the method was not found in the descriptor sets
+}
+
+// IsGRPC reports whether the content type of header is a gRPC message.
+func IsGRPC(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/grpc" || mediaType == "application/grpc+proto"
+}
+
+// ParseGRPCMessages splits a gRPC body into messages, decompressed according to the grpc-encoding of header.
+// JSON of the messages is not set.
+func ParseGRPCMessages(header http.Header, body []byte) ([]*GRPCMessage, error) {
+	enc := strings.ToLower(strings.TrimSpace(header.Get("Grpc-Encoding")))
+	msgs := make([]*GRPCMessage, 0)
+	for len(body) > 0 {
+		if len(body) < 5 {
+			return nil, errGRPCInvalid
+		}
+		compressed := body[0] == 1
+		length := binary.BigEndian.Uint32(body[1:5])
+		body = body[5:]
+		if uint64(len(body)) < uint64(length) {
+			return nil, errGRPCInvalid
+		}
+		data := body[:length]
+		body = body[length:]
+
+		if compressed && enc != "" && enc != "identity" {
+			var err error
+			data, err = decodeOne(enc, data)
+			if err != nil {
+				return nil, err
+			}
+		}
+		msgs = append(msgs, &GRPCMessage{
+			Compressed: compressed,
+			Data:       data,
+		})
+	}
+	return msgs, nil
+}
+
+// decodeGRPCMessages parses body and decodes each message to JSON, with md if not nil, schemaless otherwise.
+func decodeGRPCMessages(header http.Header, body []byte, md protoreflect.MessageDescriptor) ([]*GRPCMessage, error) {
+	msgs, err := ParseGRPCMessages(header, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if md != nil {
+			if j, err := ProtoToJSON(md, msg.Data); err == nil {
+				msg.JSON = j
+				continue
+			}
+		}
+		if j, err := ProtoToJSONSchemaless(msg.Data); err == nil {
+			msg.JSON = j
+			msg.Schemaless = true
+		}
+	}
+	return msgs, nil
+}
+
+func (f *Flow) protoRegistry() *ProtoRegistry {
+	if f.ConnContext == nil || f.ConnContext.proxy == nil {
+		return nil
+	}
+	return f.ConnContext.proxy.protoRegistry
+}
+
+// GRPCRequestMessages returns the decoded messages of a gRPC request body,
+// using the descriptor sets of Options.ProtoDescriptorSets if the method is found.
+func (f *Flow) GRPCRequestMessages() ([]*GRPCMessage, error) {
+	if f.Request == nil || !IsGRPC(f.Request.Header) {
+		return nil, nil
+	}
+	var md protoreflect.MessageDescriptor
+	if input, _, ok := f.protoRegistry().FindMethod(f.Request.URL.Path); ok {
+		md = input
+	}
+	return decodeGRPCMessages(f.Request.Header, f.Request.Body, md)
+}
+
+// GRPCResponseMessages returns the decoded messages of a gRPC response body,
+// using the descriptor sets of Options.ProtoDescriptorSets if the method is found.
+func (f *Flow) GRPCResponseMessages() ([]*GRPCMessage, error) {
+	if f.Response == nil || !IsGRPC(f.Response.Header) {
+		return nil, nil
+	}
+	var md protoreflect.MessageDescriptor
+	if _, output, ok := f.protoRegistry().FindMethod(f.Request.URL.Path); ok {
+		md = output
+	}
+	return decodeGRPCMessages(f.Response.Header, f.Response.Body, md)
+}
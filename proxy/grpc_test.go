@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func grpcFrame(compressed bool, data []byte) []byte {
+	frame := make([]byte, 5, 5+len(data))
+	if compressed {
+		frame[0] = 1
+	}
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+// message { int64 id = 1; string name = 2; Inner inner = 3 } message Inner { repeated int32 n = 1 }
+func testProtoMessage() []byte {
+	var inner []byte
+	inner = protowire.AppendTag(inner, 1, protowire.VarintType)
+	inner = protowire.AppendVarint(inner, 7)
+	inner = protowire.AppendTag(inner, 1, protowire.VarintType)
+	inner = protowire.AppendVarint(inner, 8)
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, 150)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, "hi")
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, inner)
+	return b
+}
+
+func TestGRPCSchemaless(t *testing.T) {
+	msg := testProtoMessage()
+	compressed, err := encodeOne("gzip", msg)
+	handleError(t, err)
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/grpc")
+	header.Set("Grpc-Encoding", "gzip")
+	body := append(grpcFrame(false, msg), grpcFrame(true, compressed)...)
+
+	msgs, err := decodeGRPCMessages(header, body, nil)
+	handleError(t, err)
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, but got %d", len(msgs))
+	}
+	want := `{"1":150,"2":"hi","3":{"1":[7,8]}}`
+	for _, m := range msgs {
+		if string(m.JSON) != want || !m.Schemaless {
+			t.Fatalf("expected %s, but got %s", want, m.JSON)
+		}
+	}
+	if !msgs[1].Compressed {
+		t.Fatal("expected compressed message")
+	}
+
+	if _, err := ParseGRPCMessages(header, body[:len(body)-1]); err == nil {
+		t.Fatal("expected error for truncated body")
+	}
+}
+
+func TestGRPCDescriptorSet(t *testing.T) {
+	fdset := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("test.proto"),
+			Package: proto.String("test"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{
+				{
+					Name: proto.String("Inner"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						{Name: proto.String("n"), JsonName: proto.String("n"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()},
+					},
+				},
+				{
+					Name: proto.String("Req"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						{Name: proto.String("id"), JsonName: proto.String("id"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+						{Name: proto.String("name"), JsonName: proto.String("name"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+						{Name: proto.String("inner"), JsonName: proto.String("inner"), Number: proto.Int32(3), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(".test.Inner"), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+					},
+				},
+			},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("Svc"),
+				Method: []*descriptorpb.MethodDescriptorProto{{
+					Name:       proto.String("Call"),
+					InputType:  proto.String(".test.Req"),
+					OutputType: proto.String(".test.Inner"),
+				}},
+			}},
+		}},
+	}
+	data, err := proto.Marshal(fdset)
+	handleError(t, err)
+	filename := filepath.Join(t.TempDir(), "test.pb")
+	handleError(t, os.WriteFile(filename, data, 0644))
+
+	registry := NewProtoRegistry()
+	handleError(t, registry.LoadDescriptorSet(filename))
+	input, _, ok := registry.FindMethod("/test.Svc/Call")
+	if !ok {
+		t.Fatal("method not found")
+	}
+	if _, _, ok := registry.FindMethod("/test.Svc/Missing"); ok {
+		t.Fatal("expected missing method not found")
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/grpc+proto")
+	msgs, err := decodeGRPCMessages(header, grpcFrame(false, testProtoMessage()), input)
+	handleError(t, err)
+	want := `{"id":"150","name":"hi","inner":{"n":[7,8]}}`
+	got, err := compactJSON(msgs[0].JSON)
+	handleError(t, err)
+	if got != want || msgs[0].Schemaless {
+		t.Fatalf("expected %s, but got %s", want, got)
+	}
+}
+
+// protojson output is deliberately unstable in whitespace
+func compactJSON(data []byte) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := json.Compact(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -20,6 +20,7 @@ var normalErrMsgs []string = []string{
 	"connect: connection refused",
 	"connect: connection reset by peer",
 	"use of closed network connection",
+	"context canceled",
 }
 
 // logErr will only print unexpected error messages.
@@ -43,12 +44,12 @@ func logErr(logger *slog.Logger, loggerMsg string, err error) bool {
 }
 
 // Forward traffic.
-func transfer(logger *slog.Logger, server, client io.ReadWriteCloser) {
+func transfer(logger *slog.Logger, server, client io.ReadWriteCloser, t *throttle) {
 	var wg sync.WaitGroup
 	errChan := make(chan error, 2) // Buffer to avoid goroutine leak
 
 	// Function to copy and handle closing of connections
-	copyAndClose := func(dst, src io.ReadWriteCloser, direction string) {
+	copyAndClose := func(dst io.Writer, src io.ReadWriteCloser, direction string) {
 		defer wg.Done()
 		defer src.Close()
 		written, err := io.Copy(dst, src)
@@ -60,8 +61,14 @@ func transfer(logger *slog.Logger, server, client io.ReadWriteCloser) {
 	}
 
 	wg.Add(2)
-	go copyAndClose(server, client, "client->server")
-	go copyAndClose(client, server, "server->client")
+	// the flow limiters of a websocket relayed as is, those of the client connection throttle it already
+	var toServer, toClient io.Writer = server, client
+	if t != nil {
+		toServer = &throttledWriter{w: server, limiters: t.upload}
+		toClient = &throttledWriter{w: client, limiters: t.download}
+	}
+	go copyAndClose(toServer, client, "client->server")
+	go copyAndClose(toClient, server, "server->client")
 
 	// Wait for both copy operations to finish
 	wg.Wait()
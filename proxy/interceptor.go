@@ -4,9 +4,11 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
+	"log"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/proxati/mitmproxy/cert"
 )
@@ -63,8 +65,9 @@ func newPipes(req *http.Request) (net.Conn, *pipeConn) {
 
 // mock net.Listener
 type middleListener struct {
-	connChan chan net.Conn
-	doneChan chan struct{}
+	connChan  chan net.Conn
+	doneChan  chan struct{}
+	closeOnce sync.Once
 }
 
 func (l *middleListener) Accept() (net.Conn, error) {
@@ -75,33 +78,80 @@ func (l *middleListener) Accept() (net.Conn, error) {
 		return nil, http.ErrServerClosed
 	}
 }
-func (l *middleListener) Close() error   { return nil }
+
+// Close makes Accept return, the http server waits for it on Close and Shutdown.
+func (l *middleListener) Close() error {
+	l.closeOnce.Do(func() { close(l.doneChan) })
+	return nil
+}
+
 func (l *middleListener) Addr() net.Addr { return nil }
 
+// serve hands c to the server of the listener, c is closed if the listener is closed.
+func (l *middleListener) serve(c net.Conn) {
+	select {
+	case l.connChan <- c:
+	case <-l.doneChan:
+		c.Close()
+	}
+}
+
+func newMiddleListener() *middleListener {
+	return &middleListener{
+		connChan: make(chan net.Conn),
+		doneChan: make(chan struct{}),
+	}
+}
+
+// middleErrorLog is the error log of the middle server, which counts the failed TLS handshakes with clients.
+// http.Server reports them only through its error log, as "http: TLS handshake error from <addr>: <err>".
+type middleErrorLog struct {
+	proxy *Proxy
+}
+
+func (l middleErrorLog) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	if strings.HasPrefix(msg, "http: TLS handshake error from ") {
+		// common with clients which do not trust the CA, not an error of the proxy
+		l.proxy.tracker.clientTLSFailures.Add(1)
+		sLogger.Debug("client TLS handshake failed", "error", msg)
+		return len(p), nil
+	}
+	sLogger.Error("middle server error", "error", msg)
+	return len(p), nil
+}
+
 // middle: man-in-the-middle server
 type middle struct {
 	proxy    *Proxy
 	ca       cert.Getter
 	listener *middleListener
 	server   *http.Server
+
+	// serves plain http inside CONNECT tunnels
+	plainListener *middleListener
+	plainServer   *http.Server
 }
 
 func newMiddle(proxy *Proxy) (*middle, error) {
 	m := &middle{
-		proxy: proxy,
-		ca:    proxy.Opts.CA,
-		listener: &middleListener{
-			connChan: make(chan net.Conn),
-			doneChan: make(chan struct{}),
-		},
+		proxy:         proxy,
+		ca:            proxy.Opts.CA,
+		listener:      newMiddleListener(),
+		plainListener: newMiddleListener(),
 	}
 
+	timeouts := proxy.Opts.Timeouts
 	server := &http.Server{
-		Handler: m,
+		Handler:           m,
+		ReadHeaderTimeout: timeouts.ClientReadHeader,
+		ReadTimeout:       timeouts.ClientRead,
+		IdleTimeout:       timeouts.ClientIdle,
 		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
 			return context.WithValue(ctx, connContextKey, c.(*tls.Conn).NetConn().(*pipeConn).connContext)
 		},
 		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)), // Disable http2.
+		ErrorLog:     log.New(middleErrorLog{proxy}, "", 0),
 		TLSConfig: &tls.Config{
 			SessionTicketsDisabled: true, // Set to true, ensure GetCertificate is always called.
 			GetCertificate: func(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
@@ -119,16 +169,40 @@ func newMiddle(proxy *Proxy) (*middle, error) {
 		},
 	}
 	m.server = server
+
+	m.plainServer = &http.Server{
+		Handler:           m,
+		ReadHeaderTimeout: timeouts.ClientReadHeader,
+		ReadTimeout:       timeouts.ClientRead,
+		IdleTimeout:       timeouts.ClientIdle,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connContextKey, c.(*pipeConn).connContext)
+		},
+	}
 	return m, nil
 }
 
 func (m *middle) start() error {
+	go m.plainServer.Serve(m.plainListener)
 	return m.server.ServeTLS(m.listener, "", "")
 }
 
 func (m *middle) close() error {
 	err := m.server.Close()
-	close(m.listener.doneChan)
+	m.plainServer.Close()
+	return err
+}
+
+// shutdown closes the idle connections inside CONNECT tunnels and waits for the active ones like http.Server.Shutdown.
+func (m *middle) shutdown(ctx context.Context) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- m.plainServer.Shutdown(ctx)
+	}()
+	err := m.server.Shutdown(ctx)
+	if e := <-errc; err == nil {
+		err = e
+	}
 	return err
 }
 
@@ -145,14 +219,12 @@ func (m *middle) dial(req *http.Request) (net.Conn, error) {
 }
 
 func (m *middle) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	if strings.EqualFold(req.Header.Get("Connection"), "Upgrade") && strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
-		// wss
-		defaultWebSocket.wss(res, req)
-		return
-	}
-
 	if req.URL.Scheme == "" {
-		req.URL.Scheme = "https"
+		if req.TLS != nil {
+			req.URL.Scheme = "https"
+		} else {
+			req.URL.Scheme = "http"
+		}
 	}
 	if req.URL.Host == "" {
 		req.URL.Host = req.Host
@@ -162,9 +234,10 @@ func (m *middle) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 
 // Parse connect flow.
 // In case of tls flow, listener.Accept => Middle.ServeHTTP
-// Otherwise assume ws flow.
+// In case of plain http flow (e.g. ws), plainListener.Accept => Middle.ServeHTTP
+// Otherwise (including server-first protocols), relay as a TCPFlow.
 func (m *middle) intercept(pipeServerConn *pipeConn) {
-	buf, err := pipeServerConn.Peek(3)
+	buf, ok, err := peekClient(pipeServerConn, 3)
 	if err != nil {
 		sLogger.Error("could not peek", "error", err)
 		pipeServerConn.Close()
@@ -172,13 +245,28 @@ func (m *middle) intercept(pipeServerConn *pipeConn) {
 	}
 
 	// https://github.com/mitmproxy/mitmproxy/blob/main/mitmproxy/net/tls.py is_tls_record_magic
-	if buf[0] == 0x16 && buf[1] == 0x03 && buf[2] <= 0x03 {
+	if ok && buf[0] == 0x16 && buf[1] == 0x03 && buf[2] <= 0x03 {
 		// tls
 		pipeServerConn.connContext.ClientConn.TLS = true
 		pipeServerConn.connContext.initHttpsServerConn()
-		m.listener.connChan <- pipeServerConn
+		m.listener.serve(pipeServerConn)
+	} else if ok && isHTTPMethodPrefix(buf) {
+		// plain http
+		pipeServerConn.connContext.initPlainServerConn()
+		m.plainListener.serve(pipeServerConn)
 	} else {
-		// ws
-		defaultWebSocket.ws(pipeServerConn, pipeServerConn.host)
+		m.proxy.handleTCP(pipeServerConn)
+	}
+}
+
+var httpMethodPrefixes = []string{"GET", "POS", "PUT", "HEA", "DEL", "OPT", "PAT", "TRA"}
+
+// isHTTPMethodPrefix reports whether the first 3 bytes of a connection look like an http/1.x request.
+func isHTTPMethodPrefix(buf []byte) bool {
+	for _, prefix := range httpMethodPrefixes {
+		if string(buf) == prefix {
+			return true
+		}
 	}
+	return false
 }
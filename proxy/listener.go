@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listen listens on addr, which is host:port for tcp, or network://address with network
+// one of tcp, tcp4, tcp6 and unix, e.g. tcp6://[::1]:9080 or unix:///run/mitmproxy.sock.
+func listen(addr string) (net.Listener, error) {
+	network, address, ok := strings.Cut(addr, "://")
+	if !ok {
+		network, address = "tcp", addr
+	}
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		if address == "" {
+			address = ":http"
+		}
+	case "unix":
+		if err := removeStaleSocket(address); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported listen network %q of %s", network, addr)
+	}
+	return net.Listen(network, address)
+}
+
+// removeStaleSocket removes the socket file left by a previous process which did not exit cleanly.
+// A socket still accepting connections is in use and kept.
+func removeStaleSocket(address string) error {
+	fi, err := os.Stat(address)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	c, err := net.Dial("unix", address)
+	if err == nil {
+		c.Close()
+		return fmt.Errorf("listen unix %s: %w", address, syscall.EADDRINUSE)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("listen unix %s: %w", address, err)
+	}
+	return os.Remove(address)
+}
+
+// SystemdListeners returns the sockets passed by systemd socket activation, nil if none.
+// The LISTEN_* environment variables are unset so they are not inherited by child processes.
+func SystemdListeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	const listenFdsStart = 3
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFdsStart+i), name)
+		ln, err := net.FileListener(f)
+		f.Close() // FileListener dups the fd
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("systemd socket %s: %w", name, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// Listen binds the listen addresses of the options, Addr and Addrs, and the systemd sockets if
+// Options.SystemdSockets. It is called by Start, call it before to know the bound addresses, e.g. of port 0.
+func (proxy *Proxy) Listen() error {
+	proxy.listenMu.Lock()
+	defer proxy.listenMu.Unlock()
+	if proxy.listeners != nil {
+		return nil
+	}
+
+	addrs := make([]string, 0, len(proxy.Opts.Addrs)+1)
+	if proxy.Opts.Addr != "" || (len(proxy.Opts.Addrs) == 0 && !proxy.Opts.SystemdSockets) {
+		addrs = append(addrs, proxy.Opts.Addr)
+	}
+	addrs = append(addrs, proxy.Opts.Addrs...)
+
+	listeners := make([]net.Listener, 0, len(addrs))
+	closeAll := func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}
+	for _, addr := range addrs {
+		ln, err := listen(addr)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+	if proxy.Opts.SystemdSockets {
+		systemd, err := SystemdListeners()
+		if err != nil {
+			closeAll()
+			return err
+		}
+		listeners = append(listeners, systemd...)
+	}
+	if len(listeners) == 0 {
+		return errors.New("no listen address")
+	}
+	proxy.listeners = listeners
+	return nil
+}
+
+// Addrs returns the addresses the proxy is listening on, once Listen or Start bound them.
+func (proxy *Proxy) Addrs() []net.Addr {
+	proxy.listenMu.Lock()
+	defer proxy.listenMu.Unlock()
+	addrs := make([]net.Addr, 0, len(proxy.listeners))
+	for _, ln := range proxy.listeners {
+		addrs = append(addrs, ln.Addr())
+	}
+	return addrs
+}
+
+// closeListeners closes the listeners bound by Listen, which the server does not track if they were not served.
+func (proxy *Proxy) closeListeners() {
+	proxy.listenMu.Lock()
+	defer proxy.listenMu.Unlock()
+	for _, ln := range proxy.listeners {
+		ln.Close()
+	}
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/proxati/mitmproxy/cert"
+)
+
+func TestProxyListeners(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	handleError(t, err)
+	defer ln.Close()
+	go (&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})}).Serve(ln)
+
+	sock := filepath.Join(t.TempDir(), "proxy.sock")
+	ca, err := cert.New(&cert.MemoryLoader{})
+	handleError(t, err)
+	testProxy, err := NewProxy(&Options{
+		Addr:  "127.0.0.1:0",
+		Addrs: []string{"unix://" + sock},
+		CA:    ca,
+	})
+	handleError(t, err)
+	handleError(t, testProxy.Listen())
+	go testProxy.Start()
+
+	addrs := testProxy.Addrs()
+	if len(addrs) != 2 {
+		t.Fatalf("expected 2 addrs, but got %v", addrs)
+	}
+	if addrs[1].Network() != "unix" || addrs[1].String() != sock {
+		t.Fatalf("expected unix socket %s, but got %v", sock, addrs[1])
+	}
+
+	endpoint := "http://" + ln.Addr().String() + "/"
+	for _, addr := range addrs {
+		addr := addr
+		client := &http.Client{
+			Transport: &http.Transport{
+				Proxy: func(r *http.Request) (*url.URL, error) {
+					return url.Parse("http://proxy.test")
+				},
+				DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, addr.Network(), addr.String())
+				},
+			},
+		}
+		testSendRequest(t, endpoint, client, "ok")
+	}
+
+	if _, err := listen("udp://127.0.0.1:0"); err == nil {
+		t.Fatal("expected an error of the unsupported network")
+	}
+
+	// the socket is in use by the proxy
+	if _, err := listen("unix://" + sock); !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatalf("expected address in use, but got %v", err)
+	}
+}
+
+func TestListenStaleSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "stale.sock")
+	ln, err := net.Listen("unix", sock)
+	handleError(t, err)
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	ln, err = listen("unix://" + sock)
+	handleError(t, err)
+	ln.Close()
+}
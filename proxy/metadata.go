@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Metadata is a concurrency-safe key-value store attached to a flow, the zero value is empty and ready to use.
+type Metadata struct {
+	mu sync.RWMutex
+	m  map[string]any
+}
+
+func newMetadata() *Metadata {
+	return &Metadata{
+		m: make(map[string]any),
+	}
+}
+
+func (md *Metadata) Get(key string) (any, bool) {
+	if md == nil {
+		return nil, false
+	}
+	md.mu.RLock()
+	defer md.mu.RUnlock()
+	v, ok := md.m[key]
+	return v, ok
+}
+
+// GetString returns the value of key if it is a string.
+func (md *Metadata) GetString(key string) string {
+	v, _ := md.Get(key)
+	s, _ := v.(string)
+	return s
+}
+
+func (md *Metadata) Set(key string, value any) {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	if md.m == nil {
+		md.m = make(map[string]any)
+	}
+	md.m[key] = value
+}
+
+func (md *Metadata) Delete(key string) {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	delete(md.m, key)
+}
+
+// Range calls fn for each key and value. If fn returns false, Range stops the iteration.
+// fn must not modify the Metadata.
+func (md *Metadata) Range(fn func(key string, value any) bool) {
+	if md == nil {
+		return
+	}
+	md.mu.RLock()
+	defer md.mu.RUnlock()
+	for k, v := range md.m {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// MarshalJSON skips the values which can not be marshaled, addons are free to store anything.
+func (md *Metadata) MarshalJSON() ([]byte, error) {
+	if md == nil {
+		return []byte("{}"), nil
+	}
+	md.mu.RLock()
+	defer md.mu.RUnlock()
+	m := make(map[string]json.RawMessage, len(md.m))
+	for k, v := range md.m {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		m[k] = raw
+	}
+	return json.Marshal(m)
+}
+
+func (md *Metadata) UnmarshalJSON(data []byte) error {
+	m := make(map[string]any)
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	md.m = m
+	return nil
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	cases := []struct {
+		name      string
+		md        *Metadata
+		set       map[string]any
+		key       string
+		want      any
+		wantOK    bool
+		wantStr   string
+		wantRange int
+	}{
+		{name: "nil", md: nil, key: "a", wantOK: false},
+		{name: "zero value", md: &Metadata{}, set: map[string]any{"a": "x"}, key: "a", want: "x", wantOK: true, wantStr: "x", wantRange: 1},
+		{name: "missing", md: newMetadata(), set: map[string]any{"a": "x"}, key: "b", wantOK: false, wantRange: 1},
+		{name: "not a string", md: newMetadata(), set: map[string]any{"n": 1, "s": "y"}, key: "n", want: 1, wantOK: true, wantStr: "", wantRange: 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for k, v := range c.set {
+				c.md.Set(k, v)
+			}
+			got, ok := c.md.Get(c.key)
+			if ok != c.wantOK || got != c.want {
+				t.Fatalf("expected %v %v, but got %v %v", c.want, c.wantOK, got, ok)
+			}
+			if s := c.md.GetString(c.key); s != c.wantStr {
+				t.Fatalf("expected string %q, but got %q", c.wantStr, s)
+			}
+			n := 0
+			c.md.Range(func(key string, value any) bool {
+				n++
+				return true
+			})
+			if n != c.wantRange {
+				t.Fatalf("expected %d values, but got %d", c.wantRange, n)
+			}
+		})
+	}
+
+	md := newMetadata()
+	md.Set("tag", "a")
+	md.Set("fn", func() {}) // can not be marshaled
+	data, err := json.Marshal(md)
+	handleError(t, err)
+	if string(data) != `{"tag":"a"}` {
+		t.Fatalf("unexpected json %s", data)
+	}
+	md.Delete("tag")
+	if _, ok := md.Get("tag"); ok {
+		t.Fatal("expected tag to be deleted")
+	}
+}
+
+func TestMetadataConcurrent(t *testing.T) {
+	md := &Metadata{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := strconv.Itoa(i)
+			for j := 0; j < 100; j++ {
+				md.Set(key, j)
+				md.Get(key)
+				md.GetString("other")
+				json.Marshal(md)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 8; i++ {
+		if v, _ := md.Get(strconv.Itoa(i)); v != 99 {
+			t.Fatalf("expected 99 of %d, but got %v", i, v)
+		}
+	}
+}
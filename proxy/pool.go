@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// upstreamPool shares the upstream connections of plain proxy requests between client connections.
+// There is a transport per TLS config, which keeps idle connections by scheme, host and upstream proxy.
+// Requests in a CONNECT tunnel keep using the server connection dialed for the tunnel.
+type upstreamPool struct {
+	proxy *Proxy
+
+	mu         sync.Mutex
+	transports map[upstreamTLSKey]*upstreamTransport
+	lastSweep  time.Time
+}
+
+// upstreamTLSKey is the part of the TLS config which differs between transports,
+// and the address rewritten by the ServerDial addon event, which the transport does not know.
+type upstreamTLSKey struct {
+	insecureSkipVerify bool
+	dialAddr           string
+}
+
+type upstreamTransport struct {
+	*http.Transport
+	lastUsed time.Time
+}
+
+func newUpstreamPool(proxy *Proxy) *upstreamPool {
+	return &upstreamPool{
+		proxy:      proxy,
+		transports: make(map[upstreamTLSKey]*upstreamTransport),
+	}
+}
+
+func (pool *upstreamPool) idleTimeout() time.Duration {
+	if d := pool.proxy.Opts.Timeouts.UpstreamIdle; d > 0 {
+		return d
+	}
+	return 90 * time.Second
+}
+
+func (pool *upstreamPool) client() *http.Client {
+	return &http.Client{
+		Transport: pool,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// Disable automatic redirects.
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// RoundTrip sends req with the transport of the current TLS config,
+// setting the ServerConn of the ConnContext of req to the connection it got.
+func (pool *upstreamPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := upstreamTLSKey{insecureSkipVerify: pool.proxy.Opts.InsecureSkipVerifyTLS}
+	if d, ok := req.Context().Value(dialKey{}).(*Dial); ok && d.Addr != d.Host {
+		key.dialAddr = d.Addr
+	}
+	if connCtx, ok := req.Context().Value(connContextKey).(*ConnContext); ok {
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				if c, ok := info.Conn.(*wrapServerConn); ok {
+					connCtx.ServerConn = c.serverConn
+				}
+			},
+			TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+				if err != nil {
+					pool.proxy.tracker.serverTLSFailures.Add(1)
+				}
+			},
+		}))
+	}
+	return pool.transport(key).RoundTrip(req)
+}
+
+func (pool *upstreamPool) transport(key upstreamTLSKey) *http.Transport {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	now := time.Now()
+	pool.sweep(now)
+	if t, ok := pool.transports[key]; ok {
+		t.lastUsed = now
+		return t.Transport
+	}
+	timeouts := pool.proxy.Opts.Timeouts
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           pool.dial,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       pool.idleTimeout(),
+		TLSHandshakeTimeout:   timeouts.TLSHandshake,
+		ResponseHeaderTimeout: timeouts.ResponseHeader,
+		ForceAttemptHTTP2:     false, // disable http2
+		DisableCompression:    true,  // To get the original response from the server, set Transport.DisableCompression to true.
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: key.insecureSkipVerify,
+			KeyLogWriter:       getTLSKeyLogWriter(),
+		},
+	}
+	pool.transports[key] = &upstreamTransport{Transport: t, lastUsed: now}
+	return t
+}
+
+// sweep removes the transports of rewritten addresses not used for the idle timeout, whose connections are idle
+// or closed by now, so addresses rewritten once do not keep a transport forever. It runs once per idle timeout.
+func (pool *upstreamPool) sweep(now time.Time) {
+	idleTimeout := pool.idleTimeout()
+	if now.Sub(pool.lastSweep) < idleTimeout {
+		return
+	}
+	pool.lastSweep = now
+	for key, t := range pool.transports {
+		if key.dialAddr != "" && now.Sub(t.lastUsed) >= idleTimeout {
+			t.CloseIdleConnections()
+			delete(pool.transports, key)
+		}
+	}
+}
+
+// dial reports the new connection with PooledServerConnected, and PooledServerDisconnected once it is closed.
+// The ServerConn of the ConnContext of a request is set when it gets the connection, see RoundTrip.
+// The address rewritten by the ServerDial event is dialed, unless addr is an upstream proxy.
+func (pool *upstreamPool) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	connCtx, _ := ctx.Value(connContextKey).(*ConnContext)
+	var c net.Conn
+	var err error
+	d, ok := ctx.Value(dialKey{}).(*Dial)
+	switch {
+	case ok && d.Host == addr:
+		c, err = pool.proxy.dialDestination(ctx, network, d.Host, d.Addr, connCtx)
+	case ok:
+		// addr is an upstream proxy
+		if err := pool.proxy.checkProxiedDestination(ctx, d.Host); err != nil {
+			return nil, err
+		}
+		c, err = pool.proxy.dial(ctx, network, addr, connCtx)
+	default:
+		c, err = pool.proxy.dial(ctx, network, addr, connCtx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	serverConn := newServerConn()
+	serverConn.Address = addr
+	serverConn.IP = remoteIP(c)
+	serverConn.pooled = true
+	cw := &wrapServerConn{
+		Conn:       c,
+		proxy:      pool.proxy,
+		serverConn: serverConn,
+	}
+	serverConn.Conn = cw
+	pool.proxy.tracker.serverConns.Add(1)
+
+	for _, addon := range pool.proxy.Addons {
+		addon.PooledServerConnected(serverConn)
+	}
+	return cw, nil
+}
+
+// closeIdle closes the idle connections of all transports.
+func (pool *upstreamPool) closeIdle() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, t := range pool.transports {
+		t.CloseIdleConnections()
+	}
+}
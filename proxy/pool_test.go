@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpstreamPoolSweep(t *testing.T) {
+	pool := newUpstreamPool(&Proxy{
+		Opts: &Options{Timeouts: Timeouts{UpstreamIdle: 20 * time.Millisecond}},
+	})
+	rewritten := upstreamTLSKey{dialAddr: "127.0.0.1:8080"}
+	if pool.transport(rewritten) != pool.transport(rewritten) {
+		t.Fatal("expected the transport to be reused")
+	}
+	pool.transport(upstreamTLSKey{})
+
+	time.Sleep(40 * time.Millisecond)
+	pool.transport(upstreamTLSKey{insecureSkipVerify: true})
+	if _, ok := pool.transports[rewritten]; ok {
+		t.Fatal("expected the idle transport of the rewritten address to be removed")
+	}
+	if len(pool.transports) != 2 {
+		t.Fatalf("expected the transports without rewritten address to be kept, but got %d", len(pool.transports))
+	}
+}
@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var errProtoInvalid = errors.New("invalid protobuf message")
+
+// ProtoRegistry holds message types loaded from descriptor sets, to decode protobuf with field names.
+type ProtoRegistry struct {
+	mu    sync.RWMutex
+	files *protoregistry.Files
+}
+
+func NewProtoRegistry() *ProtoRegistry {
+	return &ProtoRegistry{
+		files: new(protoregistry.Files),
+	}
+}
+
+// LoadDescriptorSet loads a FileDescriptorSet file, e.g. generated by
+// protoc --include_imports --descriptor_set_out=api.pb api.proto
+func (r *ProtoRegistry) LoadDescriptorSet(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	fdset := new(descriptorpb.FileDescriptorSet)
+	if err := proto.Unmarshal(data, fdset); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, fdproto := range fdset.File {
+		if _, err := r.files.FindFileByPath(fdproto.GetName()); err == nil {
+			continue // already loaded
+		}
+		fd, err := protodesc.NewFile(fdproto, r.files)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		if err := r.files.RegisterFile(fd); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// FindMethod returns the input and output message types of a gRPC method path, e.g. /pkg.Service/Method.
+func (r *ProtoRegistry) FindMethod(path string) (input, output protoreflect.MessageDescriptor, ok bool) {
+	if r == nil {
+		return nil, nil, false
+	}
+	service, method, found := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !found {
+		return nil, nil, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	desc, err := r.files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, nil, false
+	}
+	sd, isService := desc.(protoreflect.ServiceDescriptor)
+	if !isService {
+		return nil, nil, false
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, nil, false
+	}
+	return md.Input(), md.Output(), true
+}
+
+// ProtoToJSON decodes a protobuf message of type md to JSON.
+func ProtoToJSON(md protoreflect.MessageDescriptor, data []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return protojson.Marshal(msg)
+}
+
+// ProtoToJSONSchemaless decodes a protobuf message without its schema to JSON,
+// keyed by field numbers. Length-delimited fields are decoded as nested messages if possible,
+// then as strings if valid utf-8, otherwise as base64 bytes.
+// Fixed-width fields are printed as unsigned integers, the schema is needed to tell floats and signed ones.
+func ProtoToJSONSchemaless(data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := writeSchemalessMessage(buf, data, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// nested messages deeper than this are printed as bytes
+const protoMaxDepth = 32
+
+type protoField struct {
+	num    protowire.Number
+	values []string // json values
+}
+
+func writeSchemalessMessage(buf *bytes.Buffer, data []byte, depth int) error {
+	fields := make([]*protoField, 0)
+	byNum := make(map[protowire.Number]*protoField)
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return errProtoInvalid
+		}
+		data = data[n:]
+
+		var value string
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return errProtoInvalid
+			}
+			data = data[n:]
+			value = strconv.FormatUint(v, 10)
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(data)
+			if n < 0 {
+				return errProtoInvalid
+			}
+			data = data[n:]
+			value = strconv.FormatUint(uint64(v), 10)
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return errProtoInvalid
+			}
+			data = data[n:]
+			value = strconv.FormatUint(v, 10)
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return errProtoInvalid
+			}
+			data = data[n:]
+			value = schemalessBytes(v, depth)
+		case protowire.StartGroupType:
+			v, n := protowire.ConsumeGroup(num, data)
+			if n < 0 {
+				return errProtoInvalid
+			}
+			data = data[n:]
+			group := new(bytes.Buffer)
+			if err := writeSchemalessMessage(group, v, depth+1); err != nil {
+				return err
+			}
+			value = group.String()
+		default:
+			return errProtoInvalid
+		}
+
+		field, ok := byNum[num]
+		if !ok {
+			field = &protoField{num: num}
+			byNum[num] = field
+			fields = append(fields, field)
+		}
+		field.values = append(field.values, value)
+	}
+
+	// fields in the order they first appear, repeated fields as arrays
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, "%q:", strconv.Itoa(int(field.num)))
+		if len(field.values) == 1 {
+			buf.WriteString(field.values[0])
+			continue
+		}
+		buf.WriteByte('[')
+		buf.WriteString(strings.Join(field.values, ","))
+		buf.WriteByte(']')
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func schemalessBytes(v []byte, depth int) string {
+	if len(v) > 0 && depth < protoMaxDepth {
+		nested := new(bytes.Buffer)
+		if err := writeSchemalessMessage(nested, v, depth+1); err == nil && !isPrintableString(v) {
+			return nested.String()
+		}
+	}
+	if utf8.Valid(v) {
+		s, _ := json.Marshal(string(v))
+		return string(s)
+	}
+	return strconv.Quote(base64.StdEncoding.EncodeToString(v))
+}
+
+// Printable text often also parses as protobuf, e.g. "hi" is field 13 varint 105.
+func isPrintableString(v []byte) bool {
+	if !utf8.Valid(v) {
+		return false
+	}
+	for _, r := range string(v) {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
@@ -2,21 +2,31 @@
 package proxy
 
 import (
-	"bytes"
 	"context"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"runtime"
+	"strconv"
+	"sync"
 
 	"github.com/proxati/mitmproxy/cert"
 )
 
 type Options struct {
-	Addr                  string
-	StreamLargeBodies     int64 // When the request or response body is larger then this in bytes, turn into stream model.
+	Addr                  string    // Listen address, host:port or network://address, see Proxy.Listen.
+	Addrs                 []string  // More listen addresses, e.g. of a unix socket or the other IP version.
+	SystemdSockets        bool      // Also serve the sockets passed by systemd socket activation.
+	StreamLargeBodies     int64     // When the request or response body is larger then this in bytes, turn into stream model.
+	SpillLargeBodies      int64     // When larger than StreamLargeBodies, bodies up to this size are buffered in a temp file instead of turning into stream model.
+	SpillDir              string    // Directory of the temp files for spilled bodies, default os.TempDir().
+	ProtoDescriptorSets   []string  // Protobuf descriptor set files used to decode gRPC messages with field names.
+	Resolver              *Resolver // Resolves upstream host names with overrides or a DNS server, nil for the system resolver.
+	Dialer                Dialer    // Dials every upstream connection, Resolver and Timeouts.Dial are not used if set.
+	ACL                   *ACL      // Restricts the clients and the destinations they can reach, nil to allow all.
 	InsecureSkipVerifyTLS bool
+	Timeouts              Timeouts
 	CA                    cert.Getter
 	Logger                *slog.Logger
 }
@@ -26,8 +36,15 @@ type Proxy struct {
 	Version string
 	Addons  []Addon
 
-	server      *http.Server
-	interceptor *middle
+	server        *http.Server
+	interceptor   *middle
+	protoRegistry *ProtoRegistry
+	upstream      *upstreamPool
+	tracker       *tracker
+
+	listenMu         sync.Mutex
+	listeners        []net.Listener
+	interceptorStart sync.Once
 }
 
 func NewProxy(opts *Options) (*Proxy, error) {
@@ -40,14 +57,32 @@ func NewProxy(opts *Options) (*Proxy, error) {
 	}
 
 	proxy := &Proxy{
-		Opts:    opts,
-		Version: "1.3.1",
-		Addons:  make([]Addon, 0),
+		Opts:          opts,
+		Version:       "1.3.1",
+		Addons:        make([]Addon, 0),
+		protoRegistry: NewProtoRegistry(),
+		tracker:       newTracker(),
+	}
+	proxy.upstream = newUpstreamPool(proxy)
+
+	if opts.ACL != nil {
+		if err := opts.ACL.compile(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, filename := range opts.ProtoDescriptorSets {
+		if err := proxy.protoRegistry.LoadDescriptorSet(filename); err != nil {
+			return nil, err
+		}
 	}
 
 	proxy.server = &http.Server{
-		Addr:    opts.Addr,
-		Handler: proxy,
+		Addr:              opts.Addr,
+		Handler:           proxy,
+		ReadHeaderTimeout: opts.Timeouts.ClientReadHeader,
+		ReadTimeout:       opts.Timeouts.ClientRead,
+		IdleTimeout:       opts.Timeouts.ClientIdle,
 		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
 			wc := c.(*wrapClientConn)
 			connCtx := newConnContext(wc, proxy)
@@ -72,19 +107,31 @@ func (proxy *Proxy) AddAddon(addon Addon) {
 	proxy.Addons = append(proxy.Addons, addon)
 }
 
+// Start listens like Listen and serves all the listeners, it returns the error of the first one to stop.
 func (proxy *Proxy) Start() error {
-	addr := proxy.server.Addr
-	if addr == "" {
-		addr = ":http"
-	}
-	ln, err := net.Listen("tcp", addr)
-	if err != nil {
+	if err := proxy.Listen(); err != nil {
 		return err
 	}
+	proxy.listenMu.Lock()
+	listeners := proxy.listeners
+	proxy.listenMu.Unlock()
+
+	errc := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			errc <- proxy.Serve(ln)
+		}(ln)
+	}
+	return <-errc
+}
 
-	go proxy.interceptor.start()
+// Serve accepts the proxy connections of ln, it can be called for several listeners.
+func (proxy *Proxy) Serve(ln net.Listener) error {
+	proxy.interceptorStart.Do(func() {
+		go proxy.interceptor.start()
+	})
 
-	sLogger.Debug("MiTM proxy starting...", "listenAddress", proxy.server.Addr)
+	sLogger.Debug("MiTM proxy starting...", "listenAddress", ln.Addr().String())
 	pln := &wrapListener{
 		Listener: ln,
 		proxy:    proxy,
@@ -92,14 +139,31 @@ func (proxy *Proxy) Start() error {
 	return proxy.server.Serve(pln)
 }
 
+// Close closes the listeners and all connections immediately, the flows in progress are cut.
 func (proxy *Proxy) Close() error {
+	proxy.tracker.draining.Store(true)
 	err := proxy.server.Close()
+	proxy.closeListeners()
+	proxy.tracker.closeConns()
+	proxy.upstream.closeIdle()
 	proxy.interceptor.close()
 	return err
 }
 
+// Shutdown stops accepting connections and CONNECT tunnels, closes the idle connections and waits until
+// the flows in progress, inside tunnels included, are done or ctx is done. The remaining connections are closed then.
 func (proxy *Proxy) Shutdown(ctx context.Context) error {
+	proxy.tracker.draining.Store(true)
 	err := proxy.server.Shutdown(ctx)
+	proxy.closeListeners()
+	if e := proxy.interceptor.shutdown(ctx); err == nil {
+		err = e
+	}
+	if e := proxy.tracker.waitFlows(ctx); err == nil {
+		err = e
+	}
+	proxy.tracker.closeConns()
+	proxy.upstream.closeIdle()
 	proxy.interceptor.close()
 	return err
 }
@@ -124,6 +188,38 @@ func (proxy *Proxy) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		}
 		return
 	}
+	if !proxy.checkACL(res, req, hostPort(req.URL.Host, req.URL.Scheme == "https")) {
+		return
+	}
+
+	// if addons panic
+	defer func() {
+		if err := recover(); err != nil {
+			if err == http.ErrAbortHandler {
+				// flow killed, let the http server drop the connection
+				panic(err)
+			}
+			proxy.tracker.addonPanics.Add(1)
+			buf := make([]byte, 1<<16) // 64KB buffer
+			stackSize := runtime.Stack(buf, true)
+			stackTrace := string(buf[:stackSize])
+			logger.Error("Recovered from panic", "error", err, "stackTrace", stackTrace)
+		}
+	}()
+
+	f := newFlow()
+	f.Request = newRequest(req)
+	f.ConnContext = req.Context().Value(connContextKey).(*ConnContext)
+	defer f.finish()
+	defer proxy.tracker.flowStarted()()
+
+	// abort the handler without writing a response when the flow was killed by an addon
+	abortIfKilled := func() {
+		if f.Killed() {
+			logger.Debug("flow killed")
+			panic(http.ErrAbortHandler)
+		}
+	}
 
 	reply := func(response *Response, body io.Reader) {
 		if response.Header != nil {
@@ -136,85 +232,98 @@ func (proxy *Proxy) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		if response.close {
 			res.Header().Add("Connection", "close")
 		}
+		declareTrailers(res.Header(), response)
 		res.WriteHeader(response.StatusCode)
 
+		done := req.Context().Done()
 		if body != nil {
-			_, err := io.Copy(res, body)
+			var w io.Writer = res
+			if f.Stream {
+				w = flushWriter{res}
+			}
+			_, err := io.Copy(f.throttle.writer(w, done), body)
 			if err != nil {
+				f.setError(err)
 				logErr(logger, "body copy", err)
 			}
 		}
 		if response.BodyReader != nil {
-			_, err := io.Copy(res, response.BodyReader)
+			_, err := io.Copy(f.throttle.writer(res, done), response.BodyReader)
 			if err != nil {
 				logErr(logger, "BodyReader", err)
 			}
 		}
 		if response.Body != nil && len(response.Body) > 0 {
-			_, err := res.Write(response.Body)
+			_, err := f.throttle.writer(res, done).Write(response.Body)
 			if err != nil {
 				logErr(logger, "body writer", err)
 			}
+		} else if response.BodySpilled() {
+			_, err := io.Copy(f.throttle.writer(res, done), response.OpenBody())
+			if err != nil {
+				logErr(logger, "spilled body copy", err)
+			}
 		}
+		writeTrailers(res.Header(), response.Trailer)
 	}
 
-	// if addons panic
-	defer func() {
-		if err := recover(); err != nil {
-			buf := make([]byte, 1<<16) // 64KB buffer
-			stackSize := runtime.Stack(buf, true)
-			stackTrace := string(buf[:stackSize])
-			logger.Error("Recovered from panic", "error", err, "stackTrace", stackTrace)
-		}
-	}()
-
-	f := newFlow()
-	f.Request = newRequest(req)
-	f.ConnContext = req.Context().Value(connContextKey).(*ConnContext)
-	defer f.finish()
-
 	// trigger addon event Requestheaders
 	for _, addon := range proxy.Addons {
 		addon.Requestheaders(f)
+		abortIfKilled()
 		if f.Response != nil {
 			reply(f.Response, nil)
 			return
 		}
 	}
 
+	if isWebSocketRequest(req) {
+		proxy.handleWebSocket(res, f, logger)
+		return
+	}
+
 	// Read request body
 	var reqBody io.Reader = req.Body
 	if !f.Stream {
-		reqBuf, r, err := readerToBuffer(req.Body, proxy.Opts.StreamLargeBodies)
+		reqBuf, reqSpilled, r, err := proxy.readBody(f, req.Body)
 		reqBody = r
 		if err != nil {
+			f.setError(err)
 			logger.Error("could not read request body", "error", err)
 			res.WriteHeader(502)
 			return
 		}
 
-		if reqBuf == nil {
-			logger.Warn("request body size larger than threshold", "StreamLargeBodies", proxy.Opts.StreamLargeBodies)
+		if reqBuf == nil && reqSpilled == nil {
+			logger.Warn("request body size larger than threshold", "StreamLargeBodies", proxy.Opts.StreamLargeBodies, "SpillLargeBodies", proxy.Opts.SpillLargeBodies)
 			f.Stream = true
 		} else {
 			f.Request.Body = reqBuf
+			f.Request.spilled = reqSpilled
 
 			// trigger addon event Request
 			for _, addon := range proxy.Addons {
 				addon.Request(f)
+				abortIfKilled()
 				if f.Response != nil {
 					reply(f.Response, nil)
 					return
 				}
 			}
-			reqBody = bytes.NewReader(f.Request.Body)
+			reqBody = f.Request.OpenBody()
 		}
 	}
 
 	for _, addon := range proxy.Addons {
 		reqBody = addon.StreamRequestModifier(f, reqBody)
+		abortIfKilled()
 	}
-	proxyReq, err := http.NewRequest(f.Request.Method, f.Request.URL.String(), reqBody)
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	f.setCancel(cancel)
+
+	proxyReq, err := http.NewRequestWithContext(withInformational(ctx, f, res), f.Request.Method, f.Request.URL.String(), reqBody)
 	if err != nil {
 		logger.Error("could not complete request", "error", err)
 		res.WriteHeader(502)
@@ -226,11 +335,53 @@ func (proxy *Proxy) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 			proxyReq.Header.Add(key, v)
 		}
 	}
+	if (f.Stream || f.Request.BodySpilled()) && proxyReq.ContentLength == 0 {
+		// Content-Length is removed by stream modifiers which change the body length, chunked otherwise
+		if contentLength, err := strconv.ParseInt(f.Request.Header.Get("Content-Length"), 10, 64); err == nil {
+			proxyReq.ContentLength = contentLength
+		}
+	}
+	if len(f.Request.Trailer) > 0 {
+		// trailers are only sent with a chunked body
+		proxyReq.Trailer = f.Request.Trailer
+		proxyReq.ContentLength = -1
+	}
+	if t := f.Throttle(); t != nil && len(t.Upload) > 0 && proxyReq.Body != nil && proxyReq.Body != http.NoBody {
+		proxyReq.Body = struct {
+			io.Reader
+			io.Closer
+		}{f.throttle.reader(proxyReq.Body, ctx.Done()), proxyReq.Body}
+		proxyReq.GetBody = nil
+	}
+	if !f.Stream {
+		// the body was already read, which sent 100 Continue to the client.
+		// A streamed body is read once the server continues, see Transport.ExpectContinueTimeout.
+		proxyReq.Header.Del("Expect")
+	}
 
-	f.ConnContext.initHttpServerConn()
-	proxyRes, err := f.ConnContext.ServerConn.client.Do(proxyReq)
+	client := proxy.upstream.client()
+	tunnel := f.ConnContext.pipeConn != nil
+	if tunnel {
+		// requests in a CONNECT tunnel go through the server connection dialed for the tunnel
+		client = f.ConnContext.ServerConn.client
+		f.ConnContext.requesting.Store(true)
+	} else {
+		d := proxy.serverDial(f.ConnContext, f, hostPort(proxyReq.URL.Host, proxyReq.URL.Scheme == "https"))
+		proxyReq = proxyReq.WithContext(context.WithValue(proxyReq.Context(), dialKey{}, d))
+	}
+	proxyRes, err := client.Do(proxyReq)
+	f.ConnContext.requesting.Store(false)
 	if err != nil {
+		abortIfKilled()
+		f.setError(err)
+		if proxy.replyDenied(res, f.ConnContext, req.Method, hostPort(proxyReq.URL.Host, proxyReq.URL.Scheme == "https"), err) {
+			return
+		}
 		logErr(logger, "http req", err)
+		if tunnel {
+			// the server connection of the tunnel may be closed, e.g. by a timeout
+			res.Header().Set("Connection", "close")
+		}
 		res.WriteHeader(502)
 		return
 	}
@@ -244,12 +395,19 @@ func (proxy *Proxy) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	f.Response = &Response{
 		StatusCode: proxyRes.StatusCode,
 		Header:     proxyRes.Header,
+		Trailer:    proxyRes.Trailer, // filled when the body is read
 		close:      proxyRes.Close,
 	}
 
+	// events are forwarded as they arrive, addons can still set Stream to false to buffer the response
+	if isEventStream(f.Response.Header) {
+		f.Stream = true
+	}
+
 	// trigger addon event Responseheaders
 	for _, addon := range proxy.Addons {
 		addon.Responseheaders(f)
+		abortIfKilled()
 		if f.Response.Body != nil {
 			reply(f.Response, nil)
 			return
@@ -259,30 +417,44 @@ func (proxy *Proxy) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	// Read response body
 	var resBody io.Reader = proxyRes.Body
 	if !f.Stream {
-		resBuf, r, err := readerToBuffer(proxyRes.Body, proxy.Opts.StreamLargeBodies)
+		resBuf, resSpilled, r, err := proxy.readBody(f, proxyRes.Body)
 		resBody = r
 		if err != nil {
+			abortIfKilled()
+			f.setError(err)
 			logger.Error("could not read response body", "error", err)
 			res.WriteHeader(502)
 			return
 		}
-		if resBuf == nil {
-			logger.Warn("response body size larger than threshold", "StreamLargeBodies", proxy.Opts.StreamLargeBodies)
+		if resBuf == nil && resSpilled == nil {
+			logger.Warn("response body size larger than threshold", "StreamLargeBodies", proxy.Opts.StreamLargeBodies, "SpillLargeBodies", proxy.Opts.SpillLargeBodies)
 			f.Stream = true
 		} else {
 			f.Response.Body = resBuf
+			f.Response.spilled = resSpilled
 
 			// trigger addon event Response
 			for _, addon := range proxy.Addons {
 				addon.Response(f)
+				abortIfKilled()
 			}
 		}
 	}
 	for _, addon := range proxy.Addons {
 		resBody = addon.StreamResponseModifier(f, resBody)
+		abortIfKilled()
 	}
 
-	reply(f.Response, resBody)
+	if f.Stream && isEventStream(f.Response.Header) {
+		proxy.replyEventStream(res, f, resBody, reply, req.Context().Done(), logger)
+		writeTrailers(res.Header(), f.Response.Trailer)
+	} else {
+		reply(f.Response, resBody)
+	}
+	if c, ok := resBody.(io.Closer); ok {
+		c.Close()
+	}
+	abortIfKilled()
 }
 
 func (proxy *Proxy) handleConnect(res http.ResponseWriter, req *http.Request) {
@@ -291,8 +463,21 @@ func (proxy *Proxy) handleConnect(res http.ResponseWriter, req *http.Request) {
 		"host", req.Host,
 	)
 
+	if !proxy.checkACL(res, req, hostPort(req.Host, true)) {
+		return
+	}
+	if proxy.tracker.draining.Load() {
+		logger.Debug("refused tunnel, proxy is shutting down")
+		res.Header().Set("Connection", "close")
+		res.WriteHeader(503)
+		return
+	}
+
 	conn, err := proxy.interceptor.dial(req)
 	if err != nil {
+		if proxy.replyDenied(res, req.Context().Value(connContextKey).(*ConnContext), req.Method, hostPort(req.Host, true), err) {
+			return
+		}
 		logger.Error("could not dial", "error", err)
 		res.WriteHeader(502)
 		return
@@ -309,6 +494,8 @@ func (proxy *Proxy) handleConnect(res http.ResponseWriter, req *http.Request) {
 	// cconn.(*net.TCPConn).SetLinger(0) // send RST other than FIN when finished, to avoid TIME_WAIT state
 	// cconn.(*net.TCPConn).SetKeepAlive(false)
 	defer cconn.Close()
+	proxy.tracker.tunnels.Add(1)
+	defer proxy.tracker.tunnels.Add(-1)
 
 	_, err = io.WriteString(cconn, "HTTP/1.1 200 Connection Established\r\n\r\n")
 	if err != nil {
@@ -316,5 +503,5 @@ func (proxy *Proxy) handleConnect(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	transfer(logger, conn, cconn)
+	transfer(logger, conn, cconn, nil)
 }
@@ -1,13 +1,18 @@
 package proxy
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
 	"net/url"
 	"strconv"
 	"strings"
@@ -15,6 +20,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/proxati/mitmproxy/cert"
 )
 
@@ -42,9 +48,21 @@ func testSendRequest(t *testing.T, endpoint string, client *http.Client, bodyWan
 	}
 }
 
+func testSendRequestKilled(t *testing.T, endpoint string, client *http.Client) {
+	t.Helper()
+	req, err := http.NewRequest("GET", endpoint, nil)
+	handleError(t, err)
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected connection error, but got status %v", resp.StatusCode)
+	}
+}
+
 type testProxyHelper struct {
 	server    *http.Server
-	proxyAddr string
+	proxyAddr string        // bound by init
+	sseNext   chan struct{} // lets /sse send its remaining events
 
 	ln                     net.Listener
 	tlsPlainLn             net.Listener
@@ -63,6 +81,50 @@ func (helper *testProxyHelper) init(t *testing.T) {
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("ok"))
 	})
+	helper.sseNext = make(chan struct{})
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: a\n\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-helper.sseNext:
+		case <-time.After(5 * time.Second):
+		}
+		w.Write([]byte(": keep-alive\n\ndata: drop\n\nevent: x\ndata: b\ndata: c\n\n"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.Write([]byte("slow"))
+	})
+	mux.HandleFunc("/trailer", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Del("Link")
+
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write(body)
+		w.Header().Set("X-Checksum", r.Trailer.Get("X-Checksum"))
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			mt, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteMessage(mt, data); err != nil {
+				return
+			}
+		}
+	})
 	helper.server.Handler = mux
 
 	// start http server
@@ -92,11 +154,13 @@ func (helper *testProxyHelper) init(t *testing.T) {
 
 	// start proxy
 	testProxy, err := NewProxy(&Options{
-		Addr:                  helper.proxyAddr, // some random port
+		Addr:                  "127.0.0.1:0",
 		InsecureSkipVerifyTLS: true,
 		CA:                    ca,
 	})
 	handleError(t, err)
+	handleError(t, testProxy.Listen())
+	helper.proxyAddr = testProxy.Addrs()[0].String()
 	testProxy.AddAddon(&interceptAddon{})
 	testOrderAddonInstance := &testOrderAddon{
 		orders: make([]string, 0),
@@ -112,7 +176,7 @@ func (helper *testProxyHelper) init(t *testing.T) {
 					InsecureSkipVerify: true,
 				},
 				Proxy: func(r *http.Request) (*url.URL, error) {
-					return url.Parse("http://127.0.0.1" + helper.proxyAddr)
+					return url.Parse("http://" + helper.proxyAddr)
 				},
 			},
 		}
@@ -135,13 +199,66 @@ func (addon *interceptAddon) Request(f *Flow) {
 	}
 }
 
+func (addon *interceptAddon) Requestheaders(f *Flow) {
+	if f.Request.URL.Path == "/kill-requestheaders" {
+		f.Kill()
+	}
+}
+
 func (addon *interceptAddon) Response(f *Flow) {
+	if f.Request.URL.Path == "/kill-response" {
+		f.Kill()
+		return
+	}
+
 	if f.Request.URL.Path == "/intercept-response" {
 		f.Response = &Response{
 			StatusCode: 200,
 			Body:       []byte("intercept-response"),
 		}
 	}
+
+	// trailers and 1xx responses are known on the flow, trailers added here are not declared
+	if f.Request.URL.Path == "/trailer" && f.Request.Trailer.Get("X-Checksum") != "" {
+		for _, r := range f.Informational() {
+			f.Response.Trailer.Add("X-Informational", strconv.Itoa(r.StatusCode))
+		}
+	}
+}
+
+func (addon *interceptAddon) ServerDial(d *Dial) {
+	if host, port, _ := net.SplitHostPort(d.Host); host == "rewrite.test" {
+		d.Addr = net.JoinHostPort("127.0.0.1", port)
+	}
+}
+
+func (addon *interceptAddon) WebsocketMessage(f *Flow, msg *WebSocketMessage) {
+	if !msg.FromClient {
+		return
+	}
+	switch string(msg.Content) {
+	case "drop":
+		msg.Dropped = true
+	case "modify":
+		msg.Content = []byte("modified")
+	}
+}
+
+func (addon *interceptAddon) TcpMessage(f *TCPFlow, msg *TCPMessage) {
+	if msg.FromClient {
+		msg.Content = bytes.ReplaceAll(msg.Content, []byte("ping"), []byte("pong"))
+	}
+}
+
+func (addon *interceptAddon) ServerSentEvent(f *Flow, e *ServerSentEvent) {
+	switch {
+	case e.Data == "a":
+		f.EventStream.Inject(&ServerSentEvent{Data: "injected"})
+	case e.Data == "drop":
+		e.Dropped = true
+	case e.Event == "x":
+		e.Data = strings.ToUpper(e.Data)
+	}
 }
 
 // addon for test functions' execute order
@@ -169,6 +286,25 @@ func (addon *testOrderAddon) contains(t *testing.T, name string) {
 	t.Fatalf("expected contains %s, but not", name)
 }
 
+func (addon *testOrderAddon) count(name string) int {
+	addon.mu.Lock()
+	defer addon.mu.Unlock()
+	n := 0
+	for _, o := range addon.orders {
+		if o == name {
+			n++
+		}
+	}
+	return n
+}
+
+func (addon *testOrderAddon) notContains(t *testing.T, name string) {
+	t.Helper()
+	if addon.count(name) > 0 {
+		t.Fatalf("expected not contains %s, but contains", name)
+	}
+}
+
 func (addon *testOrderAddon) before(t *testing.T, a, b string) {
 	t.Helper()
 	addon.mu.Lock()
@@ -212,6 +348,16 @@ func (addon *testOrderAddon) ServerDisconnected(*ConnContext) {
 	defer addon.mu.Unlock()
 	addon.orders = append(addon.orders, "ServerDisconnected")
 }
+func (addon *testOrderAddon) PooledServerConnected(*ServerConn) {
+	addon.mu.Lock()
+	defer addon.mu.Unlock()
+	addon.orders = append(addon.orders, "PooledServerConnected")
+}
+func (addon *testOrderAddon) PooledServerDisconnected(*ServerConn) {
+	addon.mu.Lock()
+	defer addon.mu.Unlock()
+	addon.orders = append(addon.orders, "PooledServerDisconnected")
+}
 func (addon *testOrderAddon) TlsEstablishedServer(*ConnContext) {
 	addon.mu.Lock()
 	defer addon.mu.Unlock()
@@ -255,7 +401,6 @@ func TestProxy(t *testing.T) {
 		server: &http.Server{
 			IdleTimeout: time.Second,
 		},
-		proxyAddr: ":29080",
 	}
 	helper.init(t)
 	httpEndpoint := helper.httpEndpoint
@@ -268,7 +413,6 @@ func TestProxy(t *testing.T) {
 	defer helper.tlsPlainLn.Close()
 	go helper.server.Serve(helper.tlsLn)
 	go testProxy.Start()
-	time.Sleep(time.Millisecond * 10) // wait for test proxy startup
 
 	t.Run("test http server", func(t *testing.T) {
 		testSendRequest(t, httpEndpoint, nil, "ok")
@@ -348,6 +492,188 @@ func TestProxy(t *testing.T) {
 				testSendRequest(t, httpsEndpoint+"intercept-response", proxyClient, "intercept-response")
 			})
 		})
+
+		t.Run("can intercept websocket", func(t *testing.T) {
+			dialer := &websocket.Dialer{
+				Proxy: func(r *http.Request) (*url.URL, error) {
+					return url.Parse("http://" + helper.proxyAddr)
+				},
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+				},
+			}
+			testWebSocket := func(t *testing.T, endpoint string) {
+				c, _, err := dialer.Dial(endpoint, nil)
+				handleError(t, err)
+				defer c.Close()
+				for _, send := range []string{"hello", "drop", "modify"} {
+					handleError(t, c.WriteMessage(websocket.TextMessage, []byte(send)))
+				}
+				for _, want := range []string{"hello", "modified"} {
+					_, data, err := c.ReadMessage()
+					handleError(t, err)
+					if string(data) != want {
+						t.Fatalf("expected %s, but got %s", want, data)
+					}
+				}
+			}
+			t.Run("ws", func(t *testing.T) {
+				testWebSocket(t, "ws"+strings.TrimPrefix(httpEndpoint, "http")+"ws")
+			})
+			t.Run("wss", func(t *testing.T) {
+				testWebSocket(t, "wss"+strings.TrimPrefix(httpsEndpoint, "https")+"ws")
+			})
+		})
+
+		t.Run("can stream server-sent events", func(t *testing.T) {
+			resp, err := proxyClient.Get(httpEndpoint + "sse")
+			handleError(t, err)
+			defer resp.Body.Close()
+			r := bufio.NewReader(resp.Body)
+			readEvent := func() string {
+				var event string
+				for {
+					line, err := r.ReadString('\n')
+					handleError(t, err)
+					event += line
+					if line == "\n" {
+						return event
+					}
+				}
+			}
+
+			// received before the server sends the remaining events
+			for _, want := range []string{"data: injected\n\n", "data: a\n\n"} {
+				if event := readEvent(); event != want {
+					t.Fatalf("expected %q, but got %q", want, event)
+				}
+			}
+			close(helper.sseNext)
+
+			rest, err := io.ReadAll(r)
+			handleError(t, err)
+			want := ": keep-alive\n\nevent: x\ndata: B\ndata: C\n\n"
+			if string(rest) != want {
+				t.Fatalf("expected %q, but got %q", want, rest)
+			}
+		})
+
+		t.Run("can relay trailers and informational responses", func(t *testing.T) {
+			test := func(t *testing.T, endpoint string) {
+				var hints []string
+				ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+					Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+						hints = append(hints, fmt.Sprintf("%d %s", code, header.Get("Link")))
+						return nil
+					},
+				})
+				// a body of unknown length is sent chunked, with trailers
+				req, err := http.NewRequestWithContext(ctx, "POST", endpoint+"trailer", io.MultiReader(strings.NewReader("body")))
+				handleError(t, err)
+				req.Trailer = http.Header{"X-Checksum": {"abc"}}
+				resp, err := proxyClient.Do(req)
+				handleError(t, err)
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				handleError(t, err)
+
+				if string(body) != "body" {
+					t.Fatalf("expected body, but got %s", body)
+				}
+				if resp.Trailer.Get("X-Checksum") != "abc" {
+					t.Fatalf("expected trailer abc, but got %v", resp.Trailer)
+				}
+				if resp.Trailer.Get("X-Informational") != "103" {
+					t.Fatalf("expected trailer added by addon, but got %v", resp.Trailer)
+				}
+				if len(hints) != 1 || hints[0] != "103 </style.css>; rel=preload" {
+					t.Fatalf("unexpected informational responses %q", hints)
+				}
+				if resp.Header.Get("Link") != "" {
+					t.Fatal("Link of 103 should not be in the final response")
+				}
+			}
+			t.Run("http", func(t *testing.T) {
+				test(t, httpEndpoint)
+			})
+			t.Run("https", func(t *testing.T) {
+				test(t, httpsEndpoint)
+			})
+		})
+
+		t.Run("can resolve upstream hosts", func(t *testing.T) {
+			testProxy.Opts.Resolver = &Resolver{Hosts: map[string]string{"*.example.test": "127.0.0.1"}}
+			defer func() { testProxy.Opts.Resolver = nil }()
+			endpoint := func(endpoint, host string) string {
+				u, err := url.Parse(endpoint)
+				handleError(t, err)
+				u.Host = net.JoinHostPort(host, u.Port())
+				return u.String()
+			}
+
+			t.Run("http", func(t *testing.T) {
+				testSendRequest(t, endpoint(httpEndpoint, "api.example.test"), proxyClient, "ok")
+				testSendRequest(t, endpoint(httpEndpoint, "rewrite.test"), proxyClient, "ok")
+			})
+			t.Run("https", func(t *testing.T) {
+				testSendRequest(t, endpoint(httpsEndpoint, "api.example.test"), proxyClient, "ok")
+				testSendRequest(t, endpoint(httpsEndpoint, "rewrite.test"), proxyClient, "ok")
+			})
+		})
+
+		t.Run("can intercept tcp", func(t *testing.T) {
+			// server-first line echo server
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			handleError(t, err)
+			defer ln.Close()
+			go func() {
+				c, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer c.Close()
+				c.Write([]byte("hello\n"))
+				io.Copy(c, c)
+			}()
+
+			c, err := net.Dial("tcp", helper.proxyAddr)
+			handleError(t, err)
+			defer c.Close()
+			_, err = fmt.Fprintf(c, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", ln.Addr(), ln.Addr())
+			handleError(t, err)
+			r := bufio.NewReader(c)
+			res, err := http.ReadResponse(r, nil)
+			handleError(t, err)
+			if res.StatusCode != 200 {
+				t.Fatalf("expected 200, but got %d", res.StatusCode)
+			}
+
+			line, err := r.ReadString('\n')
+			handleError(t, err)
+			if line != "hello\n" {
+				t.Fatalf("expected hello, but got %q", line)
+			}
+			_, err = c.Write([]byte("ping\n"))
+			handleError(t, err)
+			line, err = r.ReadString('\n')
+			handleError(t, err)
+			if line != "pong\n" {
+				t.Fatalf("expected pong, but got %q", line)
+			}
+		})
+
+		t.Run("can kill flow", func(t *testing.T) {
+			t.Run("http", func(t *testing.T) {
+				testSendRequestKilled(t, httpEndpoint+"kill-requestheaders", proxyClient)
+				testSendRequestKilled(t, httpEndpoint+"kill-response", proxyClient)
+				testSendRequest(t, httpEndpoint, proxyClient, "ok")
+			})
+			t.Run("https", func(t *testing.T) {
+				testSendRequestKilled(t, httpsEndpoint+"kill-requestheaders", proxyClient)
+				testSendRequestKilled(t, httpsEndpoint+"kill-response", proxyClient)
+				testSendRequest(t, httpsEndpoint, proxyClient, "ok")
+			})
+		})
 	})
 
 	t.Run("test proxy when DisableKeepAlives", func(t *testing.T) {
@@ -373,7 +699,7 @@ func TestProxy(t *testing.T) {
 			testSendRequest(t, httpEndpoint, proxyClient, "ok")
 			time.Sleep(time.Millisecond * 10)
 			testOrderAddonInstance.contains(t, "ClientDisconnected")
-			testOrderAddonInstance.contains(t, "ServerDisconnected")
+			testOrderAddonInstance.contains(t, "PooledServerDisconnected")
 		})
 
 		t.Run("https", func(t *testing.T) {
@@ -401,6 +727,28 @@ func TestProxy(t *testing.T) {
 		})
 	})
 
+	t.Run("should share upstream connections between client connections", func(t *testing.T) {
+		time.Sleep(time.Millisecond * 10)
+		testProxy.upstream.closeIdle()
+		testOrderAddonInstance.reset()
+		for i := 0; i < 3; i++ {
+			// a new client connection each time
+			testSendRequest(t, httpEndpoint, getProxyClient(), "ok")
+			time.Sleep(time.Millisecond * 10)
+		}
+		if n := testOrderAddonInstance.count("ClientConnected"); n != 3 {
+			t.Fatalf("expected 3 client connections, but got %d", n)
+		}
+		if n := testOrderAddonInstance.count("PooledServerConnected"); n != 1 {
+			t.Fatalf("expected 1 pooled server connection, but got %d", n)
+		}
+		testOrderAddonInstance.notContains(t, "ServerConnected")
+		testProxy.upstream.closeIdle()
+		time.Sleep(time.Millisecond * 10)
+		testOrderAddonInstance.contains(t, "PooledServerDisconnected")
+		testOrderAddonInstance.notContains(t, "ServerDisconnected")
+	})
+
 	t.Run("should trigger disconnect functions when client side trigger off", func(t *testing.T) {
 		proxyClient := getProxyClient()
 		var clientConn net.Conn
@@ -417,8 +765,8 @@ func TestProxy(t *testing.T) {
 			clientConn.Close()
 			time.Sleep(time.Millisecond * 10)
 			testOrderAddonInstance.contains(t, "ClientDisconnected")
-			testOrderAddonInstance.contains(t, "ServerDisconnected")
-			testOrderAddonInstance.before(t, "ClientDisconnected", "ServerDisconnected")
+			// the upstream connection is kept by the pool for other clients
+			testOrderAddonInstance.notContains(t, "ServerDisconnected")
 		})
 
 		t.Run("https", func(t *testing.T) {
@@ -438,8 +786,7 @@ func TestProxyWhenServerNotKeepAlive(t *testing.T) {
 	server := &http.Server{}
 	server.SetKeepAlivesEnabled(false)
 	helper := &testProxyHelper{
-		server:    server,
-		proxyAddr: ":29081",
+		server: server,
 	}
 	helper.init(t)
 	httpEndpoint := helper.httpEndpoint
@@ -452,7 +799,6 @@ func TestProxyWhenServerNotKeepAlive(t *testing.T) {
 	defer helper.tlsPlainLn.Close()
 	go helper.server.Serve(helper.tlsLn)
 	go testProxy.Start()
-	time.Sleep(time.Millisecond * 10) // wait for test proxy startup
 
 	t.Run("should not have eof error when server side DisableKeepAlives", func(t *testing.T) {
 		proxyClient := getProxyClient()
@@ -477,8 +823,8 @@ func TestProxyWhenServerNotKeepAlive(t *testing.T) {
 			testSendRequest(t, httpEndpoint, proxyClient, "ok")
 			time.Sleep(time.Millisecond * 10)
 			testOrderAddonInstance.contains(t, "ClientDisconnected")
-			testOrderAddonInstance.contains(t, "ServerDisconnected")
-			testOrderAddonInstance.before(t, "ServerDisconnected", "ClientDisconnected")
+			testOrderAddonInstance.contains(t, "PooledServerDisconnected")
+			testOrderAddonInstance.before(t, "PooledServerDisconnected", "ClientDisconnected")
 		})
 
 		t.Run("https", func(t *testing.T) {
@@ -498,7 +844,6 @@ func TestProxyWhenServerKeepAliveButCloseImmediately(t *testing.T) {
 		server: &http.Server{
 			IdleTimeout: time.Millisecond * 10,
 		},
-		proxyAddr: ":29082",
 	}
 	helper.init(t)
 	httpEndpoint := helper.httpEndpoint
@@ -511,7 +856,6 @@ func TestProxyWhenServerKeepAliveButCloseImmediately(t *testing.T) {
 	defer helper.tlsPlainLn.Close()
 	go helper.server.Serve(helper.tlsLn)
 	go testProxy.Start()
-	time.Sleep(time.Millisecond * 10) // wait for test proxy startup
 
 	t.Run("should not have eof error when server close connection immediately", func(t *testing.T) {
 		proxyClient := getProxyClient()
@@ -547,9 +891,9 @@ func TestProxyWhenServerKeepAliveButCloseImmediately(t *testing.T) {
 			testOrderAddonInstance.reset()
 			testSendRequest(t, httpEndpoint, proxyClient, "ok")
 			time.Sleep(time.Millisecond * 20)
-			testOrderAddonInstance.contains(t, "ClientDisconnected")
-			testOrderAddonInstance.contains(t, "ServerDisconnected")
-			testOrderAddonInstance.before(t, "ServerDisconnected", "ClientDisconnected")
+			testOrderAddonInstance.contains(t, "PooledServerDisconnected")
+			// the pooled upstream connection is not tied to the client connection
+			testOrderAddonInstance.notContains(t, "ClientDisconnected")
 		})
 
 		/* started failing after fixing the close connection race condition
@@ -567,10 +911,8 @@ func TestProxyWhenServerKeepAliveButCloseImmediately(t *testing.T) {
 }
 
 func TestProxyClose(t *testing.T) {
-	t.Skip("go1.19 hang")
 	helper := &testProxyHelper{
-		server:    &http.Server{},
-		proxyAddr: ":29083",
+		server: &http.Server{},
 	}
 	helper.init(t)
 	httpEndpoint := helper.httpEndpoint
@@ -587,7 +929,6 @@ func TestProxyClose(t *testing.T) {
 		err := testProxy.Start()
 		errCh <- err
 	}()
-	time.Sleep(time.Millisecond * 10) // wait for test proxy startup
 
 	proxyClient := getProxyClient()
 	testSendRequest(t, httpEndpoint, proxyClient, "ok")
@@ -608,10 +949,8 @@ func TestProxyClose(t *testing.T) {
 }
 
 func TestProxyShutdown(t *testing.T) {
-	t.Skip("go1.19 hang")
 	helper := &testProxyHelper{
-		server:    &http.Server{},
-		proxyAddr: ":29084",
+		server: &http.Server{},
 	}
 	helper.init(t)
 	httpEndpoint := helper.httpEndpoint
@@ -629,8 +968,6 @@ func TestProxyShutdown(t *testing.T) {
 		errCh <- err
 	}()
 
-	time.Sleep(time.Millisecond * 10) // wait for test proxy startup
-
 	proxyClient := getProxyClient()
 	testSendRequest(t, httpEndpoint, proxyClient, "ok")
 	testSendRequest(t, httpsEndpoint, proxyClient, "ok")
@@ -648,3 +985,111 @@ func TestProxyShutdown(t *testing.T) {
 		t.Fatal("shutdown timeout")
 	}
 }
+
+func TestProxyDrain(t *testing.T) {
+	helper := &testProxyHelper{
+		server: &http.Server{},
+	}
+	helper.init(t)
+	testProxy := helper.testProxy
+	defer helper.ln.Close()
+	go helper.server.Serve(helper.ln)
+	defer helper.tlsPlainLn.Close()
+	go helper.server.Serve(helper.tlsLn)
+	go testProxy.Start()
+
+	proxyClient := helper.getProxyClient()
+	bodies := make(chan string, 2)
+	for _, endpoint := range []string{helper.httpEndpoint, helper.httpsEndpoint} {
+		go func(endpoint string) {
+			resp, err := proxyClient.Get(endpoint + "slow")
+			if err != nil {
+				bodies <- err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			bodies <- string(body)
+		}(endpoint)
+	}
+	for i := 0; testProxy.Stats().ActiveFlows < 2; i++ {
+		if i == 100 {
+			t.Fatalf("expected 2 active flows, but got %+v", testProxy.Stats())
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if stats := testProxy.Stats(); stats.ActiveTunnels != 1 || stats.ActiveServerConns != 2 {
+		t.Fatalf("expected a tunnel and 2 server connections, but got %+v", stats)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := testProxy.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown got error %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if body := <-bodies; body != "slow" {
+			t.Fatalf("expected the in-flight flow to finish, but got %s", body)
+		}
+	}
+
+	stats := testProxy.Stats()
+	if stats.ActiveFlows != 0 || stats.ActiveConns != 0 || stats.TotalFlows != 2 || !stats.Draining {
+		t.Fatalf("unexpected stats after shutdown %+v", stats)
+	}
+	if c, err := net.Dial("tcp", helper.proxyAddr); err == nil {
+		c.Close()
+		t.Fatal("expected the listener to be closed")
+	}
+}
+
+// flowsAddon sends the flows it sees
+type flowsAddon struct {
+	BaseAddon
+	flows chan *Flow
+}
+
+func (addon *flowsAddon) Requestheaders(f *Flow) {
+	addon.flows <- f
+}
+
+func TestProxyTimeouts(t *testing.T) {
+	helper := &testProxyHelper{
+		server: &http.Server{},
+	}
+	helper.init(t)
+	testProxy := helper.testProxy
+	testProxy.Opts.Timeouts.ResponseHeader = time.Millisecond * 100
+	flows := &flowsAddon{flows: make(chan *Flow, 10)}
+	testProxy.AddAddon(flows)
+	defer helper.ln.Close()
+	go helper.server.Serve(helper.ln)
+	defer helper.tlsPlainLn.Close()
+	go helper.server.Serve(helper.tlsLn)
+	go testProxy.Start()
+
+	test := func(t *testing.T, endpoint string) {
+		start := time.Now()
+		resp, err := helper.getProxyClient().Get(endpoint + "slow")
+		handleError(t, err)
+		resp.Body.Close()
+		if resp.StatusCode != 502 {
+			t.Fatalf("expected 502, but got %d", resp.StatusCode)
+		}
+		if time.Since(start) > time.Millisecond*800 {
+			t.Fatal("response header timeout not applied")
+		}
+
+		f := <-flows.flows
+		<-f.Done()
+		if f.Error() == nil || !strings.Contains(f.Error().Error(), "timeout") {
+			t.Fatalf("expected timeout error on the flow, but got %v", f.Error())
+		}
+	}
+	t.Run("http", func(t *testing.T) {
+		test(t, helper.httpEndpoint)
+	})
+	t.Run("https", func(t *testing.T) {
+		test(t, helper.httpsEndpoint)
+	})
+}
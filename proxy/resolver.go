@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Resolver resolves the host names of upstream servers, instead of the system resolver.
+type Resolver struct {
+	// Hosts maps host names to IPs, like /etc/hosts. A pattern "*.example.com" matches
+	// the subdomains of example.com but not example.com itself, the exact name and then
+	// the longest pattern win.
+	Hosts map[string]string
+
+	// DNSServer is the host:port of a DNS server to query for names not in Hosts,
+	// empty to use the system resolver.
+	DNSServer string
+
+	once     sync.Once
+	resolver *net.Resolver
+}
+
+// LookupHost returns the IPs of host, host is returned as is if it is an IP.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	if ip, ok := r.lookupHosts(host); ok {
+		return []string{ip}, nil
+	}
+
+	r.once.Do(func() {
+		r.resolver = net.DefaultResolver
+		if r.DNSServer != "" {
+			dnsServer := r.DNSServer
+			r.resolver = &net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, network, dnsServer)
+				},
+			}
+		}
+	})
+	return r.resolver.LookupHost(ctx, host)
+}
+
+func (r *Resolver) lookupHosts(host string) (string, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ip, ok := r.Hosts[host]; ok {
+		return ip, true
+	}
+	ip, longest := "", 0
+	for pattern, v := range r.Hosts {
+		suffix, ok := strings.CutPrefix(strings.ToLower(pattern), "*")
+		if !ok || !strings.HasSuffix(host, suffix) || len(host) == len(suffix) {
+			continue
+		}
+		if len(suffix) > longest {
+			ip, longest = v, len(suffix)
+		}
+	}
+	return ip, longest > 0
+}
@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+)
+
+func TestResolverHosts(t *testing.T) {
+	r := &Resolver{Hosts: map[string]string{
+		"api.example.com":       "10.0.0.1",
+		"*.example.com":         "10.0.0.2",
+		"*.staging.example.com": "10.0.0.3",
+	}}
+	cases := map[string]string{
+		"api.example.com":       "10.0.0.1",
+		"API.example.com.":      "10.0.0.1",
+		"www.example.com":       "10.0.0.2",
+		"a.staging.example.com": "10.0.0.3",
+		"staging.example.com":   "10.0.0.2",
+		"127.0.0.1":             "127.0.0.1",
+	}
+	for host, want := range cases {
+		ips, err := r.LookupHost(context.Background(), host)
+		handleError(t, err)
+		if len(ips) != 1 || ips[0] != want {
+			t.Fatalf("%s: expected %s, but got %v", host, want, ips)
+		}
+	}
+
+	if ip, ok := r.lookupHosts("example.com"); ok {
+		t.Fatalf("wildcard should not match the apex, but got %s", ip)
+	}
+}
@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errEventStreamClosed = errors.New("event stream closed")
+
+// ServerSentEvent is an event of a text/event-stream response.
+// https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
+type ServerSentEvent struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	Data      string    `json:"data"`
+	Retry     int       `json:"retry"` // 0 if not set
+	Timestamp time.Time `json:"timestamp"`
+	Injected  bool      `json:"injected"` // sent by an addon
+	Dropped   bool      `json:"dropped"`  // set by addons in ServerSentEvent to not forward the event
+
+	raw      []byte // the event as received, forwarded when not modified
+	original *ServerSentEvent
+}
+
+func (e *ServerSentEvent) modified() bool {
+	if e.original == nil {
+		return true
+	}
+	return e.ID != e.original.ID || e.Event != e.original.Event || e.Data != e.original.Data || e.Retry != e.original.Retry
+}
+
+func (e *ServerSentEvent) bytes() []byte {
+	if e.raw != nil && !e.modified() {
+		return e.raw
+	}
+
+	buf := new(strings.Builder)
+	if e.ID != "" {
+		buf.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Event != "" {
+		buf.WriteString("event: " + e.Event + "\n")
+	}
+	if e.Retry > 0 {
+		buf.WriteString("retry: " + strconv.Itoa(e.Retry) + "\n")
+	}
+	for _, line := range strings.Split(e.Data, "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+	return []byte(buf.String())
+}
+
+// maxEventStreamEvents caps the events kept by an EventStream, the oldest are dropped.
+const maxEventStreamEvents = 1000
+
+// EventStream holds the events of a text/event-stream response, set after the Responseheaders event if the response is streamed.
+type EventStream struct {
+	mu     sync.Mutex
+	events []*ServerSentEvent
+	w      io.Writer
+	closed bool
+}
+
+// Events returns the last events received or injected so far, at most 1000.
+func (es *EventStream) Events() []*ServerSentEvent {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	events := make([]*ServerSentEvent, len(es.events))
+	copy(events, es.events)
+	return events
+}
+
+// Inject sends an event to the client, between the events of the server.
+func (es *EventStream) Inject(e *ServerSentEvent) error {
+	e.Injected = true
+	e.Timestamp = time.Now()
+	e.raw = nil
+	es.addEvent(e)
+	return es.write(e)
+}
+
+func (es *EventStream) addEvent(e *ServerSentEvent) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.events = append(es.events, e)
+	if len(es.events) > maxEventStreamEvents {
+		es.events = es.events[len(es.events)-maxEventStreamEvents:]
+	}
+}
+
+func (es *EventStream) write(e *ServerSentEvent) error {
+	return es.writeRaw(e.bytes())
+}
+
+func (es *EventStream) writeRaw(data []byte) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.closed || es.w == nil {
+		return errEventStreamClosed
+	}
+	_, err := es.w.Write(data)
+	return err
+}
+
+func (es *EventStream) setWriter(w io.Writer) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.w = w
+}
+
+func (es *EventStream) close() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.closed = true
+}
+
+func (es *EventStream) MarshalJSON() ([]byte, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return json.Marshal(map[string]any{
+		"events": es.events,
+	})
+}
+
+func isEventStream(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// readEventBlock reads the lines of the next event until a blank line.
+// Blocks without fields (comments only, e.g. keep-alive) return a nil event with the raw block.
+func readEventBlock(r *bufio.Reader) (*ServerSentEvent, []byte, error) {
+	var raw []byte
+	var e *ServerSentEvent
+	var data []string
+
+	for {
+		line, err := r.ReadBytes('\n')
+		raw = append(raw, line...)
+		if err != nil {
+			// incomplete event at the end of the stream is forwarded as is
+			return nil, raw, err
+		}
+
+		text := strings.TrimRight(string(line), "\r\n")
+		if text == "" {
+			if e != nil {
+				e.Data = strings.Join(data, "\n")
+				e.raw = raw
+				original := *e
+				e.original = &original
+			}
+			return e, raw, nil
+		}
+		if strings.HasPrefix(text, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(text, ":")
+		value = strings.TrimPrefix(value, " ")
+		if e == nil {
+			e = &ServerSentEvent{Timestamp: time.Now()}
+		}
+		switch field {
+		case "id":
+			e.ID = value
+		case "event":
+			e.Event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if retry, err := strconv.Atoi(value); err == nil {
+				e.Retry = retry
+			}
+		}
+	}
+}
+
+// replyEventStream replies the headers of f.Response, then relays the events of body.
+// Compressed streams are decoded so that each event can be flushed to the client.
+// done is closed when the client request is done, which stops waiting on the throttle.
+func (proxy *Proxy) replyEventStream(res http.ResponseWriter, f *Flow, body io.Reader, reply func(*Response, io.Reader), done <-chan struct{}, logger *slog.Logger) {
+	dbody, err := DecodeReader(f.Response.Header, body)
+	if err != nil {
+		logger.Error("could not decode event stream", "error", err)
+		res.WriteHeader(502)
+		return
+	}
+	defer dbody.Close()
+	f.Response.Header.Del("Content-Encoding")
+	f.Response.Header.Del("Content-Length")
+
+	f.EventStream = &EventStream{
+		events: make([]*ServerSentEvent, 0),
+	}
+	reply(f.Response, nil)
+	if err := proxy.relayEventStream(f.throttle.writer(flushWriter{res}, done), f, dbody); err != nil && err != errEventStreamClosed {
+		logErr(logger, "event stream relay", err)
+	}
+}
+
+// relayEventStream forwards the events of body to w one by one through the ServerSentEvent addon event.
+func (proxy *Proxy) relayEventStream(w io.Writer, f *Flow, body io.Reader) error {
+	es := f.EventStream
+	es.setWriter(w)
+	defer es.close()
+
+	r := bufio.NewReader(body)
+	for {
+		e, raw, err := readEventBlock(r)
+		if e == nil {
+			if len(raw) > 0 {
+				if werr := es.writeRaw(raw); werr != nil {
+					return werr
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			continue
+		}
+
+		es.addEvent(e)
+		for _, addon := range proxy.Addons {
+			addon.ServerSentEvent(f, e)
+		}
+		if f.Killed() {
+			return errEventStreamClosed
+		}
+		if e.Dropped {
+			continue
+		}
+		if err := es.write(e); err != nil {
+			return err
+		}
+	}
+}
+
+// flushWriter flushes the response after each write, so streamed bodies reach the client as they arrive.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := http.NewResponseController(fw.w).Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
+}
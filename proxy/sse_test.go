@@ -0,0 +1,20 @@
+package proxy
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestEventStreamEventsCapped(t *testing.T) {
+	es := &EventStream{}
+	for i := 0; i < maxEventStreamEvents+10; i++ {
+		es.addEvent(&ServerSentEvent{ID: strconv.Itoa(i)})
+	}
+	events := es.Events()
+	if len(events) != maxEventStreamEvents {
+		t.Fatalf("expected %d events, but got %d", maxEventStreamEvents, len(events))
+	}
+	if events[0].ID != "10" {
+		t.Fatalf("expected the oldest events dropped, but the first is %s", events[0].ID)
+	}
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the counts of client connections and flows of the proxy.
+type Stats struct {
+	ActiveConns       int64 `json:"activeConns"`       // open client connections, CONNECT tunnels included
+	ActiveServerConns int64 `json:"activeServerConns"` // open server connections, pooled ones included
+	ActiveTunnels     int64 `json:"activeTunnels"`     // CONNECT tunnels
+	ActiveFlows       int64 `json:"activeFlows"`       // http, websocket and tcp flows in progress
+	TotalConns        int64 `json:"totalConns"`
+	TotalFlows        int64 `json:"totalFlows"`
+	ClientTLSFailures int64 `json:"clientTlsFailures"` // failed TLS handshakes with clients, e.g. not trusting the CA or after a server failure
+	ServerTLSFailures int64 `json:"serverTlsFailures"` // failed TLS handshakes with servers
+	AddonPanics       int64 `json:"addonPanics"`       // panics of addons recovered while handling a flow
+	Draining          bool  `json:"draining"`          // Shutdown was called, new connections and tunnels are refused
+}
+
+// tracker tracks the client connections, which the http server forgets once hijacked by CONNECT,
+// and the flows in progress, so Shutdown can wait for them.
+type tracker struct {
+	mu         sync.Mutex
+	conns      map[*wrapClientConn]struct{}
+	totalConns int64
+
+	activeFlows atomic.Int64
+	totalFlows  atomic.Int64
+	draining    atomic.Bool
+
+	serverConns       atomic.Int64
+	tunnels           atomic.Int64
+	clientTLSFailures atomic.Int64
+	serverTLSFailures atomic.Int64
+	addonPanics       atomic.Int64
+}
+
+func newTracker() *tracker {
+	return &tracker{conns: make(map[*wrapClientConn]struct{})}
+}
+
+func (t *tracker) addConn(c *wrapClientConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conns[c] = struct{}{}
+	t.totalConns++
+}
+
+func (t *tracker) removeConn(c *wrapClientConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, c)
+}
+
+// closeConns closes the client connections still open, hijacked ones included.
+func (t *tracker) closeConns() {
+	t.mu.Lock()
+	conns := make([]*wrapClientConn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// flowStarted counts a flow in progress until the returned func is called.
+func (t *tracker) flowStarted() (done func()) {
+	t.activeFlows.Add(1)
+	t.totalFlows.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { t.activeFlows.Add(-1) })
+	}
+}
+
+// waitFlows waits until no flow is in progress or ctx is done.
+func (t *tracker) waitFlows(ctx context.Context) error {
+	interval := time.Millisecond
+	for t.activeFlows.Load() > 0 {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if interval < 500*time.Millisecond {
+			interval *= 2
+		}
+	}
+	return nil
+}
+
+// Stats returns the current counts of client connections and flows.
+func (proxy *Proxy) Stats() Stats {
+	t := proxy.tracker
+	t.mu.Lock()
+	stats := Stats{
+		ActiveConns: int64(len(t.conns)),
+		TotalConns:  t.totalConns,
+	}
+	t.mu.Unlock()
+	stats.ActiveFlows = t.activeFlows.Load()
+	stats.TotalFlows = t.totalFlows.Load()
+	stats.ActiveServerConns = t.serverConns.Load()
+	stats.ActiveTunnels = t.tunnels.Load()
+	stats.ClientTLSFailures = t.clientTLSFailures.Load()
+	stats.ServerTLSFailures = t.serverTLSFailures.Load()
+	stats.AddonPanics = t.addonPanics.Load()
+	stats.Draining = t.draining.Load()
+	return stats
+}
@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"regexp"
+)
+
+// Helpers for StreamRequestModifier and StreamResponseModifier.
+//
+// For example, rewrite a large html response:
+//
+//	func (a *MyAddon) StreamResponseModifier(f *proxy.Flow, in io.Reader) io.Reader {
+//		return f.Response.ModifyStream(in, func(r io.Reader) io.Reader {
+//			return proxy.NewReplaceReader(r, re, []byte("${1}"), 1024)
+//		})
+//	}
+
+// DecodeReader wraps r to decompress it according to the Content-Encoding of header.
+func DecodeReader(header http.Header, r io.Reader) (io.ReadCloser, error) {
+	encs := parseEncodings(contentEncoding(header))
+	rc := io.NopCloser(r)
+	for i := len(encs) - 1; i >= 0; i-- {
+		dreader, err := newDecodeReader(encs[i], rc)
+		if err != nil {
+			return nil, err
+		}
+		rc = dreader
+	}
+	return rc, nil
+}
+
+// EncodeReader returns a reader of r compressed according to the Content-Encoding of header.
+// r is read and compressed as the returned reader is read, e.g. until the flow is aborted.
+func EncodeReader(header http.Header, r io.Reader) (io.ReadCloser, error) {
+	encs := parseEncodings(contentEncoding(header))
+	if len(encs) == 0 {
+		return io.NopCloser(r), nil
+	}
+
+	er := &encodeReader{src: r, buf: make([]byte, 32*1024)}
+	var w io.Writer = &er.out
+	// the last applied coding is the outermost
+	for i := len(encs) - 1; i >= 0; i-- {
+		ewriter, err := newEncodeWriter(encs[i], w)
+		if err != nil {
+			return nil, err
+		}
+		er.writers = append(er.writers, ewriter)
+		w = ewriter
+	}
+	er.w = w
+	return er, nil
+}
+
+// encodeReader compresses its source in Read, through the encode writers into out.
+type encodeReader struct {
+	src     io.Reader
+	w       io.Writer
+	writers []io.WriteCloser // innermost first
+	out     bytes.Buffer     // compressed, not yet returned
+	buf     []byte
+	err     error
+}
+
+func (r *encodeReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		n, err := r.src.Read(r.buf)
+		if n > 0 {
+			if _, werr := r.w.Write(r.buf[:n]); werr != nil {
+				r.err = werr
+				continue
+			}
+		}
+		if err != nil {
+			r.err = err
+			if err == io.EOF {
+				r.err = r.closeWriters()
+				if r.err == nil {
+					r.err = io.EOF
+				}
+			}
+		}
+	}
+	return r.out.Read(p)
+}
+
+// closeWriters flushes the remaining compressed data to out, the outermost writer last.
+func (r *encodeReader) closeWriters() error {
+	var err error
+	for i := len(r.writers) - 1; i >= 0; i-- {
+		if cerr := r.writers[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	r.writers = nil
+	return err
+}
+
+func (r *encodeReader) Close() error {
+	if r.err == nil {
+		r.err = io.ErrClosedPipe
+	}
+	r.closeWriters()
+	r.out.Reset()
+	return nil
+}
+
+// ModifyStream decodes the request body stream, passes it to modify and re-encodes the result
+// with the original Content-Encoding. As the length of the body is unknown after modification,
+// Content-Length is removed and the body will be sent chunked.
+// If the body can not be decoded, in is returned unmodified.
+func (r *Request) ModifyStream(in io.Reader, modify func(io.Reader) io.Reader) io.Reader {
+	return modifyStream(r.Header, in, modify)
+}
+
+// ModifyStream decodes the response body stream, passes it to modify and re-encodes the result
+// with the original Content-Encoding. As the length of the body is unknown after modification,
+// Content-Length is removed and the body will be sent chunked.
+// If the body can not be decoded, in is returned unmodified.
+func (r *Response) ModifyStream(in io.Reader, modify func(io.Reader) io.Reader) io.Reader {
+	return modifyStream(r.Header, in, modify)
+}
+
+func modifyStream(header http.Header, in io.Reader, modify func(io.Reader) io.Reader) io.Reader {
+	if in == nil {
+		return nil
+	}
+
+	dreader, err := DecodeReader(header, in)
+	if err != nil {
+		sLogger.Error("could not decode stream", "error", err)
+		return in
+	}
+	ereader, err := EncodeReader(header, modify(dreader))
+	if err != nil {
+		sLogger.Error("could not encode stream", "error", err)
+		return in
+	}
+
+	header.Del("Content-Length")
+	header.Del("Transfer-Encoding")
+	return ereader
+}
+
+// replaceReader replaces regexp matches in a stream.
+type replaceReader struct {
+	src         io.Reader
+	re          *regexp.Regexp
+	repl        []byte
+	maxMatchLen int
+
+	pending []byte // read from src, not yet processed
+	out     []byte // processed, not yet returned
+	buf     []byte
+	err     error
+}
+
+// NewReplaceReader returns a reader replacing matches of re in r with repl, which supports
+// regexp.Expand templates like ${1}. Matches may span reads of the underlying reader,
+// but must not be longer than maxMatchLen bytes.
+func NewReplaceReader(r io.Reader, re *regexp.Regexp, repl []byte, maxMatchLen int) io.Reader {
+	if maxMatchLen <= 0 {
+		maxMatchLen = 4096
+	}
+	return &replaceReader{
+		src:         r,
+		re:          re,
+		repl:        repl,
+		maxMatchLen: maxMatchLen,
+		buf:         make([]byte, 32*1024),
+	}
+}
+
+func (r *replaceReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		n, err := r.src.Read(r.buf)
+		r.pending = append(r.pending, r.buf[:n]...)
+		if err != nil {
+			r.err = err
+			r.process(true)
+		} else {
+			r.process(false)
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// process moves pending data to out. Unless final, the last maxMatchLen bytes are kept back,
+// as a match could start in them and continue in data not read yet.
+func (r *replaceReader) process(final bool) {
+	limit := len(r.pending)
+	if !final {
+		limit -= r.maxMatchLen
+		if limit <= 0 {
+			return
+		}
+	}
+
+	out := bytes.NewBuffer(r.out)
+	pos := 0
+	for _, m := range r.re.FindAllSubmatchIndex(r.pending, -1) {
+		if m[0] >= limit {
+			break
+		}
+		out.Write(r.pending[pos:m[0]])
+		out.Write(r.re.Expand(nil, r.repl, r.pending, m))
+		pos = m[1]
+	}
+	if pos < limit {
+		out.Write(r.pending[pos:limit])
+		pos = limit
+	}
+
+	r.out = out.Bytes()
+	r.pending = append(r.pending[:0:0], r.pending[pos:]...)
+}
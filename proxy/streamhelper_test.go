@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReplaceReader(t *testing.T) {
+	re := regexp.MustCompile(`(<title>)(.*?)(</title>)`)
+	src := strings.Repeat("x", 100) + "<title>hello</title>" + strings.Repeat("y", 100) + "<title>world</title>"
+	want := re.ReplaceAllString(src, "${1}${2} - go-mitmproxy${3}")
+
+	// one byte per read, so matches always span reads
+	r := NewReplaceReader(iotest.OneByteReader(strings.NewReader(src)), re, []byte("${1}${2} - go-mitmproxy${3}"), 64)
+	got, err := io.ReadAll(r)
+	handleError(t, err)
+	if string(got) != want {
+		t.Fatalf("expected %s, but got %s", want, got)
+	}
+}
+
+func TestModifyStream(t *testing.T) {
+	body := strings.Repeat("hello world ", 1000)
+	encoded, err := encode("gzip", []byte(body))
+	handleError(t, err)
+
+	res := &Response{Header: make(http.Header)}
+	res.Header.Set("Content-Encoding", "gzip")
+	res.Header.Set("Content-Length", "100")
+
+	r := res.ModifyStream(bytes.NewReader(encoded), func(r io.Reader) io.Reader {
+		return NewReplaceReader(r, regexp.MustCompile("world"), []byte("mitmproxy"), 16)
+	})
+	if res.Header.Get("Content-Length") != "" {
+		t.Fatal("Content-Length should be removed")
+	}
+
+	got, err := io.ReadAll(r)
+	handleError(t, err)
+	decoded, err := decode("gzip", got)
+	handleError(t, err)
+	if string(decoded) != strings.ReplaceAll(body, "world", "mitmproxy") {
+		t.Fatal("modified body mismatch")
+	}
+}
+
+func TestEncodeReader(t *testing.T) {
+	body := strings.Repeat("hello world ", 10000)
+	header := make(http.Header)
+	header.Set("Content-Encoding", "deflate, gzip")
+
+	r, err := EncodeReader(header, iotest.HalfReader(strings.NewReader(body)))
+	handleError(t, err)
+	got, err := io.ReadAll(r)
+	handleError(t, err)
+	decoded, err := decode("gzip", got)
+	handleError(t, err)
+	decoded, err = decode("deflate", decoded)
+	handleError(t, err)
+	if string(decoded) != body {
+		t.Fatal("encoded body mismatch")
+	}
+
+	// an aborted flow does not read until EOF, nothing is left encoding its body
+	r, err = EncodeReader(header, strings.NewReader(body))
+	handleError(t, err)
+	buf := make([]byte, 10)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	handleError(t, r.Close())
+	if _, err := r.Read(buf); err != io.ErrClosedPipe {
+		t.Fatalf("expected %v after Close, but got %v", io.ErrClosedPipe, err)
+	}
+}
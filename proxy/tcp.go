@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// wait this long for the client to speak first, otherwise the tunnel is treated as raw tcp.
+const tcpDetectTimeout = time.Second
+
+const tcpReadBufferSize = 32 * 1024
+
+// TCPMessage is a chunk of data read from the client or server of a TCPFlow.
+// Chunks follow the reads of the connection, not the framing of the protocol.
+type TCPMessage struct {
+	Content    []byte    `json:"content"`
+	FromClient bool      `json:"fromClient"`
+	Timestamp  time.Time `json:"timestamp"`
+	Dropped    bool      `json:"dropped"` // set by addons in TcpMessage to not forward the chunk
+}
+
+// TCPFlow is a CONNECT tunnel carrying a protocol other than tls or http.
+type TCPFlow struct {
+	Id          uuid.UUID
+	ConnContext *ConnContext
+	Host        string // server host:port
+
+	mu   sync.Mutex
+	err  error
+	done chan struct{}
+}
+
+func newTCPFlow(connCtx *ConnContext, host string) *TCPFlow {
+	return &TCPFlow{
+		Id:          uuid.New(),
+		ConnContext: connCtx,
+		Host:        host,
+		done:        make(chan struct{}),
+	}
+}
+
+// Done is closed when both directions of the flow have ended.
+func (f *TCPFlow) Done() <-chan struct{} {
+	return f.done
+}
+
+// Error returns the first error that ended the flow, nil if the flow ended normally.
+func (f *TCPFlow) Error() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *TCPFlow) setError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+func (f *TCPFlow) MarshalJSON() ([]byte, error) {
+	j := make(map[string]interface{})
+	j["id"] = f.Id
+	j["host"] = f.Host
+	if err := f.Error(); err != nil {
+		j["error"] = err.Error()
+	}
+	return json.Marshal(j)
+}
+
+// peekClient peeks the first bytes sent by the client. Server-first protocols (e.g. smtp)
+// send nothing until the server greets, so ok is false after tcpDetectTimeout.
+func peekClient(pipeServerConn *pipeConn, n int) (buf []byte, ok bool, err error) {
+	if err := pipeServerConn.SetReadDeadline(time.Now().Add(tcpDetectTimeout)); err != nil {
+		return nil, false, err
+	}
+	defer pipeServerConn.SetReadDeadline(time.Time{})
+
+	buf, err = pipeServerConn.Peek(n)
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return buf, false, nil
+		}
+		return nil, false, err
+	}
+	return buf, true, nil
+}
+
+// handleTCP relays the tunnel to the server connection through the TcpStart, TcpMessage and TcpEnd addon events.
+func (proxy *Proxy) handleTCP(pipeServerConn *pipeConn) {
+	connCtx := pipeServerConn.connContext
+	logger := sLogger.With(
+		"in", "Proxy.handleTCP",
+		"host", pipeServerConn.host,
+	)
+
+	f := newTCPFlow(connCtx, pipeServerConn.host)
+	defer proxy.tracker.flowStarted()()
+	serverConn := connCtx.ServerConn.Conn
+	defer close(f.done)
+	defer pipeServerConn.Close()
+	defer serverConn.Close()
+
+	for _, addon := range proxy.Addons {
+		addon.TcpStart(f)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer serverConn.Close()
+		proxy.relayTCP(f, pipeServerConn, serverConn, true)
+	}()
+	go func() {
+		defer wg.Done()
+		defer pipeServerConn.Close()
+		proxy.relayTCP(f, serverConn, pipeServerConn, false)
+	}()
+	wg.Wait()
+
+	if err := f.Error(); err != nil {
+		logErr(logger, "tcp relay", err)
+	}
+
+	for _, addon := range proxy.Addons {
+		addon.TcpEnd(f)
+	}
+}
+
+// relayTCP reads chunks from src and writes them to dst, until src or dst fails.
+func (proxy *Proxy) relayTCP(f *TCPFlow, src io.Reader, dst io.Writer, fromClient bool) {
+	buf := make([]byte, tcpReadBufferSize)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			msg := &TCPMessage{
+				Content:    append([]byte(nil), buf[:n]...),
+				FromClient: fromClient,
+				Timestamp:  time.Now(),
+			}
+			for _, addon := range proxy.Addons {
+				addon.TcpMessage(f, msg)
+			}
+			if !msg.Dropped && len(msg.Content) > 0 {
+				if _, werr := dst.Write(msg.Content); werr != nil {
+					f.setError(werr)
+					return
+				}
+			}
+		}
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) && !errors.Is(err, io.ErrClosedPipe) {
+				f.setError(err)
+			}
+			return
+		}
+	}
+}
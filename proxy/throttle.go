@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errThrottleCanceled = errors.New("throttle wait canceled")
+
+// RateLimiter is a token bucket, e.g. of bytes or requests per second.
+// It can be shared by flows and connections, which are then limited together.
+type RateLimiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a full bucket of burst tokens refilled at rate tokens per second, unlimited if rate is not positive.
+// burst is rate, at least 1, if not positive.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	b := float64(burst)
+	if burst <= 0 {
+		b = max(rate, 1)
+	}
+	return &RateLimiter{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}
+
+// Allow takes a token if there is one.
+func (l *RateLimiter) Allow() bool {
+	if l.rate <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// Wait takes n tokens, waiting until they are refilled or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	return l.wait(ctx.Done(), n)
+}
+
+// wait takes n tokens, going into debt if there are not enough, and waits for the debt to be refilled.
+func (l *RateLimiter) wait(done <-chan struct{}, n int) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-done:
+		return errThrottleCanceled
+	}
+}
+
+// Throttle is the rate limiters of bytes per second of a flow or client connection.
+type Throttle struct {
+	Upload   []*RateLimiter // from the client to the server
+	Download []*RateLimiter // from the server to the client
+}
+
+// add returns a copy of t with the limiters added, t may be nil.
+func (t *Throttle) add(upload, download *RateLimiter) *Throttle {
+	nt := &Throttle{}
+	if t != nil {
+		nt.Upload = append(nt.Upload, t.Upload...)
+		nt.Download = append(nt.Download, t.Download...)
+	}
+	if upload != nil {
+		nt.Upload = append(nt.Upload, upload)
+	}
+	if download != nil {
+		nt.Download = append(nt.Download, download)
+	}
+	return nt
+}
+
+// throttle is the Throttle of a flow or connection, which can be added to while its bytes are relayed.
+type throttle struct {
+	mu sync.Mutex
+	p  atomic.Pointer[Throttle]
+}
+
+func (t *throttle) add(upload, download *RateLimiter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.Store(t.p.Load().add(upload, download))
+}
+
+func (t *throttle) get() *Throttle {
+	return t.p.Load()
+}
+
+// chunkSize is how many bytes can be relayed at once without exceeding the burst of limiters.
+// Unlimited limiters do not cut the chunks.
+func chunkSize(limiters []*RateLimiter, n int) int {
+	for _, l := range limiters {
+		if l.rate <= 0 {
+			continue
+		}
+		n = min(n, max(int(l.burst), 1))
+	}
+	return n
+}
+
+func waitAll(limiters []*RateLimiter, done <-chan struct{}, n int) error {
+	for _, l := range limiters {
+		if err := l.wait(done, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// throttledReader waits for the limiters of the direction after each read.
+type throttledReader struct {
+	r        io.Reader
+	limiters func() []*RateLimiter
+	done     <-chan struct{}
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	limiters := r.limiters()
+	if len(limiters) == 0 {
+		return r.r.Read(p)
+	}
+	n, err := r.r.Read(p[:chunkSize(limiters, len(p))])
+	if n > 0 {
+		if werr := waitAll(limiters, r.done, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+// throttledWriter waits for the limiters of the direction before writing each chunk.
+type throttledWriter struct {
+	w        io.Writer
+	limiters func() []*RateLimiter
+	done     <-chan struct{}
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	limiters := w.limiters()
+	if len(limiters) == 0 {
+		return w.w.Write(p)
+	}
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:chunkSize(limiters, len(p))]
+		if err := waitAll(limiters, w.done, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// AddThrottle limits the bytes per second of the client connection, tunnels and websockets included,
+// upload from the client and download to the client, either can be nil. It adds to the limiters already set.
+func (c *ClientConn) AddThrottle(upload, download *RateLimiter) {
+	c.Conn.throttle.add(upload, download)
+}
+
+// Throttle returns the limiters of the client connection, nil if none.
+func (c *ClientConn) Throttle() *Throttle {
+	return c.Conn.throttle.get()
+}
+
+// AddThrottle limits the bytes per second of the request and response bodies of the flow,
+// or of its websocket messages, either can be nil. It adds to the limiters already set.
+func (f *Flow) AddThrottle(upload, download *RateLimiter) {
+	f.throttle.add(upload, download)
+}
+
+// Throttle returns the limiters of the flow, nil if none.
+func (f *Flow) Throttle() *Throttle {
+	return f.throttle.get()
+}
+
+func (t *throttle) upload() []*RateLimiter {
+	if p := t.get(); p != nil {
+		return p.Upload
+	}
+	return nil
+}
+
+func (t *throttle) download() []*RateLimiter {
+	if p := t.get(); p != nil {
+		return p.Download
+	}
+	return nil
+}
+
+// reader returns r throttled by the upload limiters, including those added later.
+func (t *throttle) reader(r io.Reader, done <-chan struct{}) io.Reader {
+	return &throttledReader{r: r, limiters: t.upload, done: done}
+}
+
+// writer returns w throttled by the download limiters, including those added later.
+func (t *throttle) writer(w io.Writer, done <-chan struct{}) io.Writer {
+	return &throttledWriter{w: w, limiters: t.download, done: done}
+}
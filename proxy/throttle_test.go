@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(10, 2)
+	if !l.Allow() || !l.Allow() {
+		t.Fatal("expected the burst to be allowed")
+	}
+	if l.Allow() {
+		t.Fatal("expected the empty bucket to refuse")
+	}
+
+	start := time.Now()
+	handleError(t, l.Wait(context.Background(), 1))
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("expected to wait for a token, but waited %v", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx, 100); err == nil {
+		t.Fatal("expected the canceled wait to fail")
+	}
+
+	unlimited := NewRateLimiter(0, 0)
+	for i := 0; i < 1000; i++ {
+		if !unlimited.Allow() {
+			t.Fatal("expected no limit")
+		}
+	}
+	if n := chunkSize([]*RateLimiter{unlimited, NewRateLimiter(1000, 100)}, 32*1024); n != 100 {
+		t.Fatalf("expected chunks of the limited burst, but got %d", n)
+	}
+	if n := chunkSize([]*RateLimiter{unlimited}, 32*1024); n != 32*1024 {
+		t.Fatalf("expected unlimited limiters not to cut chunks, but got %d", n)
+	}
+}
+
+func TestThrottledWriter(t *testing.T) {
+	var th throttle
+	var out bytes.Buffer
+	w := th.writer(&out, nil)
+
+	start := time.Now()
+	io.WriteString(w, "unlimited")
+	th.add(nil, NewRateLimiter(1000, 100))
+	io.Copy(w, strings.NewReader(strings.Repeat("x", 300)))
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Fatalf("expected 300 bytes at 1000 bytes per second to take 200ms, but took %v", d)
+	}
+	if out.Len() != 309 {
+		t.Fatalf("expected 309 bytes, but got %d", out.Len())
+	}
+}
+
+// throttleAddon throttles the uploads of /trailer, and the connections of clients once throttleConns is set
+type throttleAddon struct {
+	BaseAddon
+	throttleConns atomic.Bool
+}
+
+func (addon *throttleAddon) ClientConnected(client *ClientConn) {
+	if addon.throttleConns.Load() {
+		client.AddThrottle(nil, NewRateLimiter(4000, 100))
+	}
+}
+
+func (addon *throttleAddon) Requestheaders(f *Flow) {
+	if f.Request.URL.Path == "/trailer" {
+		f.AddThrottle(NewRateLimiter(20000, 1000), nil)
+	}
+}
+
+func TestProxyThrottle(t *testing.T) {
+	helper := &testProxyHelper{
+		server: &http.Server{},
+	}
+	helper.init(t)
+	testProxy := helper.testProxy
+	defer helper.ln.Close()
+	go helper.server.Serve(helper.ln)
+	defer helper.tlsPlainLn.Close()
+	go helper.server.Serve(helper.tlsLn)
+	throttler := &throttleAddon{}
+	testProxy.AddAddon(throttler)
+	go testProxy.Start()
+	defer testProxy.Close()
+
+	post := func(client *http.Client, endpoint string, size int) time.Duration {
+		t.Helper()
+		start := time.Now()
+		resp, err := client.Post(endpoint+"trailer", "text/plain", strings.NewReader(strings.Repeat("x", size)))
+		handleError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		handleError(t, err)
+		if len(body) != size {
+			t.Fatalf("expected %d bytes, but got %d", size, len(body))
+		}
+		return time.Since(start)
+	}
+
+	// (10000 - 1000) bytes of the request at 20000 bytes per second
+	if d := post(helper.getProxyClient(), helper.httpEndpoint, 10000); d < 400*time.Millisecond {
+		t.Fatalf("expected the upload to be throttled, but took %v", d)
+	}
+
+	// the response through the tunnel at 4000 bytes per second, besides the TLS handshake
+	throttler.throttleConns.Store(true)
+	if d := post(helper.getProxyClient(), helper.httpsEndpoint, 4000); d < 900*time.Millisecond {
+		t.Fatalf("expected the connection to be throttled, but took %v", d)
+	}
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// defaultConnectTimeout is used for the CONNECT to an upstream proxy when Timeouts.Connect is zero.
+const defaultConnectTimeout = time.Minute
+
+// Timeouts of each phase of a proxied connection, a zero duration means no timeout unless noted.
+// Upstream errors, timeouts included, are reported by Flow.Error.
+type Timeouts struct {
+	ClientReadHeader time.Duration // reading the request headers of the client, the TLS handshake with the client included
+	ClientRead       time.Duration // reading a whole request of the client, body included
+	ClientIdle       time.Duration // keep-alive of an idle client connection
+	Dial             time.Duration // connecting to the server or the upstream proxy
+	Connect          time.Duration // CONNECT to the upstream proxy, one minute if zero
+	TLSHandshake     time.Duration // TLS handshake with the server
+	ResponseHeader   time.Duration // waiting for the response headers once the request is sent
+	UpstreamIdle     time.Duration // keep-alive of an idle pooled server connection, 90 seconds if zero
+	InterceptWait    time.Duration // waiting for the user to resume a flow intercepted in the web interface
+}
+
+// Timeouts returns the timeouts of the proxy of the connection.
+func (connCtx *ConnContext) Timeouts() Timeouts {
+	return connCtx.proxy.Opts.Timeouts
+}
+
+func (t Timeouts) dialer() *net.Dialer {
+	return &net.Dialer{Timeout: t.Dial}
+}
+
+func (t Timeouts) connectTimeout() time.Duration {
+	if t.Connect > 0 {
+		return t.Connect
+	}
+	return defaultConnectTimeout
+}
+
+// withTimeout is context.WithTimeout, without a deadline if d is zero.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
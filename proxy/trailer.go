@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// InformationalResponse is a 1xx response received before the final response, e.g. 103 Early Hints.
+type InformationalResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Timestamp  time.Time   `json:"timestamp"`
+}
+
+// Informational returns the 1xx responses received from the server so far.
+func (f *Flow) Informational() []*InformationalResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*InformationalResponse(nil), f.informational...)
+}
+
+// withInformational returns a context which records the 1xx responses of the upstream request on f
+// and relays them to the client. 100 Continue is not relayed, the server sends it itself once the request body is read.
+func withInformational(ctx context.Context, f *Flow, res http.ResponseWriter) context.Context {
+	var mu sync.Mutex
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			f.mu.Lock()
+			f.informational = append(f.informational, &InformationalResponse{
+				StatusCode: code,
+				Header:     http.Header(header).Clone(),
+				Timestamp:  time.Now(),
+			})
+			f.mu.Unlock()
+
+			if code == http.StatusContinue {
+				return nil
+			}
+			// the header map is shared with the final response, remove the 1xx headers once written
+			h := res.Header()
+			for k, v := range header {
+				h[k] = v
+			}
+			res.WriteHeader(code)
+			for k := range header {
+				delete(h, k)
+			}
+			return nil
+		},
+	})
+}
+
+// declareTrailers announces the trailer keys of response in the Trailer header, it must be called before WriteHeader.
+// Content-Length is removed since trailers are only sent with a chunked body.
+func declareTrailers(h http.Header, response *Response) {
+	if len(response.Trailer) == 0 {
+		return
+	}
+	h.Del("Content-Length")
+	for k := range response.Trailer {
+		h.Add("Trailer", k)
+	}
+}
+
+// writeTrailers sets the trailer values after the body, keys not declared before WriteHeader use http.TrailerPrefix.
+func writeTrailers(h http.Header, trailer http.Header) {
+	if len(trailer) == 0 {
+		return
+	}
+	declared := make(map[string]bool)
+	for _, k := range h.Values("Trailer") {
+		declared[http.CanonicalHeaderKey(k)] = true
+	}
+	for k, v := range trailer {
+		if declared[k] {
+			h[k] = v
+		} else {
+			h[http.TrailerPrefix+k] = v
+		}
+	}
+}
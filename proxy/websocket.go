@@ -1,71 +1,410 @@
 package proxy
 
 import (
+	"bufio"
+	"context"
 	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"net/http"
-	"net/http/httputil"
 	"strings"
+	"sync"
+	"time"
 )
 
-// Currently only forwarding websocket flow.
+// WebSocket message types, same as the frame opcodes.
+const (
+	WebSocketTextMessage   = int(wsOpText)
+	WebSocketBinaryMessage = int(wsOpBinary)
+)
 
-type webSocket struct{}
+var errWebSocketClosed = errors.New("websocket closed")
 
-var defaultWebSocket webSocket
+// maxWebSocketMessages caps the messages kept by a WebSocket, the oldest are dropped.
+const maxWebSocketMessages = 1000
 
-func (s *webSocket) ws(conn net.Conn, host string) {
-	logger := sLogger.With(
-		"in", "webSocket.ws",
-		"host", host,
-	)
+// WebSocketMessage is a complete (defragmented) websocket data message.
+type WebSocketMessage struct {
+	Type       int       `json:"type"`
+	Content    []byte    `json:"content"`
+	FromClient bool      `json:"fromClient"`
+	Timestamp  time.Time `json:"timestamp"`
+	Injected   bool      `json:"injected"` // sent by an addon
+	Dropped    bool      `json:"dropped"`  // set by addons in WebsocketMessage to not forward the message
+}
 
-	defer conn.Close()
-	remoteConn, err := net.Dial("tcp", host)
-	if err != nil {
-		logErr(logger, "websocket dial", err)
+func (m *WebSocketMessage) IsText() bool {
+	return m.Type == WebSocketTextMessage
+}
+
+// WebSocket holds the websocket connection of a flow after the upgrade.
+type WebSocket struct {
+	mu             sync.Mutex
+	messages       []*WebSocketMessage
+	closeCode      int
+	closeReason    string
+	closedByClient bool
+
+	f        *Flow
+	toClient *wsFrameWriter
+	toServer *wsFrameWriter
+}
+
+// Messages returns the last messages received or injected so far, at most 1000.
+func (ws *WebSocket) Messages() []*WebSocketMessage {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	messages := make([]*WebSocketMessage, len(ws.messages))
+	copy(messages, ws.messages)
+	return messages
+}
+
+// CloseStatus returns the close code and reason, and whether the client initiated the close.
+func (ws *WebSocket) CloseStatus() (code int, reason string, byClient bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.closeCode, ws.closeReason, ws.closedByClient
+}
+
+// SendToClient injects a message to the client.
+func (ws *WebSocket) SendToClient(messageType int, content []byte) error {
+	return ws.inject(ws.toClient, false, messageType, content)
+}
+
+// SendToServer injects a message to the server.
+func (ws *WebSocket) SendToServer(messageType int, content []byte) error {
+	return ws.inject(ws.toServer, true, messageType, content)
+}
+
+func (ws *WebSocket) inject(w *wsFrameWriter, fromClient bool, messageType int, content []byte) error {
+	msg := &WebSocketMessage{
+		Type:       messageType,
+		Content:    content,
+		FromClient: fromClient,
+		Timestamp:  time.Now(),
+		Injected:   true,
+	}
+	ws.addMessage(msg)
+	return w.writeFrame(true, byte(messageType), content)
+}
+
+func (ws *WebSocket) addMessage(msg *WebSocketMessage) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.messages = append(ws.messages, msg)
+	if len(ws.messages) > maxWebSocketMessages {
+		ws.messages = ws.messages[len(ws.messages)-maxWebSocketMessages:]
+	}
+}
+
+func (ws *WebSocket) setClose(payload []byte, fromClient bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closeCode != 0 {
 		return
 	}
-	defer remoteConn.Close()
-	transfer(logger, conn, remoteConn)
+	ws.closeCode = 1005 // no status code present
+	if len(payload) >= 2 {
+		ws.closeCode = int(binary.BigEndian.Uint16(payload))
+		ws.closeReason = string(payload[2:])
+	}
+	ws.closedByClient = fromClient
+}
+
+// closeMessageTooBig closes both sides with status 1009, after a message from one of them exceeded wsMaxMessageSize.
+func (ws *WebSocket) closeMessageTooBig() error {
+	payload := binary.BigEndian.AppendUint16(nil, wsCloseMessageTooBig)
+	payload = append(payload, "message too big"...)
+	ws.setClose(payload, false)
+	ws.toClient.writeFrame(true, wsOpClose, payload)
+	ws.toServer.writeFrame(true, wsOpClose, payload)
+	return errWebSocketClosed
+}
+
+func (ws *WebSocket) MarshalJSON() ([]byte, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	m := struct {
+		Messages       []*WebSocketMessage `json:"messages"`
+		CloseCode      int                 `json:"closeCode"`
+		CloseReason    string              `json:"closeReason"`
+		ClosedByClient bool                `json:"closedByClient"`
+	}{
+		Messages:       ws.messages,
+		CloseCode:      ws.closeCode,
+		CloseReason:    ws.closeReason,
+		ClosedByClient: ws.closedByClient,
+	}
+	return json.Marshal(m)
+}
+
+func isWebSocketRequest(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Upgrade"), "websocket") && headerContainsToken(req.Header, "Connection", "upgrade")
+}
+
+func headerContainsToken(header http.Header, key, token string) bool {
+	for _, v := range header.Values(key) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bufferedConn reads from r, which buffers the data of Conn.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(data []byte) (int, error) {
+	return c.r.Read(data)
+}
+
+// dialWebSocket connects to the server of the websocket request, with tls if the scheme is https.
+func (proxy *Proxy) dialWebSocket(f *Flow) (net.Conn, error) {
+	useTLS := f.Request.URL.Scheme == "https" || f.Request.URL.Scheme == "wss"
+	d := proxy.serverDial(f.ConnContext, f, hostPort(f.Request.URL.Host, useTLS))
+
+	// the ACL checked the host of the CONNECT, the Host of a websocket inside the tunnel may be another one
+	if acl := proxy.Opts.ACL; acl != nil && f.ConnContext.pipeConn != nil && d.Host != f.ConnContext.pipeConn.host {
+		if reason := acl.checkDestination(d.Host, nil); reason != "" {
+			return nil, &deniedError{reason: reason}
+		}
+	}
+
+	timeouts := proxy.Opts.Timeouts
+	conn, err := proxy.dialDestination(context.Background(), "tcp", d.Host, d.Addr, f.ConnContext)
+	if err != nil {
+		return nil, err
+	}
+	if !useTLS {
+		return conn, nil
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		InsecureSkipVerify: proxy.Opts.InsecureSkipVerifyTLS,
+		KeyLogWriter:       getTLSKeyLogWriter(),
+		ServerName:         f.Request.URL.Hostname(),
+		NextProtos:         []string{"http/1.1"},
+	})
+	ctx, cancel := withTimeout(context.Background(), timeouts.TLSHandshake)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
 }
 
-func (s *webSocket) wss(res http.ResponseWriter, req *http.Request) {
-	logger := sLogger.With(
-		"in", "webSocket.wss",
-		"host", req.Host,
-	)
+// handleWebSocket forwards the upgrade request of f to the server, then relays the websocket messages
+// through the WebsocketStart, WebsocketMessage and WebsocketEnd addon events.
+func (proxy *Proxy) handleWebSocket(res http.ResponseWriter, f *Flow, logger *slog.Logger) {
+	logger = logger.With("in", "Proxy.handleWebSocket")
 
-	upgradeBuf, err := httputil.DumpRequest(req, false)
+	serverConn, err := proxy.dialWebSocket(f)
 	if err != nil {
-		logger.Error("DumpRequest", "error", err)
+		f.setError(err)
+		if proxy.replyDenied(res, f.ConnContext, f.Request.Method, hostPort(f.Request.URL.Host, f.Request.URL.Scheme == "https" || f.Request.URL.Scheme == "wss"), err) {
+			return
+		}
+		logErr(logger, "websocket dial", err)
+		res.WriteHeader(502)
+		return
+	}
+	defer serverConn.Close()
+
+	// Per-message compression is not supported, ask the server for uncompressed messages.
+	f.Request.Header.Del("Sec-WebSocket-Extensions")
+
+	upgradeBuf := new(strings.Builder)
+	fmt.Fprintf(upgradeBuf, "%s %s HTTP/1.1\r\n", f.Request.Method, f.Request.URL.RequestURI())
+	fmt.Fprintf(upgradeBuf, "Host: %s\r\n", f.Request.URL.Host)
+	if err := f.Request.Header.WriteSubset(upgradeBuf, map[string]bool{"Host": true}); err != nil {
+		logger.Error("could not write upgrade request", "error", err)
+		res.WriteHeader(502)
+		return
+	}
+	upgradeBuf.WriteString("\r\n")
+	if _, err := io.WriteString(serverConn, upgradeBuf.String()); err != nil {
+		logErr(logger, "websocket upgrade", err)
 		res.WriteHeader(502)
 		return
 	}
 
-	cConn, _, err := res.(http.Hijacker).Hijack()
+	serverReader := bufio.NewReader(serverConn)
+	upgradeRes, err := http.ReadResponse(serverReader, f.Request.Raw())
 	if err != nil {
-		logger.Error("Hijack", "error", err)
+		f.setError(err)
+		logErr(logger, "websocket upgrade response", err)
 		res.WriteHeader(502)
 		return
 	}
-	defer cConn.Close()
+	defer upgradeRes.Body.Close()
 
-	host := req.Host
-	if !strings.Contains(host, ":") {
-		host = host + ":443"
+	f.Response = &Response{
+		StatusCode: upgradeRes.StatusCode,
+		Header:     upgradeRes.Header,
 	}
-	conn, err := tls.Dial("tcp", host, nil)
-	if err != nil {
-		logger.Error("tls.Dial", "error", err)
+	for _, addon := range proxy.Addons {
+		addon.Responseheaders(f)
+		if f.Killed() {
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	// server refused the upgrade, reply as normal http response
+	if upgradeRes.StatusCode != http.StatusSwitchingProtocols {
+		for key, value := range f.Response.Header {
+			for _, v := range value {
+				res.Header().Add(key, v)
+			}
+		}
+		res.WriteHeader(f.Response.StatusCode)
+		if _, err := io.Copy(res, upgradeRes.Body); err != nil {
+			logErr(logger, "body copy", err)
+		}
 		return
 	}
-	defer conn.Close()
 
-	_, err = conn.Write(upgradeBuf)
+	cconn, bufrw, err := res.(http.Hijacker).Hijack()
 	if err != nil {
-		logger.Error("wss upgrade", "error", err)
+		logger.Error("could not hijack", "error", err)
+		res.WriteHeader(502)
+		return
+	}
+	defer cconn.Close()
+
+	upgradeResBuf := new(strings.Builder)
+	fmt.Fprintf(upgradeResBuf, "HTTP/1.1 %s\r\n", upgradeRes.Status)
+	if err := f.Response.Header.Write(upgradeResBuf); err != nil {
+		logger.Error("could not write upgrade response", "error", err)
+		return
+	}
+	upgradeResBuf.WriteString("\r\n")
+	if _, err := io.WriteString(cconn, upgradeResBuf.String()); err != nil {
+		logErr(logger, "websocket upgrade response", err)
 		return
 	}
-	transfer(logger, conn, cConn)
+
+	clientReader := bufrw.Reader
+	if f.Response.Header.Get("Sec-WebSocket-Extensions") != "" {
+		logger.Warn("websocket extensions not supported, forwarding without interception")
+		transfer(logger, &bufferedConn{Conn: serverConn, r: serverReader}, &bufferedConn{Conn: cconn, r: clientReader}, &f.throttle)
+		return
+	}
+
+	ws := &WebSocket{
+		messages: make([]*WebSocketMessage, 0),
+		f:        f,
+		toClient: &wsFrameWriter{w: cconn},
+		toServer: &wsFrameWriter{w: serverConn, mask: true},
+	}
+	f.WebSocket = ws
+
+	for _, addon := range proxy.Addons {
+		addon.WebsocketStart(f)
+	}
+
+	// the flow limiters added by addons, e.g. on WebsocketStart
+	fromClient := bufio.NewReader(&throttledReader{r: clientReader, limiters: f.throttle.upload})
+	fromServer := bufio.NewReader(&throttledReader{r: serverReader, limiters: f.throttle.download})
+
+	done := make(chan error, 2)
+	go func() {
+		done <- proxy.relayWebSocket(ws, fromClient, ws.toServer, true)
+	}()
+	go func() {
+		done <- proxy.relayWebSocket(ws, fromServer, ws.toClient, false)
+	}()
+
+	err = <-done
+	if err == errWebSocketClosed {
+		// wait for the other side to reply the close frame
+		select {
+		case err = <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}
+	cconn.Close()
+	serverConn.Close()
+	if err != nil && err != errWebSocketClosed && err != io.EOF {
+		logErr(logger, "websocket relay", err)
+	}
+
+	for _, addon := range proxy.Addons {
+		addon.WebsocketEnd(f)
+	}
+}
+
+// relayWebSocket reads frames from src and writes them to dst, until a close frame or error.
+func (proxy *Proxy) relayWebSocket(ws *WebSocket, src *bufio.Reader, dst *wsFrameWriter, fromClient bool) error {
+	var msgType byte
+	var content []byte
+
+	for {
+		frame, err := readWsFrame(src)
+		if err == errWsFrameTooLarge {
+			return ws.closeMessageTooBig()
+		}
+		if err != nil {
+			return err
+		}
+
+		if frame.isControl() {
+			if err := dst.writeFrame(true, frame.opcode, frame.payload); err != nil {
+				return err
+			}
+			if frame.opcode == wsOpClose {
+				ws.setClose(frame.payload, fromClient)
+				return errWebSocketClosed
+			}
+			continue
+		}
+
+		if frame.opcode != wsOpContinuation {
+			msgType = frame.opcode
+			content = nil
+		}
+		if len(content)+len(frame.payload) > wsMaxMessageSize {
+			return ws.closeMessageTooBig()
+		}
+		if content == nil {
+			content = frame.payload
+		} else {
+			content = append(content, frame.payload...)
+		}
+		if !frame.fin {
+			continue
+		}
+
+		msg := &WebSocketMessage{
+			Type:       int(msgType),
+			Content:    content,
+			FromClient: fromClient,
+			Timestamp:  time.Now(),
+		}
+		content = nil
+		ws.addMessage(msg)
+
+		for _, addon := range proxy.Addons {
+			addon.WebsocketMessage(ws.f, msg)
+		}
+		if ws.f.Killed() {
+			return errWebSocketClosed
+		}
+		if msg.Dropped {
+			continue
+		}
+		if err := dst.writeFrame(true, byte(msg.Type), msg.Content); err != nil {
+			return err
+		}
+	}
 }
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestWebSocketMessageTooBig(t *testing.T) {
+	defer func(size int) { wsMaxMessageSize = size }(wsMaxMessageSize)
+	wsMaxMessageSize = 8
+
+	src := new(bytes.Buffer)
+	w := &wsFrameWriter{w: src, mask: true}
+	handleError(t, w.writeFrame(false, wsOpText, []byte("hello")))
+	handleError(t, w.writeFrame(true, wsOpContinuation, []byte(" world")))
+
+	toClient, toServer := new(bytes.Buffer), new(bytes.Buffer)
+	ws := &WebSocket{
+		f:        newFlow(),
+		toClient: &wsFrameWriter{w: toClient},
+		toServer: &wsFrameWriter{w: toServer, mask: true},
+	}
+	proxy := &Proxy{}
+	if err := proxy.relayWebSocket(ws, bufio.NewReader(src), ws.toServer, true); err != errWebSocketClosed {
+		t.Fatalf("expected websocket closed, but got %v", err)
+	}
+	if code, _, _ := ws.CloseStatus(); code != wsCloseMessageTooBig {
+		t.Fatalf("expected close code %d, but got %d", wsCloseMessageTooBig, code)
+	}
+	if len(ws.Messages()) != 0 {
+		t.Fatal("message should not be relayed")
+	}
+
+	for name, buf := range map[string]*bytes.Buffer{"client": toClient, "server": toServer} {
+		frame, err := readWsFrame(bufio.NewReader(buf))
+		handleError(t, err)
+		if frame.opcode != wsOpClose || binary.BigEndian.Uint16(frame.payload) != wsCloseMessageTooBig {
+			t.Fatalf("expected close frame 1009 to %s, but got opcode %d", name, frame.opcode)
+		}
+	}
+}
+
+func TestReadWsFrameLength(t *testing.T) {
+	defer func(size int) { wsMaxMessageSize = size }(wsMaxMessageSize)
+	wsMaxMessageSize = 1024
+
+	// a frame larger than a message is refused before reading its payload
+	head := []byte{0x82, 127, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(head[2:], 1<<40)
+	if _, err := readWsFrame(bufio.NewReader(bytes.NewReader(head))); err != errWsFrameTooLarge {
+		t.Fatalf("expected %v, but got %v", errWsFrameTooLarge, err)
+	}
+
+	// a payload shorter than its length
+	head = []byte{0x82, 126, 0, 0}
+	binary.BigEndian.PutUint16(head[2:], 1000)
+	if _, err := readWsFrame(bufio.NewReader(bytes.NewReader(append(head, "hello"...)))); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected %v, but got %v", io.ErrUnexpectedEOF, err)
+	}
+
+	binary.BigEndian.PutUint16(head[2:], 5)
+	frame, err := readWsFrame(bufio.NewReader(bytes.NewReader(append(head, "hello"...))))
+	handleError(t, err)
+	if !frame.fin || frame.opcode != wsOpBinary || string(frame.payload) != "hello" {
+		t.Fatalf("unexpected frame %+v", frame)
+	}
+}
+
+func TestWebSocketMessagesCapped(t *testing.T) {
+	ws := &WebSocket{}
+	for i := 0; i < maxWebSocketMessages+10; i++ {
+		ws.addMessage(&WebSocketMessage{Content: binary.BigEndian.AppendUint32(nil, uint32(i))})
+	}
+	messages := ws.Messages()
+	if len(messages) != maxWebSocketMessages {
+		t.Fatalf("expected %d messages, but got %d", maxWebSocketMessages, len(messages))
+	}
+	if first := binary.BigEndian.Uint32(messages[0].Content); first != 10 {
+		t.Fatalf("expected the oldest messages dropped, but the first is %d", first)
+	}
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.2
+
+const (
+	wsOpContinuation byte = 0
+	wsOpText         byte = 1
+	wsOpBinary       byte = 2
+	wsOpClose        byte = 8
+	wsOpPing         byte = 9
+	wsOpPong         byte = 10
+)
+
+// wsMaxMessageSize caps the size of a message reassembled from its fragments and of each frame,
+// a variable for tests.
+var wsMaxMessageSize = 64 * 1024 * 1024
+
+// wsCloseMessageTooBig is the close status code when a message is too large.
+const wsCloseMessageTooBig = 1009
+
+var errWsFrameTooLarge = errors.New("websocket frame too large")
+
+type wsFrame struct {
+	fin     bool
+	rsv     byte
+	opcode  byte
+	payload []byte
+}
+
+func (f *wsFrame) isControl() bool {
+	return f.opcode >= wsOpClose
+}
+
+func readWsFrame(r *bufio.Reader) (*wsFrame, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+
+	frame := &wsFrame{
+		fin:    head[0]&0x80 != 0,
+		rsv:    (head[0] >> 4) & 0x07,
+		opcode: head[0] & 0x0f,
+	}
+	masked := head[1]&0x80 != 0
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	// a frame can not be larger than the message it is a fragment of,
+	// control frames have at most 125 bytes of payload
+	maxLength := uint64(wsMaxMessageSize)
+	if frame.isControl() {
+		maxLength = 125
+	}
+	if length > maxLength {
+		return nil, errWsFrameTooLarge
+	}
+
+	var maskKey [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, maskKey[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	// the payload grows as it is received, not to the length claimed by the peer up front
+	payload := bytes.NewBuffer(make([]byte, 0, min(length, 4096)))
+	if _, err := io.CopyN(payload, r, int64(length)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	frame.payload = payload.Bytes()
+	if masked {
+		maskBytes(maskKey, frame.payload)
+	}
+
+	return frame, nil
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
+
+// wsFrameWriter writes whole frames, it is safe for concurrent use.
+type wsFrameWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	mask bool // frames sent from client to server must be masked
+}
+
+func (w *wsFrameWriter) writeFrame(fin bool, opcode byte, payload []byte) error {
+	buf := make([]byte, 0, 14+len(payload))
+
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	buf = append(buf, b0)
+
+	var b1 byte
+	if w.mask {
+		b1 = 0x80
+	}
+	length := len(payload)
+	switch {
+	case length <= 125:
+		buf = append(buf, b1|byte(length))
+	case length <= 0xffff:
+		buf = append(buf, b1|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(length))
+	default:
+		buf = append(buf, b1|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(length))
+	}
+
+	if w.mask {
+		var maskKey [4]byte
+		if _, err := rand.Read(maskKey[:]); err != nil {
+			return err
+		}
+		buf = append(buf, maskKey[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(maskKey, buf[start:])
+	} else {
+		buf = append(buf, payload...)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.w.Write(buf)
+	return err
+}
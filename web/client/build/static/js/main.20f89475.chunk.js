@@ -0,0 +1,1674 @@
+(this["webpackJsonpmitmproxy-client"]=this["webpackJsonpmitmproxy-client"]||[]).push([[0],{
+"app/App": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+var __m0 = __webpack_require__(1);
+var React = __m0;
+var __m1 = __webpack_require__(52);
+var Table = __m1.a;
+var __m2 = __webpack_require__(10);
+var Form = __m2.a;
+var __m3 = __webpack_require__(13);
+var Button = __m3.a;
+var __m4 = __webpack_require__("app/components/BreakPoint");
+var BreakPoint = __m4.default;
+var __m5 = __webpack_require__("app/components/Conditions");
+var Conditions = __m5.default;
+var __m6 = __webpack_require__("app/components/FlowPreview");
+var FlowPreview = __m6.default;
+var __m7 = __webpack_require__("app/components/ViewFlow");
+var ViewFlow = __m7.default;
+var __m8 = __webpack_require__("app/lib/flow");
+var { Flow, FlowManager } = __m8;
+var __m9 = __webpack_require__("app/lib/message");
+var { parseMessage, SendMessageType, buildMessageMeta, MessageType } = __m9;
+var __m10 = __webpack_require__("app/lib/utils");
+var { isInViewPort } = __m10;
+var __m11 = __webpack_require__("app/lib/connection");
+var { ConnectionManager } = __m11;
+
+
+
+
+
+
+
+
+
+
+
+
+
+const wsReconnIntervals = [
+    1,
+    1,
+    2,
+    2,
+    4,
+    4,
+    8,
+    8,
+    16,
+    16,
+    32,
+    32
+];
+class App extends React.Component {
+    connMgr;
+    flowMgr;
+    ws;
+    wsUnmountClose;
+    tableBottomRef;
+    wsReconnCount = -1;
+    constructor(props){
+        super(props);
+        this.connMgr = new ConnectionManager();
+        this.flowMgr = new FlowManager();
+        this.state = {
+            flows: this.flowMgr.showList(),
+            flow: null,
+            wsStatus: 'close'
+        };
+        this.ws = null;
+        this.wsUnmountClose = false;
+        this.tableBottomRef = React.createRef();
+    }
+    componentDidMount() {
+        this.initWs();
+    }
+    componentWillUnmount() {
+        if (this.ws) {
+            this.wsUnmountClose = true;
+            this.ws.close();
+            this.ws = null;
+        }
+    }
+    initWs() {
+        if (this.ws) return;
+        this.setState({
+            wsStatus: 'connecting'
+        });
+        let host;
+        if ("production" === 'development') {
+            host = 'localhost:9081';
+        } else {
+            host = new URL(document.URL).host;
+        }
+        this.ws = new WebSocket(`ws://${host}/echo`);
+        this.ws.binaryType = 'arraybuffer';
+        this.ws.onopen = ()=>{
+            this.wsReconnCount = -1;
+            this.setState({
+                wsStatus: 'open'
+            });
+        };
+        this.ws.onerror = (evt)=>{
+            console.error('ERROR:', evt);
+            this.ws?.close();
+        };
+        this.ws.onclose = ()=>{
+            this.setState({
+                wsStatus: 'close'
+            });
+            if (this.wsUnmountClose) return;
+            this.wsReconnCount++;
+            this.ws = null;
+            const waitSeconds = wsReconnIntervals[this.wsReconnCount] || wsReconnIntervals[wsReconnIntervals.length - 1];
+            console.info(`will reconnect after ${waitSeconds} seconds`);
+            setTimeout(()=>{
+                this.initWs();
+            }, waitSeconds * 1000);
+        };
+        this.ws.onmessage = (evt)=>{
+            const msg = parseMessage(evt.data);
+            if (!msg) {
+                console.error('parse error:', evt.data);
+                return;
+            }
+            if (msg.type === MessageType.CONN) {
+                this.connMgr.add(msg.id, msg.content);
+                this.setState({
+                    flows: this.state.flows
+                });
+            } else if (msg.type === MessageType.CONN_CLOSE) {
+                this.connMgr.delete(msg.id);
+            } else if (msg.type === MessageType.REQUEST) {
+                const flow = new Flow(msg, this.connMgr);
+                flow.getConn();
+                this.flowMgr.add(flow);
+                let shouldScroll = false;
+                if (this.tableBottomRef?.current && isInViewPort(this.tableBottomRef.current)) {
+                    shouldScroll = true;
+                }
+                this.setState({
+                    flows: this.flowMgr.showList()
+                }, ()=>{
+                    if (shouldScroll) {
+                        this.tableBottomRef?.current?.scrollIntoView({
+                            behavior: 'auto'
+                        });
+                    }
+                });
+            } else if (msg.type === MessageType.REQUEST_BODY) {
+                const flow = this.flowMgr.get(msg.id);
+                if (!flow) return;
+                flow.addRequestBody(msg);
+                this.setState({
+                    flows: this.state.flows
+                });
+            } else if (msg.type === MessageType.RESPONSE) {
+                const flow = this.flowMgr.get(msg.id);
+                if (!flow) return;
+                flow.getConn();
+                flow.addResponse(msg);
+                this.setState({
+                    flows: this.state.flows
+                });
+            } else if (msg.type === MessageType.RESPONSE_BODY) {
+                const flow = this.flowMgr.get(msg.id);
+                if (!flow || !flow.response) return;
+                flow.addResponseBody(msg);
+                this.setState({
+                    flows: this.state.flows
+                });
+            } else if (msg.type === MessageType.FLOW_META) {
+                const flow = this.flowMgr.get(msg.id);
+                if (!flow) return;
+                flow.addFlowMeta(msg);
+                this.setState({
+                    flows: this.flowMgr.showList()
+                });
+            } else if (msg.type === MessageType.WEBSOCKET) {
+                const flow = this.flowMgr.get(msg.id);
+                if (!flow) return;
+                flow.addWebSocket(msg);
+                this.setState({
+                    flows: this.state.flows
+                });
+            } else if (msg.type === MessageType.WEBSOCKET_MESSAGE) {
+                const flow = this.flowMgr.get(msg.id);
+                if (!flow) return;
+                flow.addWebSocketMessage(msg);
+                this.setState({
+                    flows: this.state.flows
+                });
+            } else if (msg.type === MessageType.SERVER_SENT_EVENT) {
+                const flow = this.flowMgr.get(msg.id);
+                if (!flow) return;
+                flow.addServerSentEvent(msg);
+                this.setState({
+                    flows: this.state.flows
+                });
+            }
+        };
+    }
+    render() {
+        const { flows } = this.state;
+        return __React.createElement("div", {className: "main-table-wrap"}, __React.createElement("div", {className: "top-control"}, __React.createElement("div", null, __React.createElement(Button, {size: "sm", onClick: ()=>{
+            this.flowMgr.clear();
+            this.setState({
+                flows: this.flowMgr.showList(),
+                flow: null
+            });
+        }}, "Clear")), __React.createElement("div", null, __React.createElement(Form.Control, {size: "sm", placeholder: "Filter: text, /regexp/, ~marked, ~comment text, ~meta key=value", onChange: (e)=>{
+            const value = e.target.value;
+            this.flowMgr.changeFilterLazy(value, ()=>{
+                this.setState({
+                    flows: this.flowMgr.showList()
+                });
+            });
+        }})), __React.createElement(BreakPoint, {onSave: (rules)=>{
+            const msg = buildMessageMeta(SendMessageType.CHANGE_BREAK_POINT_RULES, rules);
+            if (this.ws) this.ws.send(msg);
+        }}), __React.createElement(Conditions, null), __React.createElement("span", null, "status: ", this.state.wsStatus)), __React.createElement("div", {className: "table-wrap-div"}, __React.createElement(Table, {striped: true, bordered: true, size: "sm", style: {
+            tableLayout: 'fixed'
+        }}, __React.createElement("thead", null, __React.createElement("tr", null, __React.createElement("th", {style: {
+            width: '50px'
+        }}, "No"), __React.createElement("th", {style: {
+            width: '80px'
+        }}, "Method"), __React.createElement("th", {style: {
+            width: '200px'
+        }}, "Host"), __React.createElement("th", {style: {
+            width: 'auto'
+        }}, "Path"), __React.createElement("th", {style: {
+            width: '150px'
+        }}, "Type"), __React.createElement("th", {style: {
+            width: '80px'
+        }}, "Status"), __React.createElement("th", {style: {
+            width: '90px'
+        }}, "Size"), __React.createElement("th", {style: {
+            width: '90px'
+        }}, "Time"))), __React.createElement("tbody", null, flows.map((f)=>{
+            const fp = f.preview();
+            return __React.createElement(FlowPreview, {key: fp.id, flow: fp, isSelected: this.state.flow && this.state.flow.id === fp.id ? true : false, onShowDetail: ()=>{
+                this.setState({
+                    flow: f
+                });
+            }});
+        }))), __React.createElement("div", {ref: this.tableBottomRef, id: "hidden-bottom", style: {
+            height: '0px',
+            visibility: 'hidden',
+            marginBottom: '1px'
+        }})), __React.createElement(ViewFlow, {flow: this.state.flow, onClose: ()=>{
+            this.setState({
+                flow: null
+            });
+        }, onReRenderFlows: ()=>{
+            this.setState({
+                flows: this.state.flows
+            });
+        }, onMessage: (msg)=>{
+            if (this.ws) this.ws.send(msg);
+        }}));
+    }
+}
+exports.default = App;
+
+},
+"app/components/BreakPoint": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+var __m0 = __webpack_require__(1);
+var React = __m0;
+var __m1 = __webpack_require__(13);
+var Button = __m1.a;
+var __m2 = __webpack_require__(16);
+var Modal = __m2.a;
+var __m3 = __webpack_require__(10);
+var Form = __m3.a;
+var __m4 = __webpack_require__(43);
+var Row = __m4.a;
+var __m5 = __webpack_require__(30);
+var Col = __m5.a;
+
+
+
+
+
+
+class BreakPoint extends React.Component {
+    constructor(props){
+        super(props);
+        this.state = {
+            show: false,
+            rule: {
+                method: 'ALL',
+                url: '',
+                action: 1
+            },
+            haveRules: false
+        };
+        this.handleClose = this.handleClose.bind(this);
+        this.handleShow = this.handleShow.bind(this);
+        this.handleSave = this.handleSave.bind(this);
+    }
+    handleClose() {
+        this.setState({
+            show: false
+        });
+    }
+    handleShow() {
+        this.setState({
+            show: true
+        });
+    }
+    handleSave() {
+        const { rule } = this.state;
+        const rules = [];
+        if (rule.url) {
+            rules.push({
+                method: rule.method === 'ALL' ? '' : rule.method,
+                url: rule.url,
+                action: rule.action
+            });
+        }
+        this.props.onSave(rules);
+        this.handleClose();
+        this.setState({
+            haveRules: rules.length ? true : false
+        });
+    }
+    render() {
+        const { rule, haveRules } = this.state;
+        const variant = haveRules ? 'success' : 'primary';
+        return __React.createElement("div", null, __React.createElement(Button, {variant: variant, size: "sm", onClick: this.handleShow}, "BreakPoint"), __React.createElement(Modal, {show: this.state.show, onHide: this.handleClose}, __React.createElement(Modal.Header, {closeButton: true}, __React.createElement(Modal.Title, null, "Set BreakPoint")), __React.createElement(Modal.Body, null, __React.createElement(Form.Group, {as: Row}, __React.createElement(Form.Label, {column: true, sm: 2}, "Method"), __React.createElement(Col, {sm: 10}, __React.createElement(Form.Control, {as: "select", value: rule.method, onChange: (e)=>{
+            this.setState({
+                rule: {
+                    ...rule,
+                    method: e.target.value
+                }
+            });
+        }}, __React.createElement("option", null, "ALL"), __React.createElement("option", null, "GET"), __React.createElement("option", null, "POST"), __React.createElement("option", null, "PUT"), __React.createElement("option", null, "DELETE")))), __React.createElement(Form.Group, {as: Row}, __React.createElement(Form.Label, {column: true, sm: 2}, "URL"), __React.createElement(Col, {sm: 10}, __React.createElement(Form.Control, {value: rule.url, onChange: (e)=>{
+            this.setState({
+                rule: {
+                    ...rule,
+                    url: e.target.value
+                }
+            });
+        }}))), __React.createElement(Form.Group, {as: Row}, __React.createElement(Form.Label, {column: true, sm: 2}, "Action"), __React.createElement(Col, {sm: 10}, __React.createElement(Form.Control, {as: "select", value: rule.action, onChange: (e)=>{
+            this.setState({
+                rule: {
+                    ...rule,
+                    action: parseInt(e.target.value)
+                }
+            });
+        }}, __React.createElement("option", {value: "1"}, "Request"), __React.createElement("option", {value: "2"}, "Response"), __React.createElement("option", {value: "3"}, "Both"))))), __React.createElement(Modal.Footer, null, __React.createElement(Button, {variant: "secondary", onClick: this.handleClose}, "Close"), __React.createElement(Button, {variant: "primary", onClick: this.handleSave}, "Save"))));
+    }
+}
+exports.default = BreakPoint;
+
+},
+"app/components/Conditions": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+var __m0 = __webpack_require__(1);
+var React = __m0;
+var __m1 = __webpack_require__(13);
+var Button = __m1.a;
+var __m2 = __webpack_require__(16);
+var Modal = __m2.a;
+var __m3 = __webpack_require__(10);
+var Form = __m3.a;
+var __m4 = __webpack_require__("app/lib/utils");
+var { apiHost } = __m4;
+
+
+
+
+
+class Conditions extends React.Component {
+    constructor(props){
+        super(props);
+        this.state = {
+            show: false,
+            text: '',
+            error: null,
+            haveRules: false
+        };
+        this.handleClose = this.handleClose.bind(this);
+        this.handleShow = this.handleShow.bind(this);
+        this.handleSave = this.handleSave.bind(this);
+        this.handleReload = this.handleReload.bind(this);
+    }
+    handleClose() {
+        this.setState({
+            show: false
+        });
+    }
+    handleShow() {
+        this.setState({
+            show: true,
+            error: null
+        });
+        this.request('GET');
+    }
+    handleSave() {
+        let rules;
+        try {
+            rules = JSON.parse(this.state.text || '[]');
+        } catch (err) {
+            this.setState({
+                error: err.message
+            });
+            return;
+        }
+        this.request('PUT', JSON.stringify(rules));
+    }
+    handleReload() {
+        this.request('POST');
+    }
+    async request(method, body) {
+        try {
+            const res = await fetch(`${apiHost()}/api/conditions`, {
+                method,
+                body
+            });
+            if (res.status === 404) {
+                this.setState({
+                    text: '',
+                    error: 'network conditions are not enabled, start with -conditions <file>'
+                });
+                return;
+            }
+            if (!res.ok) {
+                this.setState({
+                    error: await res.text()
+                });
+                return;
+            }
+            const rules = await res.json();
+            this.setState({
+                text: JSON.stringify(rules, null, 2),
+                error: null,
+                haveRules: Array.isArray(rules) && rules.length > 0
+            });
+        } catch (err) {
+            this.setState({
+                error: err.message
+            });
+        }
+    }
+    render() {
+        const { text, error, haveRules } = this.state;
+        const variant = haveRules ? 'success' : 'primary';
+        return __React.createElement("div", null, __React.createElement(Button, {variant: variant, size: "sm", onClick: this.handleShow}, "Conditions"), __React.createElement(Modal, {show: this.state.show, onHide: this.handleClose, size: "lg"}, __React.createElement(Modal.Header, {closeButton: true}, __React.createElement(Modal.Title, null, "Network Conditions")), __React.createElement(Modal.Body, null, __React.createElement(Form.Control, {as: "textarea", rows: 16, style: {
+            fontFamily: 'Menlo,Monaco,monospace',
+            fontSize: '0.8rem'
+        }, value: text, onChange: (e)=>{
+            this.setState({
+                text: e.target.value
+            });
+        }}), error ? __React.createElement("div", {style: {
+            color: 'red',
+            marginTop: '10px'
+        }}, error) : null), __React.createElement(Modal.Footer, null, __React.createElement(Button, {variant: "secondary", onClick: this.handleClose}, "Close"), __React.createElement(Button, {variant: "secondary", onClick: this.handleReload}, "Reload File"), __React.createElement(Button, {variant: "primary", onClick: this.handleSave}, "Save"))));
+    }
+}
+exports.default = Conditions;
+
+},
+"app/components/ContentView": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+var __m0 = __webpack_require__(1);
+var React = __m0;
+var __m1 = __webpack_require__(10);
+var Form = __m1.a;
+var __m2 = __webpack_require__("app/lib/utils");
+var { apiHost, arrayBufferToBase64 } = __m2;
+
+
+
+class ContentView extends React.Component {
+    fetchNo = 0;
+    constructor(props){
+        super(props);
+        this.state = {
+            view: '',
+            views: [],
+            currentView: '',
+            text: null,
+            error: null
+        };
+    }
+    componentDidMount() {
+        this.fetch();
+    }
+    componentDidUpdate(prevProps, prevState) {
+        if (prevProps.flow.id !== this.props.flow.id || prevProps.part !== this.props.part) {
+            this.setState({
+                view: ''
+            }, ()=>this.fetch());
+            return;
+        }
+        if (prevProps.version !== this.props.version || prevState.view !== this.state.view) {
+            this.fetch();
+        }
+    }
+    async fetch() {
+        const no = ++this.fetchNo;
+        const { flow, part } = this.props;
+        const { method, url, header } = flow.request;
+        const body = part === 'response' ? flow.response?.body : flow.request.body;
+        const req = {
+            id: flow.id,
+            part,
+            view: this.state.view,
+            request: {
+                method,
+                url,
+                header
+            },
+            responseHeader: flow.response?.header,
+            body: body ? arrayBufferToBase64(body) : ''
+        };
+        try {
+            const res = await fetch(`${apiHost()}/api/contentview`, {
+                method: 'POST',
+                body: JSON.stringify(req)
+            });
+            if (no !== this.fetchNo) return;
+            if (!res.ok) {
+                this.setState({
+                    text: null,
+                    error: await res.text()
+                });
+                return;
+            }
+            const result = await res.json();
+            if (no !== this.fetchNo) return;
+            this.setState({
+                views: result.views,
+                currentView: result.view,
+                text: result.text,
+                error: null
+            });
+        } catch (err) {
+            if (no !== this.fetchNo) return;
+            this.setState({
+                text: null,
+                error: String(err)
+            });
+        }
+    }
+    render() {
+        const { views, currentView, text, error } = this.state;
+        return __React.createElement("div", null, __React.createElement("div", {style: {
+            marginBottom: '10px'
+        }}, __React.createElement(Form.Select, {size: "sm", style: {
+            width: '200px'
+        }, value: this.state.view, onChange: (e)=>{
+            this.setState({
+                view: e.target.value
+            });
+        }}, __React.createElement("option", {value: ""}, "auto", currentView && !this.state.view ? ` (${currentView})` : ''), views.map((v)=>__React.createElement("option", {key: v, value: v}, v)))), error ? __React.createElement("div", {style: {
+            color: 'gray'
+        }}, error) : __React.createElement("pre", {style: {
+            whiteSpace: 'pre-wrap',
+            wordBreak: 'break-all'
+        }}, text));
+    }
+}
+exports.default = ContentView;
+
+},
+"app/components/EditFlow": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+var __m0 = __webpack_require__(1);
+var React = __m0;
+var __m1 = __webpack_require__(13);
+var Button = __m1.a;
+var __m2 = __webpack_require__(16);
+var Modal = __m2.a;
+var __m3 = __webpack_require__(10);
+var Form = __m3.a;
+var __m4 = __webpack_require__(53);
+var Alert = __m4.a;
+var __m5 = __webpack_require__("app/lib/message");
+var { SendMessageType, buildMessageEdit } = __m5;
+var __m6 = __webpack_require__("app/lib/utils");
+var { isTextBody } = __m6;
+
+
+
+
+
+
+
+const stringifyRequest = (request)=>{
+    const firstLine = `${request.method} ${request.url}`;
+    const headerLines = Object.keys(request.header).map((key)=>{
+        const valstr = request.header[key].join(' \t ');
+        return `${key}: ${valstr}`;
+    }).join('\n');
+    let bodyLines = '';
+    if (request.body && isTextBody(request)) bodyLines = new TextDecoder().decode(request.body);
+    return `${firstLine}\n\n${headerLines}\n\n${bodyLines}`;
+};
+const parseRequest = (content)=>{
+    const firstIndex = content.indexOf('\n\n');
+    if (firstIndex <= 0) return;
+    const firstLine = content.slice(0, firstIndex);
+    const [method, url] = firstLine.split(' ');
+    if (!method || !url) return;
+    const secondIndex = content.indexOf('\n\n', firstIndex + 2);
+    if (secondIndex <= 0) return;
+    const headerLines = content.slice(firstIndex + 2, secondIndex);
+    const header = {};
+    for (const line of headerLines.split('\n')){
+        const [key, vals] = line.split(': ');
+        if (!key || !vals) return;
+        header[key] = vals.split(' \t ');
+    }
+    const bodyLines = content.slice(secondIndex + 2);
+    let body;
+    if (bodyLines) body = new TextEncoder().encode(bodyLines);
+    return {
+        method,
+        url,
+        proto: '',
+        header,
+        body
+    };
+};
+const stringifyResponse = (response)=>{
+    const firstLine = `${response.statusCode}`;
+    const headerLines = Object.keys(response.header).map((key)=>{
+        const valstr = response.header[key].join(' \t ');
+        return `${key}: ${valstr}`;
+    }).join('\n');
+    let bodyLines = '';
+    if (response.body && isTextBody(response)) bodyLines = new TextDecoder().decode(response.body);
+    return `${firstLine}\n\n${headerLines}\n\n${bodyLines}`;
+};
+const parseResponse = (content)=>{
+    const firstIndex = content.indexOf('\n\n');
+    if (firstIndex <= 0) return;
+    const firstLine = content.slice(0, firstIndex);
+    const statusCode = parseInt(firstLine);
+    if (isNaN(statusCode)) return;
+    const secondIndex = content.indexOf('\n\n', firstIndex + 2);
+    if (secondIndex <= 0) return;
+    const headerLines = content.slice(firstIndex + 2, secondIndex);
+    const header = {};
+    for (const line of headerLines.split('\n')){
+        const [key, vals] = line.split(': ');
+        if (!key || !vals) return;
+        header[key] = vals.split(' \t ');
+    }
+    const bodyLines = content.slice(secondIndex + 2);
+    let body;
+    if (bodyLines) body = new TextEncoder().encode(bodyLines);
+    return {
+        statusCode,
+        header,
+        body
+    };
+};
+class EditFlow extends React.Component {
+    constructor(props){
+        super(props);
+        this.state = {
+            show: false,
+            alertMsg: '',
+            content: ''
+        };
+        this.handleClose = this.handleClose.bind(this);
+        this.handleShow = this.handleShow.bind(this);
+        this.handleSave = this.handleSave.bind(this);
+    }
+    showAlert(msg) {
+        this.setState({
+            alertMsg: msg
+        });
+    }
+    handleClose() {
+        this.setState({
+            show: false
+        });
+    }
+    handleShow() {
+        const { flow } = this.props;
+        const when = flow.response ? 'response' : 'request';
+        let content = '';
+        if (when === 'request') {
+            content = stringifyRequest(flow.request);
+        } else {
+            content = stringifyResponse(flow.response);
+        }
+        this.setState({
+            show: true,
+            alertMsg: '',
+            content
+        });
+    }
+    handleSave() {
+        const { flow } = this.props;
+        const when = flow.response ? 'response' : 'request';
+        const { content } = this.state;
+        if (when === 'request') {
+            const request = parseRequest(content);
+            if (!request) {
+                this.showAlert('parse error');
+                return;
+            }
+            this.props.onChangeRequest(request);
+            this.handleClose();
+        } else {
+            const response = parseResponse(content);
+            if (!response) {
+                this.showAlert('parse error');
+                return;
+            }
+            this.props.onChangeResponse(response);
+            this.handleClose();
+        }
+    }
+    render() {
+        const { flow } = this.props;
+        if (!flow.waitIntercept) return null;
+        const { alertMsg } = this.state;
+        const when = flow.response ? 'response' : 'request';
+        return __React.createElement("div", {className: "flow-wait-area"}, __React.createElement(Button, {size: "sm", onClick: this.handleShow}, "Edit"), __React.createElement(Button, {size: "sm", onClick: ()=>{
+            const msgType = when === 'response' ? SendMessageType.CHANGE_RESPONSE : SendMessageType.CHANGE_REQUEST;
+            const msg = buildMessageEdit(msgType, flow);
+            this.props.onMessage(msg);
+        }}, "Continue"), __React.createElement(Button, {size: "sm", onClick: ()=>{
+            const msgType = when === 'response' ? SendMessageType.DROP_RESPONSE : SendMessageType.DROP_REQUEST;
+            const msg = buildMessageEdit(msgType, flow);
+            this.props.onMessage(msg);
+        }}, "Drop"), __React.createElement(Modal, {size: "lg", show: this.state.show, onHide: this.handleClose}, __React.createElement(Modal.Header, {closeButton: true}, __React.createElement(Modal.Title, null, "Edit ", when === 'request' ? 'Request' : 'Response')), __React.createElement(Modal.Body, null, __React.createElement(Form.Group, null, __React.createElement(Form.Control, {as: "textarea", rows: 10, value: this.state.content, onChange: (e)=>{
+            this.setState({
+                content: e.target.value
+            });
+        }})), !alertMsg ? null : __React.createElement(Alert, {variant: "danger"}, alertMsg)), __React.createElement(Modal.Footer, null, __React.createElement(Button, {variant: "secondary", onClick: this.handleClose}, "Close"), __React.createElement(Button, {variant: "primary", onClick: this.handleSave}, "Save"))));
+    }
+}
+exports.default = EditFlow;
+
+},
+"app/components/FlowPreview": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+var __m0 = __webpack_require__(1);
+var React = __m0;
+var __m1 = __webpack_require__("app/lib/utils");
+var { shallowEqual } = __m1;
+
+
+class FlowPreview extends React.Component {
+    shouldComponentUpdate(nextProps) {
+        if (nextProps.isSelected === this.props.isSelected && shallowEqual(nextProps.flow, this.props.flow)) {
+            return false;
+        }
+        return true;
+    }
+    render() {
+        const fp = this.props.flow;
+        const classNames = [];
+        if (this.props.isSelected) classNames.push('tr-selected');
+        if (fp.waitIntercept) classNames.push('tr-wait-intercept');
+        if (fp.marked) classNames.push('tr-marked');
+        return __React.createElement("tr", {className: classNames.length ? classNames.join(' ') : undefined, onClick: ()=>{
+            this.props.onShowDetail();
+        }}, __React.createElement("td", null, fp.no), __React.createElement("td", null, fp.method), __React.createElement("td", null, fp.host), __React.createElement("td", null, fp.path), __React.createElement("td", null, fp.contentType), __React.createElement("td", null, fp.statusCode), __React.createElement("td", null, fp.size), __React.createElement("td", null, fp.costTime));
+    }
+}
+exports.default = FlowPreview;
+
+},
+"app/components/ViewFlow": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+var __m0 = __webpack_require__(1);
+var React = __m0;
+var __m1 = __webpack_require__(13);
+var Button = __m1.a;
+var __m2 = __webpack_require__(26);
+var FormCheck = __m2.a;
+var __m3 = __webpack_require__(10);
+var Form = __m3.a;
+var __m4 = __webpack_require__(49);
+var fetchToCurl = __m4.default;
+var __m5 = __webpack_require__(50);
+var copy = __m5;
+var __m6 = __webpack_require__("app/lib/utils");
+var { isTextBody } = __m6;
+var __m7 = __webpack_require__("app/lib/message");
+var { buildMessageFlowMeta } = __m7;
+var __m8 = __webpack_require__("app/components/EditFlow");
+var EditFlow = __m8.default;
+var __m9 = __webpack_require__("app/components/ContentView");
+var ContentView = __m9.default;
+
+
+
+
+
+
+
+
+
+
+class ViewFlow extends React.Component {
+    constructor(props){
+        super(props);
+        this.state = {
+            flowTab: 'Detail',
+            copied: false,
+            requestBodyViewTab: 'Raw',
+            responseBodyLineBreak: false
+        };
+    }
+    preview() {
+        const { flow } = this.props;
+        if (!flow) return null;
+        const response = flow.response;
+        if (!response) return null;
+        if (!(response.body && response.body.byteLength)) {
+            return __React.createElement("div", {style: {
+                color: 'gray'
+            }}, "No response");
+        }
+        const pv = flow.previewResponseBody();
+        return __React.createElement("div", null, pv && pv.type === 'image' ? __React.createElement("div", {style: {
+            marginBottom: '10px'
+        }}, __React.createElement("img", {src: `data:image/png;base64,${pv.data}`})) : null, __React.createElement(ContentView, {flow: flow, part: "response", version: response.body.byteLength}));
+    }
+    requestBodyPreview() {
+        const { flow } = this.props;
+        if (!flow) return null;
+        return __React.createElement(ContentView, {flow: flow, part: "request", version: flow.request.body?.byteLength || 0});
+    }
+    hexview() {
+        const { flow } = this.props;
+        if (!flow) return null;
+        const response = flow.response;
+        if (!response) return null;
+        if (!(response.body && response.body.byteLength)) {
+            return __React.createElement("div", {style: {
+                color: 'gray'
+            }}, "No response");
+        }
+        return __React.createElement("pre", null, flow.hexviewResponseBody());
+    }
+    messages() {
+        const { flow } = this.props;
+        if (!flow) return null;
+        if (flow.eventStream) return this.events();
+        const ws = flow.websocket;
+        if (!ws) return __React.createElement("div", {style: {
+            color: 'gray'
+        }}, "Not websocket");
+        const decode = (content, type)=>{
+            const bin = atob(content || '');
+            if (type !== 1) return `(binary ${bin.length} bytes)`;
+            const bytes = Uint8Array.from(bin, (c)=>c.charCodeAt(0));
+            return new TextDecoder().decode(bytes);
+        };
+        return __React.createElement("div", null, (ws.messages || []).map((msg, i)=>__React.createElement("div", {key: i, style: {
+                borderBottom: '1px solid #eee',
+                padding: '4px 0',
+                color: msg.dropped ? 'gray' : undefined
+            }}, __React.createElement("span", {style: {
+                marginRight: '8px'
+            }}, msg.fromClient ? '↑' : '↓'), __React.createElement("span", {style: {
+                marginRight: '8px',
+                color: 'gray'
+            }}, new Date(msg.timestamp).toLocaleTimeString()), msg.injected ? __React.createElement("span", {style: {
+                marginRight: '8px',
+                color: 'gray'
+            }}, "(injected)") : null, msg.dropped ? __React.createElement("span", {style: {
+                marginRight: '8px'
+            }}, "(dropped)") : null, __React.createElement("span", {style: {
+                whiteSpace: 'pre-wrap',
+                wordBreak: 'break-all'
+            }}, decode(msg.content, msg.type)))), !ws.closeCode ? null : __React.createElement("div", {style: {
+            color: 'gray',
+            padding: '4px 0'
+        }}, "Closed by ", ws.closedByClient ? 'client' : 'server', ": ", ws.closeCode, " ", ws.closeReason));
+    }
+    events() {
+        const { flow } = this.props;
+        if (!flow || !flow.eventStream) return null;
+        return __React.createElement("div", null, (flow.eventStream.events || []).map((e, i)=>__React.createElement("div", {key: i, style: {
+                borderBottom: '1px solid #eee',
+                padding: '4px 0',
+                color: e.dropped ? 'gray' : undefined
+            }}, __React.createElement("span", {style: {
+                marginRight: '8px',
+                color: 'gray'
+            }}, new Date(e.timestamp).toLocaleTimeString()), e.event ? __React.createElement("span", {style: {
+                marginRight: '8px'
+            }}, e.event) : null, e.id ? __React.createElement("span", {style: {
+                marginRight: '8px',
+                color: 'gray'
+            }}, "#", e.id) : null, e.injected ? __React.createElement("span", {style: {
+                marginRight: '8px',
+                color: 'gray'
+            }}, "(injected)") : null, e.dropped ? __React.createElement("span", {style: {
+                marginRight: '8px'
+            }}, "(dropped)") : null, __React.createElement("span", {style: {
+                whiteSpace: 'pre-wrap',
+                wordBreak: 'break-all'
+            }}, e.data))));
+    }
+    detail() {
+        const { flow } = this.props;
+        if (!flow) return null;
+        const conn = flow.getConn();
+        if (!conn) return null;
+        const sendFlowMeta = ()=>{
+            this.props.onMessage(buildMessageFlowMeta(flow));
+            this.props.onReRenderFlows();
+        };
+        const metadataKeys = Object.keys(flow.metadata);
+        return __React.createElement("div", null, __React.createElement("div", {className: "header-block"}, __React.createElement("p", null, "Flow"), __React.createElement("div", {className: "header-block-content"}, __React.createElement(FormCheck, {type: "checkbox", checked: flow.marked, onChange: (e)=>{
+            flow.marked = e.target.checked;
+            sendFlowMeta();
+        }, label: "Marked"}), __React.createElement(Form.Control, {size: "sm", placeholder: "Comment", key: flow.id, defaultValue: flow.comment, onBlur: (e)=>{
+            if (e.target.value === flow.comment) return;
+            flow.comment = e.target.value;
+            sendFlowMeta();
+        }}), metadataKeys.map((key)=>{
+            return __React.createElement("p", {key: key}, key, ": ", JSON.stringify(flow.metadata[key]));
+        }))), __React.createElement("div", {className: "header-block"}, __React.createElement("p", null, "Server Connection"), __React.createElement("div", {className: "header-block-content"}, __React.createElement("p", null, "Address: ", conn.serverConn.address), __React.createElement("p", null, "Resolved Address: ", conn.serverConn.peername))), __React.createElement("div", {className: "header-block"}, __React.createElement("p", null, "Client Connection"), __React.createElement("div", {className: "header-block-content"}, __React.createElement("p", null, "Address: ", conn.clientConn.address))));
+    }
+    render() {
+        if (!this.props.flow) return null;
+        const flow = this.props.flow;
+        const flowTab = this.state.flowTab;
+        const request = flow.request;
+        const response = flow.response || {};
+        const searchItems = [];
+        if (flow.url && flow.url.search) {
+            flow.url.searchParams.forEach((value, key)=>{
+                searchItems.push({
+                    key,
+                    value
+                });
+            });
+        }
+        return __React.createElement("div", {className: "flow-detail"}, __React.createElement("div", {className: "header-tabs"}, __React.createElement("span", {onClick: ()=>{
+            this.props.onClose();
+        }}, "x"), __React.createElement("span", {className: flowTab === 'Detail' ? 'selected' : undefined, onClick: ()=>{
+            this.setState({
+                flowTab: 'Detail'
+            });
+        }}, "Detail"), __React.createElement("span", {className: flowTab === 'Headers' ? 'selected' : undefined, onClick: ()=>{
+            this.setState({
+                flowTab: 'Headers'
+            });
+        }}, "Headers"), __React.createElement("span", {className: flowTab === 'Preview' ? 'selected' : undefined, onClick: ()=>{
+            this.setState({
+                flowTab: 'Preview'
+            });
+        }}, "Preview"), __React.createElement("span", {className: flowTab === 'Response' ? 'selected' : undefined, onClick: ()=>{
+            this.setState({
+                flowTab: 'Response'
+            });
+        }}, "Response"), __React.createElement("span", {className: flowTab === 'Hexview' ? 'selected' : undefined, onClick: ()=>{
+            this.setState({
+                flowTab: 'Hexview'
+            });
+        }}, "Hexview"), !(flow.websocket || flow.eventStream) ? null : __React.createElement("span", {className: flowTab === 'Messages' ? 'selected' : undefined, onClick: ()=>{
+            this.setState({
+                flowTab: 'Messages'
+            });
+        }}, "Messages"), __React.createElement(EditFlow, {flow: flow, onChangeRequest: (request)=>{
+            flow.request.method = request.method;
+            flow.request.url = request.url;
+            flow.request.header = request.header;
+            if (isTextBody(flow.request)) flow.request.body = request.body;
+            this.props.onReRenderFlows();
+        }, onChangeResponse: (response)=>{
+            if (!flow.response) flow.response = {};
+            flow.response.statusCode = response.statusCode;
+            flow.response.header = response.header;
+            if (isTextBody(flow.response)) flow.response.body = response.body;
+            this.props.onReRenderFlows();
+        }, onMessage: (msg)=>{
+            this.props.onMessage(msg);
+            flow.waitIntercept = false;
+            this.props.onReRenderFlows();
+        }})), __React.createElement("div", {style: {
+            padding: '20px'
+        }}, !(flowTab === 'Headers') ? null : __React.createElement("div", null, __React.createElement("p", null, __React.createElement(Button, {size: "sm", variant: this.state.copied ? 'success' : 'primary', disabled: this.state.copied, onClick: ()=>{
+            const curl = fetchToCurl({
+                url: flow.request.url,
+                method: flow.request.method,
+                headers: Object.keys(flow.request.header).reduce((obj, key)=>{
+                    obj[key] = flow.request.header[key][0];
+                    return obj;
+                }, {}),
+                body: flow.requestBody()
+            });
+            copy(curl);
+            this.setState({
+                copied: true
+            }, ()=>{
+                setTimeout(()=>{
+                    this.setState({
+                        copied: false
+                    });
+                }, 1000);
+            });
+        }}, this.state.copied ? 'Copied' : 'Copy as cURL')), __React.createElement("div", {className: "header-block"}, __React.createElement("p", null, "General"), __React.createElement("div", {className: "header-block-content"}, __React.createElement("p", null, "Request URL: ", request.url), __React.createElement("p", null, "Request Method: ", request.method), __React.createElement("p", null, "Status Code: ", `${response.statusCode || '(pending)'}`))), !response.header ? null : __React.createElement("div", {className: "header-block"}, __React.createElement("p", null, "Response Headers"), __React.createElement("div", {className: "header-block-content"}, Object.keys(response.header).map((key)=>{
+            return __React.createElement("p", {key: key}, key, ": ", response.header[key].join(' '));
+        }))), __React.createElement("div", {className: "header-block"}, __React.createElement("p", null, "Request Headers"), __React.createElement("div", {className: "header-block-content"}, !request.header ? null : Object.keys(request.header).map((key)=>{
+            return __React.createElement("p", {key: key}, key, ": ", request.header[key].join(' '));
+        }))), !searchItems.length ? null : __React.createElement("div", {className: "header-block"}, __React.createElement("p", null, "Query String Parameters"), __React.createElement("div", {className: "header-block-content"}, searchItems.map(({ key, value })=>{
+            return __React.createElement("p", {key: key}, key, ": ", value);
+        }))), !(request.body && request.body.byteLength) ? null : __React.createElement("div", {className: "header-block"}, __React.createElement("p", null, "Request Body"), __React.createElement("div", {className: "header-block-content"}, __React.createElement("div", null, __React.createElement("div", {className: "request-body-detail", style: {
+            marginBottom: '15px'
+        }}, __React.createElement("span", {className: this.state.requestBodyViewTab === 'Raw' ? 'selected' : undefined, onClick: ()=>{
+            this.setState({
+                requestBodyViewTab: 'Raw'
+            });
+        }}, "Raw"), __React.createElement("span", {className: this.state.requestBodyViewTab === 'Preview' ? 'selected' : undefined, onClick: ()=>{
+            this.setState({
+                requestBodyViewTab: 'Preview'
+            });
+        }}, "Preview")), !(this.state.requestBodyViewTab === 'Raw') ? null : __React.createElement("div", null, !flow.isTextRequest() ? __React.createElement("span", {style: {
+            color: 'gray'
+        }}, "Not text Request") : flow.requestBody()), !(this.state.requestBodyViewTab === 'Preview') ? null : __React.createElement("div", null, this.requestBodyPreview()))))), !(flowTab === 'Response') ? null : !(response.body && response.body.byteLength) ? __React.createElement("div", {style: {
+            color: 'gray'
+        }}, "No response") : !flow.isTextResponse() ? __React.createElement("div", {style: {
+            color: 'gray'
+        }}, "Not text response") : __React.createElement("div", null, __React.createElement("div", {style: {
+            marginBottom: '20px'
+        }}, __React.createElement(FormCheck, {inline: true, type: "checkbox", checked: this.state.responseBodyLineBreak, onChange: (e)=>{
+            this.setState({
+                responseBodyLineBreak: e.target.checked
+            });
+        }, label: "自动换行"})), __React.createElement("div", {style: {
+            whiteSpace: this.state.responseBodyLineBreak ? 'pre-wrap' : 'pre'
+        }}, flow.responseBody())), !(flowTab === 'Preview') ? null : __React.createElement("div", null, this.preview()), !(flowTab === 'Hexview') ? null : __React.createElement("div", null, this.hexview()), !(flowTab === 'Messages') ? null : __React.createElement("div", null, this.messages()), !(flowTab === 'Detail') ? null : __React.createElement("div", null, this.detail())));
+    }
+}
+exports.default = ViewFlow;
+
+},
+"app/index": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+var __m0 = __webpack_require__(1);
+var React = __m0;
+var __m1 = __webpack_require__(20);
+var ReactDOM = __m1;
+var __m2 = __webpack_require__("app/App");
+var App = __m2.default;
+var __m3 = __webpack_require__("app/reportWebVitals");
+var reportWebVitals = __m3.default;
+
+
+
+
+
+ReactDOM.render(__React.createElement(React.StrictMode, null, __React.createElement(App, null)), document.getElementById('root'));
+reportWebVitals();
+
+},
+"app/lib/connection": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+Object.defineProperty(exports, "ConnectionManager", { enumerable: true, get: function () { return ConnectionManager } });
+class ConnectionManager {
+    _map;
+    constructor(){
+        this._map = new Map();
+    }
+    get(id) {
+        return this._map.get(id);
+    }
+    add(id, conn) {
+        this._map.set(id, conn);
+    }
+    delete(id) {
+        this._map.delete(id);
+    }
+}
+
+},
+"app/lib/flow": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+Object.defineProperty(exports, "Flow", { enumerable: true, get: function () { return Flow } });
+Object.defineProperty(exports, "FlowManager", { enumerable: true, get: function () { return FlowManager } });
+var __m0 = __webpack_require__("app/lib/message");
+var { MessageType } = __m0;
+var __m1 = __webpack_require__("app/lib/utils");
+var { arrayBufferToBase64, bufHexView, getSize, isTextBody } = __m1;
+
+
+const maxWebSocketMessages = 1000;
+const maxEventStreamEvents = 1000;
+class Flow {
+    no;
+    id;
+    connId;
+    waitIntercept;
+    request;
+    response = null;
+    marked = false;
+    comment = '';
+    metadata = {};
+    websocket = null;
+    eventStream = null;
+    url;
+    path;
+    _size = 0;
+    size = '0';
+    headerContentLengthExist = false;
+    contentType = '';
+    startTime = Date.now();
+    endTime = 0;
+    costTime = '(pending)';
+    static curNo = 0;
+    status = MessageType.REQUEST;
+    _isTextRequest;
+    _isTextResponse;
+    _requestBody;
+    _hexviewRequestBody = null;
+    _responseBody;
+    _previewResponseBody = null;
+    _previewRequestBody = null;
+    _hexviewResponseBody = null;
+    connMgr;
+    conn;
+    constructor(msg, connMgr){
+        this.no = ++Flow.curNo;
+        this.id = msg.id;
+        this.waitIntercept = msg.waitIntercept;
+        const flowRequestMsg = msg.content;
+        this.connId = flowRequestMsg.connId;
+        this.request = flowRequestMsg.request;
+        this.url = new URL(this.request.url);
+        this.path = this.url.pathname + this.url.search;
+        this._isTextRequest = null;
+        this._isTextResponse = null;
+        this._requestBody = null;
+        this._responseBody = null;
+        this.connMgr = connMgr;
+    }
+    addRequestBody(msg) {
+        this.status = MessageType.REQUEST_BODY;
+        this.waitIntercept = msg.waitIntercept;
+        this.request.body = msg.content;
+        return this;
+    }
+    addResponse(msg) {
+        this.status = MessageType.RESPONSE;
+        this.waitIntercept = msg.waitIntercept;
+        this.response = msg.content;
+        if (this.response && this.response.header) {
+            if (this.response.header['Content-Type'] != null) {
+                this.contentType = this.response.header['Content-Type'][0].split(';')[0];
+                if (this.contentType.includes('javascript')) this.contentType = 'javascript';
+            }
+            if (this.response.header['Content-Length'] != null) {
+                this.headerContentLengthExist = true;
+                this._size = parseInt(this.response.header['Content-Length'][0]);
+                this.size = getSize(this._size);
+            }
+        }
+        return this;
+    }
+    addResponseBody(msg) {
+        this.status = MessageType.RESPONSE_BODY;
+        this.waitIntercept = msg.waitIntercept;
+        if (this.response) this.response.body = msg.content;
+        this.endTime = Date.now();
+        this.costTime = String(this.endTime - this.startTime) + ' ms';
+        if (!this.headerContentLengthExist && this.response && this.response.body) {
+            this._size = this.response.body.byteLength;
+            this.size = getSize(this._size);
+        }
+        return this;
+    }
+    addFlowMeta(msg) {
+        const meta = msg.content;
+        this.marked = meta.marked;
+        this.comment = meta.comment;
+        if (meta.metadata) this.metadata = meta.metadata;
+        return this;
+    }
+    addWebSocket(msg) {
+        const ws = msg.content;
+        this.websocket = {
+            ...ws,
+            messages: this.websocket?.messages || []
+        };
+        return this;
+    }
+    addWebSocketMessage(msg) {
+        if (!this.websocket) this.websocket = {
+            messages: [],
+            closeCode: 0,
+            closeReason: '',
+            closedByClient: false
+        };
+        const messages = this.websocket.messages || [];
+        messages.push(msg.content);
+        if (messages.length > maxWebSocketMessages) messages.splice(0, messages.length - maxWebSocketMessages);
+        this.websocket = {
+            ...this.websocket,
+            messages
+        };
+        return this;
+    }
+    addServerSentEvent(msg) {
+        const events = this.eventStream?.events || [];
+        events.push(msg.content);
+        if (events.length > maxEventStreamEvents) events.splice(0, events.length - maxEventStreamEvents);
+        this.eventStream = {
+            events
+        };
+        return this;
+    }
+    preview() {
+        return {
+            no: this.no,
+            id: this.id,
+            waitIntercept: this.waitIntercept,
+            marked: this.marked,
+            host: this.url.host,
+            path: this.path,
+            method: this.request.method,
+            statusCode: this.response ? String(this.response.statusCode) : '(pending)',
+            size: this.size,
+            costTime: this.costTime,
+            contentType: this.contentType
+        };
+    }
+    isTextRequest() {
+        if (this._isTextRequest !== null) return this._isTextRequest;
+        this._isTextRequest = isTextBody(this.request);
+        return this._isTextRequest;
+    }
+    requestBody() {
+        if (this._requestBody !== null) return this._requestBody;
+        if (!this.isTextRequest()) {
+            this._requestBody = '';
+            return this._requestBody;
+        }
+        if (this.status < MessageType.REQUEST_BODY) return '';
+        this._requestBody = new TextDecoder().decode(this.request.body);
+        return this._requestBody;
+    }
+    hexviewRequestBody() {
+        if (this._hexviewRequestBody !== null) return this._hexviewRequestBody;
+        if (this.status < MessageType.REQUEST_BODY) return null;
+        if (!this.request?.body?.byteLength) return null;
+        this._hexviewRequestBody = bufHexView(this.request.body);
+        return this._hexviewRequestBody;
+    }
+    isTextResponse() {
+        if (this.status < MessageType.RESPONSE) return null;
+        if (this._isTextResponse !== null) return this._isTextResponse;
+        this._isTextResponse = isTextBody(this.response);
+        return this._isTextResponse;
+    }
+    responseBody() {
+        if (this._responseBody !== null) return this._responseBody;
+        if (this.status < MessageType.RESPONSE) return '';
+        if (!this.isTextResponse()) {
+            this._responseBody = '';
+            return this._responseBody;
+        }
+        if (this.status < MessageType.RESPONSE_BODY) return '';
+        this._responseBody = new TextDecoder().decode(this.response?.body);
+        return this._responseBody;
+    }
+    previewResponseBody() {
+        if (this._previewResponseBody) return this._previewResponseBody;
+        if (this.status < MessageType.RESPONSE_BODY) return null;
+        if (!this.response?.body?.byteLength) return null;
+        let contentType;
+        if (this.response.header['Content-Type']) contentType = this.response.header['Content-Type'][0];
+        if (!contentType) return null;
+        if (contentType.startsWith('image/')) {
+            this._previewResponseBody = {
+                type: 'image',
+                data: arrayBufferToBase64(this.response.body)
+            };
+        } else if (contentType.includes('application/json')) {
+            this._previewResponseBody = {
+                type: 'json',
+                data: this.responseBody()
+            };
+        }
+        return this._previewResponseBody;
+    }
+    previewRequestBody() {
+        if (this._previewRequestBody) return this._previewRequestBody;
+        if (this.status < MessageType.REQUEST_BODY) return null;
+        if (!this.request.body?.byteLength) return null;
+        if (!this.isTextRequest()) {
+            this._previewRequestBody = {
+                type: 'binary',
+                data: this.hexviewRequestBody()
+            };
+        } else if (/json/.test(this.request.header['Content-Type'].join(''))) {
+            this._previewRequestBody = {
+                type: 'json',
+                data: this.requestBody()
+            };
+        }
+        return this._previewRequestBody;
+    }
+    hexviewResponseBody() {
+        if (this._hexviewResponseBody !== null) return this._hexviewResponseBody;
+        if (this.status < MessageType.RESPONSE_BODY) return null;
+        if (!this.response?.body?.byteLength) return null;
+        this._hexviewResponseBody = bufHexView(this.response.body);
+        return this._hexviewResponseBody;
+    }
+    getConn() {
+        if (this.conn) return this.conn;
+        this.conn = this.connMgr.get(this.connId);
+        return this.conn;
+    }
+}
+class FlowManager {
+    items;
+    _map;
+    filterText;
+    filterTimer;
+    num;
+    max;
+    constructor(){
+        this.items = [];
+        this._map = new Map();
+        this.filterText = '';
+        this.filterTimer = null;
+        this.num = 0;
+        this.max = 1000;
+    }
+    showList() {
+        let text = this.filterText;
+        if (text) text = text.trim();
+        if (!text) return this.items;
+        if (text.startsWith('~')) {
+            const [cmd, ...rest] = text.slice(1).split(/\s+/);
+            const arg = rest.join(' ');
+            if (cmd === 'marked') {
+                return this.items.filter((item)=>item.marked);
+            }
+            if (cmd === 'comment') {
+                return this.items.filter((item)=>item.comment && item.comment.includes(arg));
+            }
+            if (cmd === 'meta') {
+                const [key, value] = arg.split('=');
+                return this.items.filter((item)=>{
+                    if (!(key in item.metadata)) return false;
+                    if (value === undefined) return true;
+                    return String(item.metadata[key]) === value;
+                });
+            }
+            return this.items;
+        }
+        if (text.startsWith('/') && text.endsWith('/')) {
+            text = text.slice(1, text.length - 1).trim();
+            if (!text) return this.items;
+            try {
+                const reg = new RegExp(text);
+                return this.items.filter((item)=>{
+                    return reg.test(item.request.url);
+                });
+            } catch (err) {
+                return this.items;
+            }
+        }
+        return this.items.filter((item)=>{
+            return item.request.url.includes(text);
+        });
+    }
+    add(item) {
+        item.no = ++this.num;
+        this.items.push(item);
+        this._map.set(item.id, item);
+        if (this.items.length > this.max) {
+            const oldest = this.items.shift();
+            if (oldest) this._map.delete(oldest.id);
+        }
+    }
+    get(id) {
+        return this._map.get(id);
+    }
+    changeFilter(text) {
+        this.filterText = text;
+    }
+    changeFilterLazy(text, callback) {
+        if (this.filterTimer) {
+            clearTimeout(this.filterTimer);
+            this.filterTimer = null;
+        }
+        this.filterTimer = setTimeout(()=>{
+            this.filterText = text;
+            callback();
+        }, 300);
+    }
+    clear() {
+        this.items = [];
+        this._map = new Map();
+    }
+}
+
+},
+"app/lib/message": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+Object.defineProperty(exports, "MessageType", { enumerable: true, get: function () { return MessageType } });
+Object.defineProperty(exports, "parseMessage", { enumerable: true, get: function () { return parseMessage } });
+Object.defineProperty(exports, "SendMessageType", { enumerable: true, get: function () { return SendMessageType } });
+Object.defineProperty(exports, "buildMessageEdit", { enumerable: true, get: function () { return buildMessageEdit } });
+Object.defineProperty(exports, "buildMessageMeta", { enumerable: true, get: function () { return buildMessageMeta } });
+Object.defineProperty(exports, "buildMessageFlowMeta", { enumerable: true, get: function () { return buildMessageFlowMeta } });
+const messageVersion = 2;
+var MessageType = /*#__PURE__*/ function(MessageType) {
+    MessageType[MessageType["CONN"] = 0] = "CONN";
+    MessageType[MessageType["CONN_CLOSE"] = 5] = "CONN_CLOSE";
+    MessageType[MessageType["REQUEST"] = 1] = "REQUEST";
+    MessageType[MessageType["REQUEST_BODY"] = 2] = "REQUEST_BODY";
+    MessageType[MessageType["RESPONSE"] = 3] = "RESPONSE";
+    MessageType[MessageType["RESPONSE_BODY"] = 4] = "RESPONSE_BODY";
+    MessageType[MessageType["FLOW_META"] = 6] = "FLOW_META";
+    MessageType[MessageType["WEBSOCKET"] = 7] = "WEBSOCKET";
+    MessageType[MessageType["SERVER_SENT_EVENT"] = 8] = "SERVER_SENT_EVENT";
+    MessageType[MessageType["WEBSOCKET_MESSAGE"] = 9] = "WEBSOCKET_MESSAGE";
+    return MessageType;
+}({});
+const allMessageBytes = [
+    0,
+    5,
+    1,
+    2,
+    3,
+    4,
+    6,
+    7,
+    8,
+    9
+];
+const parseMessage = (data)=>{
+    if (data.byteLength < 39) return null;
+    const meta = new Int8Array(data.slice(0, 39));
+    const version = meta[0];
+    if (version !== messageVersion) return null;
+    const type = meta[1];
+    if (!allMessageBytes.includes(type)) return null;
+    const id = new TextDecoder().decode(data.slice(2, 38));
+    const waitIntercept = meta[38] === 1;
+    const resp = {
+        type,
+        id,
+        waitIntercept
+    };
+    if (data.byteLength === 39) return resp;
+    if (type === 2 || type === 4) {
+        resp.content = data.slice(39);
+        return resp;
+    }
+    const contentStr = new TextDecoder().decode(data.slice(39));
+    let content;
+    try {
+        content = JSON.parse(contentStr);
+    } catch (err) {
+        return null;
+    }
+    resp.content = content;
+    return resp;
+};
+var SendMessageType = /*#__PURE__*/ function(SendMessageType) {
+    SendMessageType[SendMessageType["CHANGE_REQUEST"] = 11] = "CHANGE_REQUEST";
+    SendMessageType[SendMessageType["CHANGE_RESPONSE"] = 12] = "CHANGE_RESPONSE";
+    SendMessageType[SendMessageType["DROP_REQUEST"] = 13] = "DROP_REQUEST";
+    SendMessageType[SendMessageType["DROP_RESPONSE"] = 14] = "DROP_RESPONSE";
+    SendMessageType[SendMessageType["CHANGE_BREAK_POINT_RULES"] = 21] = "CHANGE_BREAK_POINT_RULES";
+    SendMessageType[SendMessageType["CHANGE_FLOW_META"] = 22] = "CHANGE_FLOW_META";
+    return SendMessageType;
+}({});
+const buildMessageEdit = (messageType, flow)=>{
+    if (messageType === 13 || messageType === 14) {
+        const view = new Uint8Array(38);
+        view[0] = messageVersion;
+        view[1] = messageType;
+        view.set(new TextEncoder().encode(flow.id), 2);
+        return view;
+    }
+    let header;
+    let body;
+    if (messageType === 11) {
+        ({ body, ...header } = flow.request);
+    } else if (messageType === 12) {
+        ({ body, ...header } = flow.response);
+    } else {
+        throw new Error('invalid message type');
+    }
+    if (body instanceof ArrayBuffer) body = new Uint8Array(body);
+    const bodyLen = body && body.byteLength ? body.byteLength : 0;
+    if ('Content-Encoding' in header.header) delete header.header['Content-Encoding'];
+    if ('Transfer-Encoding' in header.header) delete header.header['Transfer-Encoding'];
+    header.header['Content-Length'] = [
+        String(bodyLen)
+    ];
+    const headerBytes = new TextEncoder().encode(JSON.stringify(header));
+    const len = 2 + 36 + 4 + headerBytes.byteLength + 4 + bodyLen;
+    const data = new ArrayBuffer(len);
+    const view = new Uint8Array(data);
+    view[0] = messageVersion;
+    view[1] = messageType;
+    view.set(new TextEncoder().encode(flow.id), 2);
+    view.set(headerBytes, 2 + 36 + 4);
+    if (bodyLen) view.set(body, 2 + 36 + 4 + headerBytes.byteLength + 4);
+    const view2 = new DataView(data);
+    view2.setUint32(2 + 36, headerBytes.byteLength);
+    view2.setUint32(2 + 36 + 4 + headerBytes.byteLength, bodyLen);
+    return view;
+};
+const buildMessageMeta = (messageType, rules)=>{
+    if (messageType !== 21) {
+        throw new Error('invalid message type');
+    }
+    const rulesBytes = new TextEncoder().encode(JSON.stringify(rules));
+    const view = new Uint8Array(2 + rulesBytes.byteLength);
+    view[0] = messageVersion;
+    view[1] = messageType;
+    view.set(rulesBytes, 2);
+    return view;
+};
+const buildMessageFlowMeta = (flow)=>{
+    const meta = {
+        marked: flow.marked,
+        comment: flow.comment
+    };
+    const metaBytes = new TextEncoder().encode(JSON.stringify(meta));
+    const view = new Uint8Array(2 + 36 + metaBytes.byteLength);
+    view[0] = messageVersion;
+    view[1] = 22;
+    view.set(new TextEncoder().encode(flow.id), 2);
+    view.set(metaBytes, 2 + 36);
+    return view;
+};
+
+},
+"app/lib/utils": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+Object.defineProperty(exports, "isTextBody", { enumerable: true, get: function () { return isTextBody } });
+Object.defineProperty(exports, "getSize", { enumerable: true, get: function () { return getSize } });
+Object.defineProperty(exports, "shallowEqual", { enumerable: true, get: function () { return shallowEqual } });
+Object.defineProperty(exports, "arrayBufferToBase64", { enumerable: true, get: function () { return arrayBufferToBase64 } });
+Object.defineProperty(exports, "bufHexView", { enumerable: true, get: function () { return bufHexView } });
+Object.defineProperty(exports, "isInViewPort", { enumerable: true, get: function () { return isInViewPort } });
+Object.defineProperty(exports, "apiHost", { enumerable: true, get: function () { return apiHost } });
+const isTextBody = (payload)=>{
+    if (!payload) return false;
+    if (!payload.header) return false;
+    if (!payload.header['Content-Type']) return false;
+    return /text|javascript|json|x-www-form-urlencoded|xml|form-data/.test(payload.header['Content-Type'].join(''));
+};
+const getSize = (len)=>{
+    if (!len) return '0';
+    if (isNaN(len)) return '0';
+    if (len <= 0) return '0';
+    if (len < 1024) return `${len} B`;
+    if (len < 1024 * 1024) return `${(len / 1024).toFixed(2)} KB`;
+    return `${(len / (1024 * 1024)).toFixed(2)} MB`;
+};
+const shallowEqual = (objA, objB)=>{
+    if (objA === objB) return true;
+    const keysA = Object.keys(objA);
+    const keysB = Object.keys(objB);
+    if (keysA.length !== keysB.length) return false;
+    for(let i = 0; i < keysA.length; i++){
+        const key = keysA[i];
+        if (objB[key] === undefined || objA[key] !== objB[key]) return false;
+    }
+    return true;
+};
+const arrayBufferToBase64 = (buf)=>{
+    let binary = '';
+    const bytes = new Uint8Array(buf);
+    const len = bytes.byteLength;
+    for(let i = 0; i < len; i++){
+        binary += String.fromCharCode(bytes[i]);
+    }
+    return btoa(binary);
+};
+const bufHexView = (buf)=>{
+    let str = '';
+    const bytes = new Uint8Array(buf);
+    const len = bytes.byteLength;
+    let viewStr = '';
+    str += '00000000:  ';
+    for(let i = 0; i < len; i++){
+        str += bytes[i].toString(16).padStart(2, '0') + ' ';
+        if (bytes[i] >= 32 && bytes[i] <= 126) {
+            viewStr += String.fromCharCode(bytes[i]);
+        } else {
+            viewStr += '.';
+        }
+        if ((i + 1) % 16 === 0) {
+            str += '   ' + viewStr;
+            viewStr = '';
+            str += `\n${(i + 1).toString(16).padStart(8, '0')}:  `;
+        } else if ((i + 1) % 8 === 0) {
+            str += '  ';
+        }
+    }
+    if (viewStr.length > 0) {
+        for(let i = viewStr.length; i < 16; i++){
+            str += '  ' + ' ';
+            if ((i + 1) % 8 === 0) str += '  ';
+        }
+        str += ' ' + viewStr;
+    }
+    return str;
+};
+function isInViewPort(element) {
+    const viewWidth = window.innerWidth || document.documentElement.clientWidth;
+    const viewHeight = window.innerHeight || document.documentElement.clientHeight;
+    const { top, right, bottom, left } = element.getBoundingClientRect();
+    return top >= 0 && left >= 0 && right <= viewWidth && bottom <= viewHeight;
+}
+const apiHost = ()=>{
+    if ("production" === 'development') return 'http://localhost:9081';
+    return '';
+};
+
+},
+"app/reportWebVitals": function (module, exports, __webpack_require__) {
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+var __React = __webpack_require__(1);
+
+const reportWebVitals = (onPerfEntry)=>{
+    if (onPerfEntry && onPerfEntry instanceof Function) {
+        __webpack_require__.e(3).then(__webpack_require__.bind(null, 67)).then(({ getCLS, getFID, getFCP, getLCP, getTTFB })=>{
+            getCLS(onPerfEntry);
+            getFID(onPerfEntry);
+            getFCP(onPerfEntry);
+            getLCP(onPerfEntry);
+            getTTFB(onPerfEntry);
+        });
+    }
+};
+exports.default = reportWebVitals;
+
+}
+},[["app/index",1,2]]]);
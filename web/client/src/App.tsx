@@ -5,6 +5,7 @@ import Button from 'react-bootstrap/Button'
 import './App.css'
 
 import BreakPoint from './components/BreakPoint'
+import Conditions from './components/Conditions'
 import FlowPreview from './components/FlowPreview'
 import ViewFlow from './components/ViewFlow'
 
@@ -148,6 +149,30 @@ class App extends React.Component<IProps, IState> {
         flow.addResponseBody(msg)
         this.setState({ flows: this.state.flows })
       }
+      else if (msg.type === MessageType.FLOW_META) {
+        const flow = this.flowMgr.get(msg.id)
+        if (!flow) return
+        flow.addFlowMeta(msg)
+        this.setState({ flows: this.flowMgr.showList() })
+      }
+      else if (msg.type === MessageType.WEBSOCKET) {
+        const flow = this.flowMgr.get(msg.id)
+        if (!flow) return
+        flow.addWebSocket(msg)
+        this.setState({ flows: this.state.flows })
+      }
+      else if (msg.type === MessageType.WEBSOCKET_MESSAGE) {
+        const flow = this.flowMgr.get(msg.id)
+        if (!flow) return
+        flow.addWebSocketMessage(msg)
+        this.setState({ flows: this.state.flows })
+      }
+      else if (msg.type === MessageType.SERVER_SENT_EVENT) {
+        const flow = this.flowMgr.get(msg.id)
+        if (!flow) return
+        flow.addServerSentEvent(msg)
+        this.setState({ flows: this.state.flows })
+      }
     }
   }
 
@@ -162,7 +187,7 @@ class App extends React.Component<IProps, IState> {
           }}>Clear</Button></div>
           <div>
             <Form.Control
-              size="sm" placeholder="Filter"
+              size="sm" placeholder="Filter: text, /regexp/, ~marked, ~comment text, ~meta key=value"
               onChange={(e) => {
                 const value = e.target.value
                 this.flowMgr.changeFilterLazy(value, () => {
@@ -178,6 +203,8 @@ class App extends React.Component<IProps, IState> {
             if (this.ws) this.ws.send(msg)
           }} />
 
+          <Conditions />
+
           <span>status: {this.state.wsStatus}</span>
         </div>
 
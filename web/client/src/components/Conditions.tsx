@@ -0,0 +1,121 @@
+import React from 'react'
+import Button from 'react-bootstrap/Button'
+import Modal from 'react-bootstrap/Modal'
+import Form from 'react-bootstrap/Form'
+import { apiHost } from '../lib/utils'
+
+// network conditions rules of the -conditions file, edited as json: /api/conditions
+
+interface IState {
+  show: boolean
+  text: string
+  error: string | null
+  haveRules: boolean
+}
+
+class Conditions extends React.Component<unknown, IState> {
+  constructor(props: unknown) {
+    super(props)
+
+    this.state = {
+      show: false,
+      text: '',
+      error: null,
+      haveRules: false,
+    }
+
+    this.handleClose = this.handleClose.bind(this)
+    this.handleShow = this.handleShow.bind(this)
+    this.handleSave = this.handleSave.bind(this)
+    this.handleReload = this.handleReload.bind(this)
+  }
+
+  handleClose() {
+    this.setState({ show: false })
+  }
+
+  handleShow() {
+    this.setState({ show: true, error: null })
+    this.request('GET')
+  }
+
+  handleSave() {
+    let rules: any
+    try {
+      rules = JSON.parse(this.state.text || '[]')
+    } catch (err: any) {
+      this.setState({ error: err.message })
+      return
+    }
+    this.request('PUT', JSON.stringify(rules))
+  }
+
+  // reads the rules from the file again
+  handleReload() {
+    this.request('POST')
+  }
+
+  async request(method: 'GET' | 'PUT' | 'POST', body?: string) {
+    try {
+      const res = await fetch(`${apiHost()}/api/conditions`, { method, body })
+      if (res.status === 404) {
+        this.setState({ text: '', error: 'network conditions are not enabled, start with -conditions <file>' })
+        return
+      }
+      if (!res.ok) {
+        this.setState({ error: await res.text() })
+        return
+      }
+      const rules = await res.json()
+      this.setState({
+        text: JSON.stringify(rules, null, 2),
+        error: null,
+        haveRules: Array.isArray(rules) && rules.length > 0,
+      })
+    } catch (err: any) {
+      this.setState({ error: err.message })
+    }
+  }
+
+  render() {
+    const { text, error, haveRules } = this.state
+    const variant = haveRules ? 'success' : 'primary'
+
+    return (
+      <div>
+        <Button variant={variant} size="sm" onClick={this.handleShow}>Conditions</Button>
+
+        <Modal show={this.state.show} onHide={this.handleClose} size="lg">
+          <Modal.Header closeButton>
+            <Modal.Title>Network Conditions</Modal.Title>
+          </Modal.Header>
+
+          <Modal.Body>
+            <Form.Control
+              as="textarea"
+              rows={16}
+              style={{ fontFamily: 'Menlo,Monaco,monospace', fontSize: '0.8rem' }}
+              value={text}
+              onChange={e => { this.setState({ text: e.target.value }) }}
+            />
+            {error ? <div style={{ color: 'red', marginTop: '10px' }}>{error}</div> : null}
+          </Modal.Body>
+
+          <Modal.Footer>
+            <Button variant="secondary" onClick={this.handleClose}>
+              Close
+            </Button>
+            <Button variant="secondary" onClick={this.handleReload}>
+              Reload File
+            </Button>
+            <Button variant="primary" onClick={this.handleSave}>
+              Save
+            </Button>
+          </Modal.Footer>
+        </Modal>
+      </div>
+    )
+  }
+}
+
+export default Conditions
@@ -0,0 +1,107 @@
+import React from 'react'
+import Form from 'react-bootstrap/Form'
+import type { Flow } from '../lib/flow'
+import { apiHost, arrayBufferToBase64 } from '../lib/utils'
+
+// same views as the Dumper, rendered by the go side: /api/contentview
+
+interface Iprops {
+  flow: Flow
+  part: 'request' | 'response' | 'query'
+  version: number // changes when the body changes
+}
+
+interface IState {
+  view: string // empty for auto
+  views: string[]
+  currentView: string
+  text: string | null
+  error: string | null
+}
+
+interface IContentViewResult {
+  view: string
+  views: string[]
+  text: string
+}
+
+class ContentView extends React.Component<Iprops, IState> {
+  private fetchNo = 0
+
+  constructor(props: Iprops) {
+    super(props)
+
+    this.state = {
+      view: '',
+      views: [],
+      currentView: '',
+      text: null,
+      error: null,
+    }
+  }
+
+  componentDidMount() {
+    this.fetch()
+  }
+
+  componentDidUpdate(prevProps: Iprops, prevState: IState) {
+    if (prevProps.flow.id !== this.props.flow.id || prevProps.part !== this.props.part) {
+      this.setState({ view: '' }, () => this.fetch())
+      return
+    }
+    if (prevProps.version !== this.props.version || prevState.view !== this.state.view) {
+      this.fetch()
+    }
+  }
+
+  async fetch() {
+    const no = ++this.fetchNo
+    const { flow, part } = this.props
+    const { method, url, header } = flow.request
+    const body = part === 'response' ? flow.response?.body : flow.request.body
+    // the go side does not keep the bodies of the flows
+    const req = {
+      id: flow.id,
+      part,
+      view: this.state.view,
+      request: { method, url, header },
+      responseHeader: flow.response?.header,
+      body: body ? arrayBufferToBase64(body) : '',
+    }
+    try {
+      const res = await fetch(`${apiHost()}/api/contentview`, { method: 'POST', body: JSON.stringify(req) })
+      if (no !== this.fetchNo) return
+      if (!res.ok) {
+        this.setState({ text: null, error: await res.text() })
+        return
+      }
+      const result: IContentViewResult = await res.json()
+      if (no !== this.fetchNo) return
+      this.setState({ views: result.views, currentView: result.view, text: result.text, error: null })
+    } catch (err) {
+      if (no !== this.fetchNo) return
+      this.setState({ text: null, error: String(err) })
+    }
+  }
+
+  render() {
+    const { views, currentView, text, error } = this.state
+
+    return (
+      <div>
+        <div style={{ marginBottom: '10px' }}>
+          <Form.Select size="sm" style={{ width: '200px' }} value={this.state.view} onChange={e => { this.setState({ view: e.target.value }) }}>
+            <option value="">auto{currentView && !this.state.view ? ` (${currentView})` : ''}</option>
+            {views.map(v => <option key={v} value={v}>{v}</option>)}
+          </Form.Select>
+        </div>
+        {
+          error ? <div style={{ color: 'gray' }}>{error}</div> :
+            <pre style={{ whiteSpace: 'pre-wrap', wordBreak: 'break-all' }}>{text}</pre>
+        }
+      </div>
+    )
+  }
+}
+
+export default ContentView
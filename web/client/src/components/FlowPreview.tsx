@@ -22,6 +22,7 @@ class FlowPreview extends React.Component<IProps> {
     const classNames = []
     if (this.props.isSelected) classNames.push('tr-selected')
     if (fp.waitIntercept) classNames.push('tr-wait-intercept')
+    if (fp.marked) classNames.push('tr-marked')
 
     return (
       <tr className={classNames.length ? classNames.join(' ') : undefined}
@@ -1,12 +1,14 @@
 import React from 'react'
 import Button from 'react-bootstrap/Button'
 import FormCheck from 'react-bootstrap/FormCheck'
+import Form from 'react-bootstrap/Form'
 import fetchToCurl from 'fetch-to-curl'
 import copy from 'copy-to-clipboard'
-import JSONPretty from 'react-json-pretty'
 import { isTextBody } from '../lib/utils'
+import { buildMessageFlowMeta } from '../lib/message'
 import type { Flow, IResponse } from '../lib/flow'
 import EditFlow from './EditFlow'
+import ContentView from './ContentView'
 
 interface Iprops {
   flow: Flow | null
@@ -16,7 +18,7 @@ interface Iprops {
 }
 
 interface IState {
-  flowTab: 'Headers' | 'Preview' | 'Response' | 'Hexview' | 'Detail'
+  flowTab: 'Headers' | 'Preview' | 'Response' | 'Hexview' | 'Messages' | 'Detail'
   copied: boolean
   requestBodyViewTab: 'Raw' | 'Preview'
   responseBodyLineBreak: boolean
@@ -45,33 +47,20 @@ class ViewFlow extends React.Component<Iprops, IState> {
     }
 
     const pv = flow.previewResponseBody()
-    if (!pv) return <div style={{ color: 'gray' }}>Not support preview</div>
 
-    if (pv.type === 'image') {
-      return <img src={`data:image/png;base64,${pv.data}`} />
-    }
-    else if (pv.type === 'json') {
-      return <div><JSONPretty data={pv.data} keyStyle={'color: rgb(130,40,144);'} stringStyle={'color: rgb(153,68,60);'} valueStyle={'color: rgb(25,1,199);'} booleanStyle={'color: rgb(94,105,192);'} /></div>
-    }
-
-    return <div style={{ color: 'gray' }}>Not support preview</div>
+    return (
+      <div>
+        {pv && pv.type === 'image' ? <div style={{ marginBottom: '10px' }}><img src={`data:image/png;base64,${pv.data}`} /></div> : null}
+        <ContentView flow={flow} part="response" version={response.body.byteLength} />
+      </div>
+    )
   }
 
   requestBodyPreview() {
     const { flow } = this.props
     if (!flow) return null
 
-    const pv = flow.previewRequestBody()
-    if (!pv) return <div style={{ color: 'gray' }}>Not support preview</div>
-
-    if (pv.type === 'json') {
-      return <div><JSONPretty data={pv.data} keyStyle={'color: rgb(130,40,144);'} stringStyle={'color: rgb(153,68,60);'} valueStyle={'color: rgb(25,1,199);'} booleanStyle={'color: rgb(94,105,192);'} /></div>
-    }
-    else if (pv.type === 'binary') {
-      return <div><pre>{pv.data}</pre></div>
-    }
-
-    return <div style={{ color: 'gray' }}>Not support preview</div>
+    return <ContentView flow={flow} part="request" version={flow.request.body?.byteLength || 0} />
   }
 
   hexview() {
@@ -87,6 +76,65 @@ class ViewFlow extends React.Component<Iprops, IState> {
     return <pre>{flow.hexviewResponseBody()}</pre>
   }
 
+  messages() {
+    const { flow } = this.props
+    if (!flow) return null
+    if (flow.eventStream) return this.events()
+    const ws = flow.websocket
+    if (!ws) return <div style={{ color: 'gray' }}>Not websocket</div>
+
+    const decode = (content: string, type: number) => {
+      const bin = atob(content || '')
+      if (type !== 1) return `(binary ${bin.length} bytes)`
+      const bytes = Uint8Array.from(bin, c => c.charCodeAt(0))
+      return new TextDecoder().decode(bytes)
+    }
+
+    return (
+      <div>
+        {
+          (ws.messages || []).map((msg, i) => (
+            <div key={i} style={{ borderBottom: '1px solid #eee', padding: '4px 0', color: msg.dropped ? 'gray' : undefined }}>
+              <span style={{ marginRight: '8px' }}>{msg.fromClient ? '↑' : '↓'}</span>
+              <span style={{ marginRight: '8px', color: 'gray' }}>{new Date(msg.timestamp).toLocaleTimeString()}</span>
+              {msg.injected ? <span style={{ marginRight: '8px', color: 'gray' }}>(injected)</span> : null}
+              {msg.dropped ? <span style={{ marginRight: '8px' }}>(dropped)</span> : null}
+              <span style={{ whiteSpace: 'pre-wrap', wordBreak: 'break-all' }}>{decode(msg.content, msg.type)}</span>
+            </div>
+          ))
+        }
+        {
+          !ws.closeCode ? null :
+            <div style={{ color: 'gray', padding: '4px 0' }}>
+              Closed by {ws.closedByClient ? 'client' : 'server'}: {ws.closeCode} {ws.closeReason}
+            </div>
+        }
+      </div>
+    )
+  }
+
+  events() {
+    const { flow } = this.props
+    if (!flow || !flow.eventStream) return null
+
+    return (
+      <div>
+        {
+          (flow.eventStream.events || []).map((e, i) => (
+            <div key={i} style={{ borderBottom: '1px solid #eee', padding: '4px 0', color: e.dropped ? 'gray' : undefined }}>
+              <span style={{ marginRight: '8px', color: 'gray' }}>{new Date(e.timestamp).toLocaleTimeString()}</span>
+              {e.event ? <span style={{ marginRight: '8px' }}>{e.event}</span> : null}
+              {e.id ? <span style={{ marginRight: '8px', color: 'gray' }}>#{e.id}</span> : null}
+              {e.injected ? <span style={{ marginRight: '8px', color: 'gray' }}>(injected)</span> : null}
+              {e.dropped ? <span style={{ marginRight: '8px' }}>(dropped)</span> : null}
+              <span style={{ whiteSpace: 'pre-wrap', wordBreak: 'break-all' }}>{e.data}</span>
+            </div>
+          ))
+        }
+      </div>
+    )
+  }
+
   detail() {
     const { flow } = this.props
     if (!flow) return null
@@ -94,8 +142,44 @@ class ViewFlow extends React.Component<Iprops, IState> {
     const conn = flow.getConn()
     if (!conn) return null
 
+    const sendFlowMeta = () => {
+      this.props.onMessage(buildMessageFlowMeta(flow))
+      this.props.onReRenderFlows()
+    }
+    const metadataKeys = Object.keys(flow.metadata)
+
     return (
       <div>
+        <div className="header-block">
+          <p>Flow</p>
+          <div className="header-block-content">
+            <FormCheck
+              type="checkbox"
+              checked={flow.marked}
+              onChange={e => {
+                flow.marked = e.target.checked
+                sendFlowMeta()
+              }}
+              label="Marked"></FormCheck>
+            <Form.Control
+              size="sm" placeholder="Comment"
+              key={flow.id}
+              defaultValue={flow.comment}
+              onBlur={(e: React.FocusEvent<HTMLInputElement>) => {
+                if (e.target.value === flow.comment) return
+                flow.comment = e.target.value
+                sendFlowMeta()
+              }}
+            />
+            {
+              metadataKeys.map(key => {
+                return (
+                  <p key={key}>{key}: {JSON.stringify(flow.metadata[key])}</p>
+                )
+              })
+            }
+          </div>
+        </div>
         <div className="header-block">
           <p>Server Connection</p>
           <div className="header-block-content">
@@ -139,6 +223,10 @@ class ViewFlow extends React.Component<Iprops, IState> {
           <span className={flowTab === 'Preview' ? 'selected' : undefined} onClick={() => { this.setState({ flowTab: 'Preview' }) }}>Preview</span>
           <span className={flowTab === 'Response' ? 'selected' : undefined} onClick={() => { this.setState({ flowTab: 'Response' }) }}>Response</span>
           <span className={flowTab === 'Hexview' ? 'selected' : undefined} onClick={() => { this.setState({ flowTab: 'Hexview' }) }}>Hexview</span>
+          {
+            !(flow.websocket || flow.eventStream) ? null :
+              <span className={flowTab === 'Messages' ? 'selected' : undefined} onClick={() => { this.setState({ flowTab: 'Messages' }) }}>Messages</span>
+          }
 
           <EditFlow
             flow={flow}
@@ -308,6 +396,11 @@ class ViewFlow extends React.Component<Iprops, IState> {
               <div>{this.hexview()}</div>
           }
 
+          {
+            !(flowTab === 'Messages') ? null :
+              <div>{this.messages()}</div>
+          }
+
           {
             !(flowTab === 'Detail') ? null :
               <div>{this.detail()}</div>
@@ -4,6 +4,10 @@ import { arrayBufferToBase64, bufHexView, getSize, isTextBody } from './utils'
 
 export type Header = Record<string, string[]>
 
+// the last ones, as the go side keeps
+const maxWebSocketMessages = 1000
+const maxEventStreamEvents = 1000
+
 export interface IRequest {
   method: string
   url: string
@@ -23,6 +27,42 @@ export interface IResponse {
   body?: ArrayBuffer
 }
 
+export interface IFlowMeta {
+  marked: boolean
+  comment: string
+  metadata?: Record<string, any>
+}
+
+export interface IWebSocketMessage {
+  type: number // 1 text, 2 binary
+  content: string // base64
+  fromClient: boolean
+  timestamp: string
+  injected: boolean
+  dropped: boolean
+}
+
+export interface IWebSocket {
+  messages: IWebSocketMessage[] | null
+  closeCode: number
+  closeReason: string
+  closedByClient: boolean
+}
+
+export interface IServerSentEvent {
+  id: string
+  event: string
+  data: string
+  retry: number
+  timestamp: string
+  injected: boolean
+  dropped: boolean
+}
+
+export interface IEventStream {
+  events: IServerSentEvent[] | null
+}
+
 export interface IPreviewBody {
   type: 'image' | 'json' | 'binary'
   data: string | null
@@ -32,6 +72,7 @@ export interface IFlowPreview {
   no: number
   id: string
   waitIntercept: boolean
+  marked: boolean
   host: string
   path: string
   method: string
@@ -48,6 +89,11 @@ export class Flow {
   public waitIntercept: boolean
   public request: IRequest
   public response: IResponse | null = null
+  public marked = false
+  public comment = ''
+  public metadata: Record<string, any> = {}
+  public websocket: IWebSocket | null = null
+  public eventStream: IEventStream | null = null
 
   public url: URL
   private path: string
@@ -138,11 +184,43 @@ export class Flow {
     return this
   }
 
+  public addFlowMeta(msg: IMessage): Flow {
+    const meta = msg.content as IFlowMeta
+    this.marked = meta.marked
+    this.comment = meta.comment
+    if (meta.metadata) this.metadata = meta.metadata
+    return this
+  }
+
+  public addWebSocket(msg: IMessage): Flow {
+    const ws = msg.content as IWebSocket
+    this.websocket = { ...ws, messages: this.websocket?.messages || [] }
+    return this
+  }
+
+  public addWebSocketMessage(msg: IMessage): Flow {
+    if (!this.websocket) this.websocket = { messages: [], closeCode: 0, closeReason: '', closedByClient: false }
+    const messages = this.websocket.messages || []
+    messages.push(msg.content as IWebSocketMessage)
+    if (messages.length > maxWebSocketMessages) messages.splice(0, messages.length - maxWebSocketMessages)
+    this.websocket = { ...this.websocket, messages }
+    return this
+  }
+
+  public addServerSentEvent(msg: IMessage): Flow {
+    const events = this.eventStream?.events || []
+    events.push(msg.content as IServerSentEvent)
+    if (events.length > maxEventStreamEvents) events.splice(0, events.length - maxEventStreamEvents)
+    this.eventStream = { events }
+    return this
+  }
+
   public preview(): IFlowPreview {
     return {
       no: this.no,
       id: this.id,
       waitIntercept: this.waitIntercept,
+      marked: this.marked,
       host: this.url.host,
       path: this.path,
       method: this.request.method,
@@ -285,6 +363,27 @@ export class FlowManager {
     if (text) text = text.trim()
     if (!text) return this.items
 
+    // ~marked, ~comment <text>, ~meta <key>[=<value>]
+    if (text.startsWith('~')) {
+      const [cmd, ...rest] = text.slice(1).split(/\s+/)
+      const arg = rest.join(' ')
+      if (cmd === 'marked') {
+        return this.items.filter(item => item.marked)
+      }
+      if (cmd === 'comment') {
+        return this.items.filter(item => item.comment && item.comment.includes(arg))
+      }
+      if (cmd === 'meta') {
+        const [key, value] = arg.split('=')
+        return this.items.filter(item => {
+          if (!(key in item.metadata)) return false
+          if (value === undefined) return true
+          return String(item.metadata[key]) === value
+        })
+      }
+      return this.items
+    }
+
     // regexp
     if (text.startsWith('/') && text.endsWith('/')) {
       text = text.slice(1, text.length - 1).trim()
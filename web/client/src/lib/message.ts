@@ -1,5 +1,7 @@
 import type { IConnection } from './connection'
-import type { Flow, IFlowRequest, IRequest, IResponse } from './flow'
+import type { Flow, IFlowMeta, IFlowRequest, IRequest, IResponse, IWebSocket, IWebSocketMessage, IServerSentEvent } from './flow'
+
+const messageVersion = 2
 
 export enum MessageType {
   CONN = 0,
@@ -8,6 +10,10 @@ export enum MessageType {
   REQUEST_BODY = 2,
   RESPONSE = 3,
   RESPONSE_BODY = 4,
+  FLOW_META = 6,
+  WEBSOCKET = 7, // the close status, without the messages
+  SERVER_SENT_EVENT = 8, // a single event, appended to the ones of the flow
+  WEBSOCKET_MESSAGE = 9, // a single message, appended to the ones of the flow
 }
 
 const allMessageBytes = [
@@ -17,23 +23,27 @@ const allMessageBytes = [
   MessageType.REQUEST_BODY,
   MessageType.RESPONSE,
   MessageType.RESPONSE_BODY,
+  MessageType.FLOW_META,
+  MessageType.WEBSOCKET,
+  MessageType.SERVER_SENT_EVENT,
+  MessageType.WEBSOCKET_MESSAGE,
 ]
 
 export interface IMessage {
   type: MessageType
   id: string
   waitIntercept: boolean
-  content?: ArrayBuffer | IFlowRequest | IResponse | IConnection
+  content?: ArrayBuffer | IFlowRequest | IResponse | IConnection | IFlowMeta | IWebSocket | IWebSocketMessage | IServerSentEvent
 }
 
-// type: 0/1/2/3/4
+// type: 0/1/2/3/4/5/6/7/8/9
 // messageFlow
 // version 1 byte + type 1 byte + id 36 byte + waitIntercept 1 byte + content left bytes
 export const parseMessage = (data: ArrayBuffer): IMessage | null => {
   if (data.byteLength < 39) return null
   const meta = new Int8Array(data.slice(0, 39))
   const version = meta[0]
-  if (version !== 2) return null
+  if (version !== messageVersion) return null
   const type = meta[1] as MessageType
   if (!allMessageBytes.includes(type)) return null
   const id = new TextDecoder().decode(data.slice(2, 38))
@@ -68,6 +78,7 @@ export enum SendMessageType {
   DROP_REQUEST = 13,
   DROP_RESPONSE = 14,
   CHANGE_BREAK_POINT_RULES = 21,
+  CHANGE_FLOW_META = 22,
 }
 
 // type: 11/12/13/14
@@ -76,7 +87,7 @@ export enum SendMessageType {
 export const buildMessageEdit = (messageType: SendMessageType, flow: Flow) => {
   if (messageType === SendMessageType.DROP_REQUEST || messageType === SendMessageType.DROP_RESPONSE) {
     const view = new Uint8Array(38)
-    view[0] = 1
+    view[0] = messageVersion
     view[1] = messageType
     view.set(new TextEncoder().encode(flow.id), 2)
     return view
@@ -104,7 +115,7 @@ export const buildMessageEdit = (messageType: SendMessageType, flow: Flow) => {
   const len = 2 + 36 + 4 + headerBytes.byteLength + 4 + bodyLen
   const data = new ArrayBuffer(len)
   const view = new Uint8Array(data)
-  view[0] = 1
+  view[0] = messageVersion
   view[1] = messageType
   view.set(new TextEncoder().encode(flow.id), 2)
   view.set(headerBytes, 2 + 36 + 4)
@@ -127,9 +138,27 @@ export const buildMessageMeta = (messageType: SendMessageType, rules: any) => {
 
   const rulesBytes = new TextEncoder().encode(JSON.stringify(rules))
   const view = new Uint8Array(2 + rulesBytes.byteLength)
-  view[0] = 1
+  view[0] = messageVersion
   view[1] = messageType
   view.set(rulesBytes, 2)
 
   return view
 }
+
+// type: 22
+// messageFlowMeta
+// version 1 byte + type 1 byte + id 36 byte + content left bytes
+export const buildMessageFlowMeta = (flow: Flow) => {
+  const meta: IFlowMeta = {
+    marked: flow.marked,
+    comment: flow.comment,
+  }
+  const metaBytes = new TextEncoder().encode(JSON.stringify(meta))
+  const view = new Uint8Array(2 + 36 + metaBytes.byteLength)
+  view[0] = messageVersion
+  view[1] = SendMessageType.CHANGE_FLOW_META
+  view.set(new TextEncoder().encode(flow.id), 2)
+  view.set(metaBytes, 2 + 36)
+
+  return view
+}
@@ -98,3 +98,9 @@ export function isInViewPort(element: HTMLElement) {
     bottom <= viewHeight
   )
 }
+
+// host of the go side api, the dev server runs on another port
+export const apiHost = () => {
+  if (process.env.NODE_ENV === 'development') return 'http://localhost:9081'
+  return ''
+}
@@ -3,6 +3,7 @@ package web
 import (
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/proxati/mitmproxy/proxy"
@@ -15,22 +16,24 @@ type breakPointRule struct {
 }
 
 type concurrentConn struct {
+	web  *WebAddon
 	conn *websocket.Conn
 	mu   sync.Mutex
 
 	sendConnMessageMap map[string]bool
 
-	waitChans   map[string]chan interface{}
-	waitChansMu sync.Mutex
+	intercepts   map[string]*intercept // by flow id
+	interceptsMu sync.Mutex
 
 	breakPointRules []*breakPointRule
 }
 
-func newConn(c *websocket.Conn) *concurrentConn {
+func newConn(web *WebAddon, c *websocket.Conn) *concurrentConn {
 	return &concurrentConn{
+		web:                web,
 		conn:               c,
 		sendConnMessageMap: make(map[string]bool),
-		waitChans:          make(map[string]chan interface{}),
+		intercepts:         make(map[string]*intercept),
 	}
 }
 
@@ -66,8 +69,11 @@ func (c *concurrentConn) whenConnClose(connCtx *proxy.ConnContext) {
 }
 
 func (c *concurrentConn) writeMessage(msg *messageFlow, f *proxy.Flow) {
+	var ic *intercept
 	if c.isIntercpt(f, msg) {
 		msg.waitIntercept = 1
+		// registered before the message is sent, so the edit replying to it is not missed
+		ic = c.addIntercept(f.Id.String(), msg.mType)
 	}
 
 	c.mu.Lock()
@@ -75,11 +81,14 @@ func (c *concurrentConn) writeMessage(msg *messageFlow, f *proxy.Flow) {
 	c.mu.Unlock()
 	if err != nil {
 		sLogger.Error("could not WriteMessage", "error", err)
+		if ic != nil {
+			c.removeIntercept(f.Id.String(), ic)
+		}
 		return
 	}
 
-	if msg.waitIntercept == 1 {
-		c.waitIntercept(f, msg)
+	if ic != nil {
+		c.waitIntercept(f, ic)
 	}
 }
 
@@ -103,28 +112,61 @@ func (c *concurrentConn) readloop() {
 		}
 
 		if msgEdit, ok := msg.(*messageEdit); ok {
-			ch := c.initWaitChan(msgEdit.id.String())
-			go func(m *messageEdit, ch chan<- interface{}) {
-				ch <- m
-			}(msgEdit, ch)
+			c.resumeIntercept(msgEdit)
 		} else if msgMeta, ok := msg.(*messageMeta); ok {
 			c.breakPointRules = msgMeta.breakPointRules
+		} else if msgFlowMeta, ok := msg.(*messageFlowMeta); ok {
+			c.web.changeFlowMeta(msgFlowMeta)
 		} else {
 			sLogger.Warn("invalid message, skipping")
 		}
 	}
 }
 
-func (c *concurrentConn) initWaitChan(key string) chan interface{} {
-	c.waitChansMu.Lock()
-	defer c.waitChansMu.Unlock()
+// intercept is a flow waiting for the edit of its request or response.
+type intercept struct {
+	phase messageType // messageTypeRequestBody or messageTypeResponseBody
+	edits chan *messageEdit
+}
+
+func (c *concurrentConn) addIntercept(key string, phase messageType) *intercept {
+	c.interceptsMu.Lock()
+	defer c.interceptsMu.Unlock()
+	ic := &intercept{
+		phase: phase,
+		edits: make(chan *messageEdit, 1),
+	}
+	c.intercepts[key] = ic
+	return ic
+}
 
-	if ch, ok := c.waitChans[key]; ok {
-		return ch
+// removeIntercept removes ic if it is still the intercept of key.
+func (c *concurrentConn) removeIntercept(key string, ic *intercept) {
+	c.interceptsMu.Lock()
+	defer c.interceptsMu.Unlock()
+	if c.intercepts[key] == ic {
+		delete(c.intercepts, key)
 	}
-	ch := make(chan interface{})
-	c.waitChans[key] = ch
-	return ch
+}
+
+// resumeIntercept hands the edit to the intercept of its flow. Edits arriving after the intercept timed out,
+// or for the other phase of the flow, are dropped.
+func (c *concurrentConn) resumeIntercept(msg *messageEdit) {
+	key := msg.id.String()
+	phase := messageTypeRequestBody
+	if msg.mType == messageTypeChangeResponse || msg.mType == messageTypeDropResponse {
+		phase = messageTypeResponseBody
+	}
+
+	c.interceptsMu.Lock()
+	defer c.interceptsMu.Unlock()
+	ic, ok := c.intercepts[key]
+	if !ok || ic.phase != phase {
+		sLogger.Warn("no intercept waiting for the edit, skipping", "id", key, "mType", msg.mType)
+		return
+	}
+	delete(c.intercepts, key)
+	ic.edits <- msg
 }
 
 // Determine if it should intercept.
@@ -162,16 +204,29 @@ func (c *concurrentConn) isIntercpt(f *proxy.Flow, after *messageFlow) bool {
 	return false
 }
 
-// Intercept.
-func (c *concurrentConn) waitIntercept(f *proxy.Flow, after *messageFlow) {
-	ch := c.initWaitChan(f.Id.String())
-	msg := (<-ch).(*messageEdit)
+// Intercept. The flow is resumed unchanged after Timeouts.InterceptWait of the proxy if set.
+func (c *concurrentConn) waitIntercept(f *proxy.Flow, ic *intercept) {
+	key := f.Id.String()
+
+	var timeout <-chan time.Time
+	if d := f.ConnContext.Timeouts().InterceptWait; d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var msg *messageEdit
+	select {
+	case msg = <-ic.edits:
+	case <-timeout:
+		sLogger.Warn("intercept wait timeout, resuming flow", "id", key)
+		c.removeIntercept(key, ic)
+		return
+	}
 
 	// Drop.
 	if msg.mType == messageTypeDropRequest || msg.mType == messageTypeDropResponse {
-		f.Response = &proxy.Response{
-			StatusCode: 502,
-		}
+		f.Kill()
 		return
 	}
 
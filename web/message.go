@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"io"
 
 	"github.com/google/uuid"
 	"github.com/proxati/mitmproxy/proxy"
@@ -12,7 +13,7 @@ import (
 
 // message:
 
-// type: 0/1/2/3/4/5
+// type: 0/1/2/3/4/5/6/7/8/9
 // messageFlow
 // version 1 byte + type 1 byte + id 36 byte + waitIntercept 1 byte + content left bytes
 
@@ -24,6 +25,10 @@ import (
 // messageMeta
 // version 1 byte + type 1 byte + content left bytes
 
+// type: 22
+// messageFlowMeta
+// version 1 byte + type 1 byte + id 36 byte + content left bytes
+
 const messageVersion = 2
 
 type messageType byte
@@ -35,6 +40,12 @@ const (
 	messageTypeRequestBody  messageType = 2
 	messageTypeResponse     messageType = 3
 	messageTypeResponseBody messageType = 4
+	messageTypeFlowMeta     messageType = 6
+	messageTypeWebSocket    messageType = 7 // the close status, without the messages
+
+	// a single event or websocket message, appended to the ones of the flow
+	messageTypeServerSentEvent  messageType = 8
+	messageTypeWebSocketMessage messageType = 9
 
 	messageTypeChangeRequest  messageType = 11
 	messageTypeChangeResponse messageType = 12
@@ -42,6 +53,7 @@ const (
 	messageTypeDropResponse   messageType = 14
 
 	messageTypeChangeBreakPointRules messageType = 21
+	messageTypeChangeFlowMeta        messageType = 22
 )
 
 var allMessageTypes = []messageType{
@@ -51,11 +63,16 @@ var allMessageTypes = []messageType{
 	messageTypeRequestBody,
 	messageTypeResponse,
 	messageTypeResponseBody,
+	messageTypeFlowMeta,
+	messageTypeWebSocket,
+	messageTypeServerSentEvent,
+	messageTypeWebSocketMessage,
 	messageTypeChangeRequest,
 	messageTypeChangeResponse,
 	messageTypeDropRequest,
 	messageTypeDropResponse,
 	messageTypeChangeBreakPointRules,
+	messageTypeChangeFlowMeta,
 }
 
 func validMessageType(t byte) bool {
@@ -90,11 +107,26 @@ func newMessageFlow(mType messageType, f *proxy.Flow) *messageFlow {
 		m["connId"] = f.ConnContext.ID().String()
 		content, err = json.Marshal(m)
 	} else if mType == messageTypeRequestBody {
-		content = f.Request.Body
+		if f.Request.BodySpilled() {
+			content, err = io.ReadAll(io.LimitReader(f.Request.OpenBody(), maxSpilledBodyMessage))
+		} else {
+			content = f.Request.Body
+		}
 	} else if mType == messageTypeResponse {
 		content, err = json.Marshal(f.Response)
 	} else if mType == messageTypeResponseBody {
-		content, err = f.Response.DecodedBody()
+		if f.Response.BodySpilled() {
+			content, err = readSpilledResponseBody(f.Response)
+		} else {
+			content, err = f.Response.DecodedBody()
+		}
+	} else if mType == messageTypeWebSocket {
+		code, reason, byClient := f.WebSocket.CloseStatus()
+		content, err = json.Marshal(map[string]any{
+			"closeCode":      code,
+			"closeReason":    reason,
+			"closedByClient": byClient,
+		})
 	} else {
 		panic(errors.New("invalid message type"))
 	}
@@ -115,6 +147,43 @@ func newMessageFlow(mType messageType, f *proxy.Flow) *messageFlow {
 	}
 }
 
+func newMessageFlowMeta(id uuid.UUID, meta *flowMeta) *messageFlow {
+	content, err := json.Marshal(meta)
+	if err != nil {
+		panic(err)
+	}
+	return &messageFlow{
+		mType:   messageTypeFlowMeta,
+		id:      id,
+		content: content,
+	}
+}
+
+// newMessageFlowItem is a messageTypeServerSentEvent or messageTypeWebSocketMessage of the flow with id.
+func newMessageFlowItem(mType messageType, id uuid.UUID, item any) *messageFlow {
+	content, err := json.Marshal(item)
+	if err != nil {
+		panic(err)
+	}
+	return &messageFlow{
+		mType:   mType,
+		id:      id,
+		content: content,
+	}
+}
+
+// maxSpilledBodyMessage caps the bodies spilled to disk sent to the web interface, the rest is cut.
+const maxSpilledBodyMessage = 5 * 1024 * 1024
+
+func readSpilledResponseBody(res *proxy.Response) ([]byte, error) {
+	body, err := proxy.DecodeReader(res.Header, res.OpenBody())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(io.LimitReader(body, maxSpilledBodyMessage))
+}
+
 func newMessageConnClose(connCtx *proxy.ConnContext) *messageFlow {
 	return &messageFlow{
 		mType: messageTypeConnClose,
@@ -273,6 +342,58 @@ func (m *messageMeta) bytes() []byte {
 	return buf.Bytes()
 }
 
+// flow fields editable from the web interface
+type flowMeta struct {
+	Marked   bool            `json:"marked"`
+	Comment  string          `json:"comment"`
+	Metadata *proxy.Metadata `json:"metadata,omitempty"`
+}
+
+type messageFlowMeta struct {
+	mType messageType
+	id    uuid.UUID
+	meta  *flowMeta
+}
+
+func parseMessageFlowMeta(data []byte) *messageFlowMeta {
+	// 2 + 36
+	if len(data) < 38 {
+		return nil
+	}
+
+	id, err := uuid.Parse(string(data[2:38]))
+	if err != nil {
+		return nil
+	}
+
+	meta := new(flowMeta)
+	err = json.Unmarshal(data[38:], meta)
+	if err != nil {
+		return nil
+	}
+
+	return &messageFlowMeta{
+		mType: messageType(data[1]),
+		id:    id,
+		meta:  meta,
+	}
+}
+
+func (m *messageFlowMeta) bytes() []byte {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	buf.WriteByte(byte(messageVersion))
+	buf.WriteByte(byte(m.mType))
+	buf.WriteString(m.id.String()) // len: 36
+
+	content, err := json.Marshal(m.meta)
+	if err != nil {
+		panic(err)
+	}
+	buf.Write(content)
+
+	return buf.Bytes()
+}
+
 func parseMessage(data []byte) message {
 	if len(data) < 2 {
 		return nil
@@ -292,6 +413,8 @@ func parseMessage(data []byte) message {
 		return parseMessageEdit(data)
 	} else if mType == messageTypeChangeBreakPointRules {
 		return parseMessageMeta(data)
+	} else if mType == messageTypeChangeFlowMeta {
+		return parseMessageFlowMeta(data)
 	} else {
 		sLogger.Warn("invalid message type", "mType", mType)
 		return nil
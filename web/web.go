@@ -2,12 +2,17 @@ package web
 
 import (
 	"embed"
+	"encoding/json"
 	"io/fs"
 	"log"
 	"net/http"
+	"net/url"
 	"sync"
 
+	"github.com/golang/groupcache/lru"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/proxati/mitmproxy/contentview"
 	"github.com/proxati/mitmproxy/proxy"
 )
 
@@ -17,13 +22,19 @@ var assets embed.FS
 type WebAddon struct {
 	proxy.BaseAddon
 	upgrader *websocket.Upgrader
+	mux      *http.ServeMux
 
 	conns   []*concurrentConn
 	connsMu sync.RWMutex
+
+	// marks, comments and metadata of the recent flows by id, so they can be edited from the web interface
+	flows   *lru.Cache // *editableFlow
+	flowsMu sync.Mutex
 }
 
 func NewWebAddon(addr string) *WebAddon {
 	web := new(WebAddon)
+	web.flows = lru.New(1000)
 	web.upgrader = &websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
 			return true
@@ -31,7 +42,9 @@ func NewWebAddon(addr string) *WebAddon {
 	}
 
 	serverMux := new(http.ServeMux)
+	web.mux = serverMux
 	serverMux.HandleFunc("/echo", web.echo)
+	serverMux.HandleFunc("/api/contentview", web.contentView)
 
 	fsys, err := fs.Sub(assets, "client/build")
 	if err != nil {
@@ -51,6 +64,11 @@ func NewWebAddon(addr string) *WebAddon {
 	return web
 }
 
+// Handle registers handler for pattern on the web interface server, e.g. the metrics endpoint.
+func (web *WebAddon) Handle(pattern string, handler http.Handler) {
+	web.mux.Handle(pattern, handler)
+}
+
 func (web *WebAddon) echo(w http.ResponseWriter, r *http.Request) {
 	c, err := web.upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -58,7 +76,7 @@ func (web *WebAddon) echo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conn := newConn(c)
+	conn := newConn(web, c)
 	web.addConn(conn)
 	defer func() {
 		web.removeConn(conn)
@@ -68,6 +86,98 @@ func (web *WebAddon) echo(w http.ResponseWriter, r *http.Request) {
 	conn.readloop()
 }
 
+// contentViewRequest is a body shown in the web interface, rendered with the views shared with the Dumper.
+// The response body is the decoded one sent to the web interface.
+type contentViewRequest struct {
+	ID      string `json:"id"`
+	Part    string `json:"part"` // request, response or query
+	View    string `json:"view"` // empty for auto
+	Request struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header"`
+	} `json:"request"`
+	ResponseHeader http.Header `json:"responseHeader"`
+	Body           []byte      `json:"body"`
+}
+
+// contentView renders a body sent by the web interface, which has the bodies of the flows.
+// The gRPC messages of a recent flow are decoded with the descriptor sets of its proxy.
+// POST /api/contentview with a contentViewRequest
+func (web *WebAddon) contentView(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req contentViewRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxSpilledBodyMessage)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(req.Request.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f := &proxy.Flow{
+		Request: &proxy.Request{Method: req.Request.Method, URL: u, Header: req.Request.Header},
+	}
+	if f.Request.Header == nil {
+		f.Request.Header = make(http.Header)
+	}
+	if ef := web.getFlow(req.ID); ef != nil {
+		f.ConnContext = ef.connCtx
+	}
+
+	view := req.View
+	var text string
+	switch req.Part {
+	case "request":
+		f.Request.Body = req.Body
+		if view == "" {
+			view, text, err = contentview.RenderRequest(f)
+		} else {
+			text, err = contentview.RenderRequestWith(view, f)
+		}
+	case "response":
+		header := req.ResponseHeader.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		header.Del("Content-Encoding")
+		f.Response = &proxy.Response{Header: header, Body: req.Body}
+		if view == "" {
+			view, text, err = contentview.RenderResponse(f)
+		} else {
+			text, err = contentview.RenderResponseWith(view, f)
+		}
+	case "query":
+		if view == "" {
+			view = contentview.Query.Name()
+		}
+		text, err = contentview.RenderWith(view, "", []byte(u.RawQuery))
+	default:
+		http.Error(w, "invalid part", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]any{
+		"view":  view,
+		"views": contentview.Names(),
+		"text":  text,
+	})
+	if err != nil {
+		sLogger.Error("could not write content view", "error", err)
+	}
+}
+
 func (web *WebAddon) addConn(c *concurrentConn) {
 	web.connsMu.Lock()
 	web.conns = append(web.conns, c)
@@ -122,7 +232,94 @@ func (web *WebAddon) sendFlow(f *proxy.Flow, msgFn func() *messageFlow) bool {
 	return true
 }
 
+// editableFlow is what the web interface edits of a flow. The flow is kept until it is done,
+// so the addons see the edits, and then only its marks and comment, not its bodies, which the web interface has.
+type editableFlow struct {
+	id       uuid.UUID
+	metadata *proxy.Metadata
+	connCtx  *proxy.ConnContext // for the gRPC descriptor sets of the content views
+
+	mu      sync.Mutex
+	flow    *proxy.Flow // nil once done
+	marked  bool
+	comment string
+}
+
+// done is called when <-f.Done()
+func (ef *editableFlow) done() {
+	ef.mu.Lock()
+	defer ef.mu.Unlock()
+	ef.marked = ef.flow.Marked()
+	ef.comment = ef.flow.Comment()
+	ef.flow = nil
+}
+
+func (ef *editableFlow) edit(meta *flowMeta) {
+	ef.mu.Lock()
+	if ef.flow != nil {
+		ef.flow.SetMarked(meta.Marked)
+		ef.flow.SetComment(meta.Comment)
+	} else {
+		ef.marked = meta.Marked
+		ef.comment = meta.Comment
+	}
+	ef.mu.Unlock()
+	meta.Metadata.Range(func(key string, value any) bool {
+		ef.metadata.Set(key, value)
+		return true
+	})
+}
+
+func (ef *editableFlow) meta() *flowMeta {
+	ef.mu.Lock()
+	defer ef.mu.Unlock()
+	if ef.flow != nil {
+		return &flowMeta{Marked: ef.flow.Marked(), Comment: ef.flow.Comment(), Metadata: ef.metadata}
+	}
+	return &flowMeta{Marked: ef.marked, Comment: ef.comment, Metadata: ef.metadata}
+}
+
+func (web *WebAddon) getFlow(id string) *editableFlow {
+	web.flowsMu.Lock()
+	defer web.flowsMu.Unlock()
+	if ef, ok := web.flows.Get(id); ok {
+		return ef.(*editableFlow)
+	}
+	return nil
+}
+
+func (web *WebAddon) changeFlowMeta(msg *messageFlowMeta) {
+	ef := web.getFlow(msg.id.String())
+	if ef == nil {
+		sLogger.Warn("flow not found, skipping", "id", msg.id)
+		return
+	}
+
+	ef.edit(msg.meta)
+	web.sendFlowMeta(ef)
+}
+
+// sendFlowMeta sends the marks, comment and metadata of the flow, which may be done.
+func (web *WebAddon) sendFlowMeta(ef *editableFlow) {
+	web.forEachConn(func(c *concurrentConn) {
+		// flow meta messages are not intercepted, the flow is not needed
+		c.writeMessage(newMessageFlowMeta(ef.id, ef.meta()), nil)
+	})
+}
+
 func (web *WebAddon) Requestheaders(f *proxy.Flow) {
+	ef := &editableFlow{id: f.Id, metadata: f.Metadata, connCtx: f.ConnContext, flow: f}
+	web.flowsMu.Lock()
+	web.flows.Add(f.Id.String(), ef)
+	web.flowsMu.Unlock()
+
+	go func() {
+		<-f.Done()
+		ef.done()
+		// metadata may be changed by other addons
+		web.sendFlowMeta(ef)
+	}()
+
 	if f.ConnContext.ClientConn.TLS {
 		web.forEachConn(func(c *concurrentConn) {
 			c.trySendConnMessage(f)
@@ -158,6 +355,24 @@ func (web *WebAddon) Response(f *proxy.Flow) {
 	})
 }
 
+func (web *WebAddon) WebsocketMessage(f *proxy.Flow, msg *proxy.WebSocketMessage) {
+	web.sendFlow(f, func() *messageFlow {
+		return newMessageFlowItem(messageTypeWebSocketMessage, f.Id, msg)
+	})
+}
+
+func (web *WebAddon) WebsocketEnd(f *proxy.Flow) {
+	web.sendFlow(f, func() *messageFlow {
+		return newMessageFlow(messageTypeWebSocket, f)
+	})
+}
+
+func (web *WebAddon) ServerSentEvent(f *proxy.Flow, e *proxy.ServerSentEvent) {
+	web.sendFlow(f, func() *messageFlow {
+		return newMessageFlowItem(messageTypeServerSentEvent, f.Id, e)
+	})
+}
+
 func (web *WebAddon) ServerDisconnected(connCtx *proxy.ConnContext) {
 	web.forEachConn(func(c *concurrentConn) {
 		c.whenConnClose(connCtx)